@@ -0,0 +1,86 @@
+package actions_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"chameth.com/actions/common"
+	"chameth.com/actions/multicall"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+type actionFile struct {
+	Description string `yaml:"description"`
+	Runs        struct {
+		Args []string          `yaml:"args"`
+		Env  map[string]string `yaml:"env"`
+	} `yaml:"runs"`
+	Inputs map[string]struct {
+		Required bool    `yaml:"required"`
+		Default  *string `yaml:"default"`
+	} `yaml:"inputs"`
+	Outputs map[string]struct {
+		Description string `yaml:"description"`
+	} `yaml:"outputs"`
+}
+
+// TestCommandsMatchActions checks that the inputs and outputs each binary
+// declares are the same as those in its action.yml, and that inputs are
+// passed through correctly.
+func TestCommandsMatchActions(t *testing.T) {
+	for _, cmd := range multicall.Commands() {
+		t.Run(cmd.Name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join(cmd.Name, "action.yml"))
+			require.NoError(t, err)
+
+			var action actionFile
+			require.NoError(t, yaml.Unmarshal(data, &action))
+			assert.Equal(t, action.Description, cmd.Description)
+
+			var declared, args []string
+			for _, spec := range cmd.Inputs() {
+				declared = append(declared, spec.Name)
+
+				input, ok := action.Inputs[spec.Name]
+				if !assert.True(t, ok, "input %s is not in action.yml", spec.Name) {
+					continue
+				}
+				assert.Equal(t, spec.Required, input.Required, "required for input %s", spec.Name)
+
+				var def string
+				if input.Default != nil {
+					def = *input.Default
+				}
+				assert.Equal(t, spec.Default, def, "default for input %s", spec.Name)
+
+				reference := fmt.Sprintf("${{ inputs.%s }}", spec.Name)
+				if spec.Kind == common.KindSecret {
+					assert.Equal(t, reference, action.Runs.Env[spec.Env], "env %s for input %s", spec.Env, spec.Name)
+				} else {
+					args = append(args, fmt.Sprintf("-%s=%s", spec.Name, reference))
+				}
+			}
+
+			for name := range action.Inputs {
+				assert.Contains(t, declared, name, "input %s is not declared by the command", name)
+			}
+			slices.Sort(args)
+			assert.Equal(t, args, slices.Sorted(slices.Values(action.Runs.Args)))
+
+			outputs := make(map[string]string)
+			for _, spec := range cmd.Outputs() {
+				outputs[spec.Name] = spec.Description
+			}
+			expected := make(map[string]string)
+			for name, output := range action.Outputs {
+				expected[name] = output.Description
+			}
+			assert.Equal(t, expected, outputs)
+		})
+	}
+}
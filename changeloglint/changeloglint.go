@@ -0,0 +1,111 @@
+package changeloglint
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"chameth.com/actions/common"
+	"github.com/go-git/go-git/v5"
+)
+
+type Options struct {
+	// Changelog is the path to the changelog to check.
+	Changelog string
+	// Heading matches the changelog's version headings. If nil, the Keep a
+	// Changelog format is expected.
+	Heading *regexp.Regexp
+	// Version must have a section in the changelog. If empty, the version of
+	// the tag that triggered the workflow is used, if any.
+	Version string
+	// TagPrefix is removed from the triggering tag to find the version.
+	TagPrefix string
+	// FailOn is the severity of problem that fails the action: "error",
+	// "warning" or "never".
+	FailOn string
+}
+
+func Run(ctx *common.Context, opts Options) error {
+	failOn := strings.ToLower(opts.FailOn)
+	if failOn != string(SeverityError) && failOn != string(SeverityWarning) && failOn != "never" {
+		return fmt.Errorf("invalid fail-on %q: must be error, warning or never", opts.FailOn)
+	}
+
+	version := opts.Version
+	if version == "" {
+		version = strings.TrimPrefix(ctx.Tag(), opts.TagPrefix)
+	}
+
+	changelog, err := common.ReadChangelogMatching(opts.Changelog, opts.Heading)
+	if err != nil {
+		return err
+	}
+
+	problems := Lint(changelog, version)
+	file := repositoryPath(opts.Changelog)
+
+	var errors, warnings int
+	rows := make([][]string, len(problems))
+	for i, p := range problems {
+		annotation := common.Annotation{Title: "Changelog", File: file, Line: p.Line}
+		if p.Severity == SeverityError {
+			errors++
+			ctx.Error(p.Message, annotation)
+		} else {
+			warnings++
+			ctx.Warning(p.Message, annotation)
+		}
+		line := ""
+		if p.Line > 0 {
+			line = strconv.Itoa(p.Line)
+		}
+		rows[i] = []string{line, string(p.Severity), p.Message}
+	}
+
+	slog.Info("Checked changelog", "path", opts.Changelog, "errors", errors, "warnings", warnings)
+
+	if err := ctx.WriteOutput(map[string]string{
+		"errors":   strconv.Itoa(errors),
+		"warnings": strconv.Itoa(warnings),
+	}); err != nil {
+		return err
+	}
+
+	s := ctx.NewSummary().Heading(3, "Changelog lint")
+	if len(problems) == 0 {
+		s.Paragraph(fmt.Sprintf("No problems found in %s.", common.Code(file)))
+	} else {
+		s.Paragraph(fmt.Sprintf("Found %d error(s) and %d warning(s) in %s.", errors, warnings, common.Code(file))).
+			Table([]string{"Line", "Severity", "Problem"}, rows)
+	}
+	if err := s.Write(); err != nil {
+		return err
+	}
+
+	if (failOn == string(SeverityError) && errors > 0) || (failOn == string(SeverityWarning) && errors+warnings > 0) {
+		return fmt.Errorf("changelog has %d error(s) and %d warning(s)", errors, warnings)
+	}
+	return nil
+}
+
+// repositoryPath returns the path of the file relative to the root of the
+// repository containing it, as annotations expect. If it isn't in a
+// repository, the path is returned unchanged.
+func repositoryPath(path string) string {
+	repo, err := git.PlainOpenWithOptions(filepath.Dir(path), &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return path
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(worktree.Filesystem.Root(), path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
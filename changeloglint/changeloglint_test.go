@@ -0,0 +1,84 @@
+package changeloglint
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"chameth.com/actions/common"
+	"github.com/go-git/go-git/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	workspace := t.TempDir()
+	dir := filepath.Join(workspace, "src")
+	_, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+
+	changelog := filepath.Join(dir, "CHANGELOG.md")
+	require.NoError(t, os.WriteFile(changelog, []byte("## 1.0.0\n\n- Thing\n\n## 1.1.0 - 2024-01-01\n\n- Thing\n"), 0644))
+
+	tests := []struct {
+		name   string
+		opts   Options
+		ref    string
+		err    string
+		output map[string]string
+	}{
+		{
+			name:   "report only",
+			opts:   Options{FailOn: "never"},
+			output: map[string]string{"errors": "2", "warnings": "0"},
+		},
+		{
+			name:   "version from tag",
+			opts:   Options{TagPrefix: "v", FailOn: "never"},
+			ref:    "refs/tags/v2.0.0",
+			output: map[string]string{"errors": "3", "warnings": "0"},
+		},
+		{
+			name:   "fail on error",
+			opts:   Options{FailOn: "error"},
+			err:    "changelog has 2 error(s) and 0 warning(s)",
+			output: map[string]string{"errors": "2", "warnings": "0"},
+		},
+		{
+			name: "invalid fail-on",
+			opts: Options{FailOn: "sometimes"},
+			err:  `invalid fail-on "sometimes": must be error, warning or never`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			ctx := &common.Context{
+				Workspace:   workspace,
+				Ref:         tt.ref,
+				OutputFile:  filepath.Join(t.TempDir(), "output"),
+				SummaryFile: filepath.Join(t.TempDir(), "summary.md"),
+				Stdout:      &stdout,
+			}
+			tt.opts.Changelog = changelog
+
+			err := Run(ctx, tt.opts)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			outputs, err := common.ReadKeyValueFile(ctx.OutputFile)
+			require.NoError(t, err)
+			if tt.output == nil {
+				assert.Empty(t, outputs)
+				return
+			}
+			assert.Equal(t, tt.output, outputs)
+			assert.Contains(t, stdout.String(), "::error title=Changelog,file=CHANGELOG.md,line=1::1.0.0 has no release date\n")
+		})
+	}
+}
@@ -0,0 +1,7 @@
+package main
+
+import "chameth.com/actions/changeloglint"
+
+func main() {
+	changeloglint.Command().Main()
+}
@@ -0,0 +1,26 @@
+package changeloglint
+
+import "chameth.com/actions/common"
+
+func Command() *common.Command {
+	c := common.NewCommand("changeloglint", "Check the structure of a Keep a Changelog formatted changelog")
+	changelog := c.Path("changelog", "src/CHANGELOG.md", "Path to the changelog to check")
+	heading := c.HeadingPattern("changelog-heading", "keepachangelog", "Format of the changelog's version headings: keepachangelog, plain, version, or a regular expression capturing the version")
+	version := c.String("version", "", "Version that must have a section (defaults to the version of the triggering tag)")
+	tagPrefix := c.String("tag-prefix", "v", "Prefix removed from the triggering tag to find the version")
+	failOn := c.String("fail-on", "never", "Fail on problems of this severity or worse: error, warning or never")
+
+	c.Output("errors", "The number of errors found")
+	c.Output("warnings", "The number of warnings found")
+
+	c.Run = func(ctx *common.Context) error {
+		return Run(ctx, Options{
+			Changelog: changelog.Value(),
+			Heading:   heading.Value(),
+			Version:   version.Value(),
+			TagPrefix: tagPrefix.Value(),
+			FailOn:    failOn.Value(),
+		})
+	}
+	return c
+}
@@ -0,0 +1,179 @@
+package changeloglint
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"chameth.com/actions/common"
+	"github.com/hashicorp/go-version"
+)
+
+// Severity is how serious a problem is, matching the fail-on input.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Problem is an issue found in a changelog.
+type Problem struct {
+	Severity Severity
+	// Line is the line number the problem relates to, starting at 1, or
+	// zero if it relates to the changelog as a whole.
+	Line    int
+	Message string
+}
+
+// semverRe matches a full semantic version, as FindChangelogSection needs
+// to match the version of a tag exactly.
+var semverRe = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-[0-9A-Za-z.-]+)?(?:\+[0-9A-Za-z.-]+)?$`)
+
+type linter struct {
+	problems []Problem
+}
+
+func (l *linter) add(severity Severity, line int, format string, a ...any) {
+	l.problems = append(l.problems, Problem{Severity: severity, Line: line, Message: fmt.Sprintf(format, a...)})
+}
+
+// Lint checks the changelog's structure: that each release heading has a
+// semantic version and, if its headings are dated, a date, that releases are newest first without
+// duplicates, and that no release or subsection is empty. If required is
+// given, the changelog must also have a non-empty section for that version.
+func Lint(changelog *common.Changelog, required string) []Problem {
+	l := &linter{}
+
+	seen := map[string]*common.ChangelogRelease{}
+	var previous *common.ChangelogRelease
+	var previousVersion *version.Version
+	for i, r := range changelog.Releases {
+		if r.Unreleased() {
+			l.unreleased(r, i)
+			continue
+		}
+
+		l.heading(changelog, r)
+
+		key := strings.ToLower(strings.TrimPrefix(r.Version, "v"))
+		if first, ok := seen[key]; ok {
+			l.add(SeverityError, r.Line, "Duplicate section for %s, first on line %d", r.Version, first.Line)
+		} else {
+			seen[key] = r
+		}
+
+		v := l.version(r)
+		if v != nil && previousVersion != nil && v.GreaterThan(previousVersion) {
+			l.add(SeverityError, r.Line, "%s is listed below %s, but is newer", r.Version, previous.Version)
+		}
+
+		if changelog.Dated() {
+			l.date(r, previous)
+		}
+		if r.Empty() {
+			l.add(SeverityWarning, r.Line, "%s has no changes", r.Version)
+		}
+		l.sections(r)
+
+		if v != nil {
+			previous, previousVersion = r, v
+		}
+	}
+
+	if required != "" {
+		if r := changelog.Release(required); r == nil {
+			l.add(SeverityError, 0, "Changelog has no section for %s", required)
+		} else if r.Empty() {
+			l.add(SeverityError, r.Line, "The section for %s is empty", required)
+		}
+	}
+
+	slices.SortStableFunc(l.problems, func(a, b Problem) int {
+		return a.Line - b.Line
+	})
+	return l.problems
+}
+
+// heading checks the release's heading is written in the changelog's style,
+// unless its heading pattern wouldn't match that.
+func (l *linter) heading(changelog *common.Changelog, r *common.ChangelogRelease) {
+	expected := changelog.Heading(r)
+	if changelog.Pattern != nil && !changelog.Pattern.MatchString(expected) {
+		return
+	}
+	if strings.TrimSpace(r.Heading) != expected {
+		l.add(SeverityWarning, r.Line, "Heading should be written as %q", expected)
+	}
+}
+
+func (l *linter) unreleased(r *common.ChangelogRelease, index int) {
+	if index != 0 {
+		l.add(SeverityError, r.Line, "The %s section should come before every release", r.Version)
+	}
+	if r.Date != "" {
+		l.add(SeverityWarning, r.Line, "The %s section should not have a date", r.Version)
+	}
+	l.sections(r)
+}
+
+// version checks the release's version is a semantic version, returning
+// it if it can be compared with others.
+func (l *linter) version(r *common.ChangelogRelease) *version.Version {
+	trimmed := strings.TrimPrefix(r.Version, "v")
+	if !semverRe.MatchString(trimmed) {
+		l.add(SeverityError, r.Line, "Version %q is not a semantic version (MAJOR.MINOR.PATCH)", r.Version)
+		return nil
+	}
+	if trimmed != r.Version {
+		l.add(SeverityWarning, r.Line, "Version %s should be written without the \"v\" prefix", r.Version)
+	}
+	v, err := version.NewSemver(trimmed)
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+// date checks the release has a valid date, no later than the release
+// listed above it.
+func (l *linter) date(r, previous *common.ChangelogRelease) {
+	if r.Date == "" {
+		l.add(SeverityError, r.Line, "%s has no release date", r.Version)
+		return
+	}
+	date, err := time.Parse(time.DateOnly, r.Date)
+	if err != nil {
+		l.add(SeverityError, r.Line, "%s has an invalid date %q: must be in YYYY-MM-DD format", r.Version, r.Date)
+		return
+	}
+	if previous == nil {
+		return
+	}
+	if previousDate, err := time.Parse(time.DateOnly, previous.Date); err == nil && date.After(previousDate) {
+		l.add(SeverityWarning, r.Line, "%s is dated %s, after the newer %s (%s)", r.Version, r.Date, previous.Version, previous.Date)
+	}
+}
+
+// sections checks each subsection of the release has a known type and
+// some content.
+func (l *linter) sections(r *common.ChangelogRelease) {
+	for _, s := range r.Sections {
+		l.sectionType(s)
+		if s.Empty() {
+			l.add(SeverityWarning, s.Line, "The %s section of %s is empty", s.Type, r.Version)
+		}
+	}
+}
+
+func (l *linter) sectionType(s *common.ChangelogSection) {
+	if !slices.Contains(common.ChangeTypes, s.Type) {
+		names := make([]string, len(common.ChangeTypes))
+		for i, t := range common.ChangeTypes {
+			names[i] = string(t)
+		}
+		l.add(SeverityWarning, s.Line, "Unknown change type %q, expected one of %s", s.Type, strings.Join(names, ", "))
+	}
+}
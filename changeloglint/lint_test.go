@@ -0,0 +1,168 @@
+package changeloglint
+
+import (
+	"testing"
+
+	"chameth.com/actions/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const validChangelog = `# Changelog
+
+## [Unreleased]
+
+### Added
+- Widgets
+
+## [1.1.0] - 2024-02-01
+
+### Fixed
+- Bug
+
+## [1.0.0] - 2024-01-01
+
+Initial release.
+`
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		required string
+		expected []Problem
+	}{
+		{
+			name:    "valid",
+			content: validChangelog,
+		},
+		{
+			name:     "required version present",
+			content:  validChangelog,
+			required: "1.1.0",
+		},
+		{
+			name:     "required version missing",
+			content:  validChangelog,
+			required: "1.2.0",
+			expected: []Problem{{SeverityError, 0, "Changelog has no section for 1.2.0"}},
+		},
+		{
+			name:     "required version empty",
+			content:  "## [1.0.0] - 2024-01-01\n\n### Added\n",
+			required: "v1.0.0",
+			expected: []Problem{
+				{SeverityWarning, 1, "1.0.0 has no changes"},
+				{SeverityError, 1, "The section for v1.0.0 is empty"},
+				{SeverityWarning, 3, "The Added section of 1.0.0 is empty"},
+			},
+		},
+		{
+			name:     "incomplete version",
+			content:  "## v1.2 - 2024-01-01\n\n- Thing\n",
+			required: "1.2.0",
+			expected: []Problem{
+				{SeverityError, 0, "Changelog has no section for 1.2.0"},
+				{SeverityError, 1, `Version "v1.2" is not a semantic version (MAJOR.MINOR.PATCH)`},
+			},
+		},
+		{
+			name:    "prefixed version",
+			content: "## v1.2.0 - 2024-01-01\n\n- Thing\n",
+			expected: []Problem{
+				{SeverityWarning, 1, `Version v1.2.0 should be written without the "v" prefix`},
+			},
+		},
+		{
+			name:    "malformed heading",
+			content: "## [1.0.0]  -  2024-01-01\n\n- Thing\n",
+			expected: []Problem{
+				{SeverityWarning, 1, `Heading should be written as "## [1.0.0] - 2024-01-01"`},
+			},
+		},
+		{
+			name:    "out of order",
+			content: "## 1.0.0 - 2024-01-01\n\n- Thing\n\n## 1.1.0 - 2024-01-01\n\n- Thing\n",
+			expected: []Problem{
+				{SeverityError, 5, "1.1.0 is listed below 1.0.0, but is newer"},
+			},
+		},
+		{
+			name:    "duplicate",
+			content: "## 1.0.0 - 2024-01-01\n\n- Thing\n\n## v1.0.0 - 2024-01-01\n\n- Thing\n",
+			expected: []Problem{
+				{SeverityError, 5, "Duplicate section for v1.0.0, first on line 1"},
+				{SeverityWarning, 5, `Version v1.0.0 should be written without the "v" prefix`},
+			},
+		},
+		{
+			name:    "dates",
+			content: "## 1.2.0\n\n- Thing\n\n## 1.1.0 - 01/02/2024\n\n- Thing\n\n## 1.0.0 - 2024-03-01\n\n- Thing\n\n## 0.9.0 - 2024-04-01\n\n- Thing\n",
+			expected: []Problem{
+				{SeverityError, 1, "1.2.0 has no release date"},
+				{SeverityError, 5, `1.1.0 has an invalid date "01/02/2024": must be in YYYY-MM-DD format`},
+				{SeverityWarning, 13, "0.9.0 is dated 2024-04-01, after the newer 1.0.0 (2024-03-01)"},
+			},
+		},
+		{
+			name:    "unreleased",
+			content: "## 1.0.0 - 2024-01-01\n\n- Thing\n\n## Unreleased - 2024-02-01\n\n### Tweaked\n- Thing\n",
+			expected: []Problem{
+				{SeverityError, 5, "The Unreleased section should come before every release"},
+				{SeverityWarning, 5, "The Unreleased section should not have a date"},
+				{SeverityWarning, 7, `Unknown change type "Tweaked", expected one of Added, Changed, Deprecated, Removed, Fixed, Security`},
+			},
+		},
+		{
+			name:    "empty unreleased",
+			content: "## [Unreleased]\n\n## 1.0.0 - 2024-01-01\n\n- Thing\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Lint(common.ParseChangelog(tt.content), tt.required))
+		})
+	}
+}
+
+func TestLint_HeadingPattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		content  string
+		expected []Problem
+	}{
+		{
+			name:    "plain",
+			pattern: "plain",
+			content: "# Unreleased\n\n# 1.1.0 - 2024-02-01\n\n## Fixed\n- Bug\n\n# 1.0.0 -  2024-01-01\n\n## Added\n",
+			expected: []Problem{
+				{SeverityWarning, 8, `Heading should be written as "# 1.0.0 - 2024-01-01"`},
+				{SeverityWarning, 8, "1.0.0 has no changes"},
+				{SeverityWarning, 10, "The Added section of 1.0.0 is empty"},
+			},
+		},
+		{
+			name:    "plain without dates",
+			pattern: "plain",
+			content: "# Changelog\n\n## 1.2.0\n\n- Thing\n\n## 1.1.0\n\n- Other\n",
+		},
+		{
+			name:    "version",
+			pattern: "version",
+			content: "## Unreleased\n\n## Version 1.1.0 (2024-02-01)\n\n### Fixed\n- Bug\n\n## Version 1.0.0\n\n- Thing\n",
+			expected: []Problem{
+				{SeverityError, 8, "1.0.0 has no release date"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, err := common.ParseHeadingPattern(tt.pattern)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, Lint(common.ParseChangelogMatching(tt.content, pattern), ""))
+		})
+	}
+}
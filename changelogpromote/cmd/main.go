@@ -0,0 +1,7 @@
+package main
+
+import "chameth.com/actions/changelogpromote"
+
+func main() {
+	changelogpromote.Command().Main()
+}
@@ -0,0 +1,40 @@
+package changelogpromote
+
+import "chameth.com/actions/common"
+
+func Command() *common.Command {
+	c := common.NewCommand("changelogpromote", "Move the Unreleased section of a changelog under a new version")
+	changelog := c.Path("changelog", "src/CHANGELOG.md", "Path to the changelog to update")
+	heading := c.HeadingPattern("changelog-heading", "keepachangelog", "Format of the changelog's version headings: keepachangelog, plain, version, or a regular expression capturing the version")
+	version := c.String("version", "", "Version to release (defaults to the version of the triggering tag; required to tag or push)")
+	date := c.String("date", "", "Release date in YYYY-MM-DD format (defaults to today)")
+	tagPrefix := c.String("tag-prefix", "v", "Prefix added to the version to form the tag name")
+	commit := c.Bool("commit", false, "Commit the updated changelog")
+	tag := c.Bool("tag", false, "Tag the commit with the version (implies commit)")
+	push := c.Bool("push", false, "Push the commit and tag to the origin remote (implies commit)")
+	userName := c.String("user-name", "", "Name to commit and tag as (defaults to the repository config, then a bot identity)")
+	userEmail := c.String("user-email", "", "Email to commit and tag as (defaults to the repository config, then a bot identity)")
+	token := c.Secret("token", "TOKEN", "Token to push with in place of the job token")
+
+	c.Output("version", "The version that was released")
+	c.Output("date", "The release date")
+	c.Output("tag", "The tag that was created, if any")
+	c.Output("sha", "The SHA of the commit that was created, if any")
+
+	c.Run = func(ctx *common.Context) error {
+		return Run(ctx, Options{
+			Changelog: changelog.Value(),
+			Heading:   heading.Value(),
+			Version:   version.Value(),
+			Date:      date.Value(),
+			TagPrefix: tagPrefix.Value(),
+			Commit:    commit.Value(),
+			Tag:       tag.Value(),
+			Push:      push.Value(),
+			UserName:  userName.Value(),
+			UserEmail: userEmail.Value(),
+			Token:     token.Value(),
+		})
+	}
+	return c
+}
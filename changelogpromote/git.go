@@ -0,0 +1,136 @@
+package changelogpromote
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"chameth.com/actions/common"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// commit commits the changelog in the repository containing it, optionally
+// tagging and pushing the result. It returns the SHA of the new commit.
+func commit(ctx *common.Context, opts Options, version, tag string) (string, error) {
+	repo, err := git.PlainOpenWithOptions(filepath.Dir(opts.Changelog), &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return "", fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return "", fmt.Errorf("failed to open worktree: %w", err)
+	}
+
+	path, err := filepath.Rel(worktree.Filesystem.Root(), opts.Changelog)
+	if err != nil {
+		return "", fmt.Errorf("failed to find changelog in repository: %w", err)
+	}
+	if _, err := worktree.Add(filepath.ToSlash(path)); err != nil {
+		return "", fmt.Errorf("failed to stage changelog: %w", err)
+	}
+
+	signature := identity(ctx, repo, opts)
+	hash, err := worktree.Commit("Release "+version, &git.CommitOptions{Author: signature, Committer: signature})
+	if err != nil {
+		return "", fmt.Errorf("failed to commit changelog: %w", err)
+	}
+	slog.Info("Committed changelog", "sha", hash.String())
+
+	if opts.Tag {
+		if _, err := repo.CreateTag(tag, hash, &git.CreateTagOptions{Tagger: signature, Message: "Release " + version}); err != nil {
+			return "", fmt.Errorf("failed to create tag %s: %w", tag, err)
+		}
+		slog.Info("Created tag", "tag", tag)
+	}
+
+	if opts.Push {
+		if err := push(ctx, repo, opts, hash, tag); err != nil {
+			return "", err
+		}
+	}
+	return hash.String(), nil
+}
+
+// identity returns the signature to commit and tag with. Names and emails
+// not given in the options are taken from the repository's config, if set
+// there, or otherwise default to the bot's identity.
+func identity(ctx *common.Context, repo *git.Repository, opts Options) *object.Signature {
+	name, email := opts.UserName, opts.UserEmail
+	if cfg, err := repo.Config(); err == nil {
+		name = cmp.Or(name, cfg.User.Name)
+		email = cmp.Or(email, cfg.User.Email)
+	}
+	signature := ctx.BotSignature(name, email)
+	signature.When = time.Now()
+	return &signature
+}
+
+// push sends the new commit to the branch it was made on, along with the tag
+// if one was created. If HEAD is detached, as it is after checking out a
+// commit, the branch that triggered the workflow is used.
+func push(ctx *common.Context, repo *git.Repository, opts Options, hash plumbing.Hash, tag string) error {
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("failed to read HEAD: %w", err)
+	}
+
+	branch := head.Name()
+	if !branch.IsBranch() {
+		if !strings.HasPrefix(ctx.Ref, "refs/heads/") {
+			return errors.New("unable to determine the branch to push: HEAD is detached and the workflow was not triggered by a branch")
+		}
+		branch = plumbing.ReferenceName(ctx.Ref)
+		if err := repo.Storer.SetReference(plumbing.NewHashReference(branch, hash)); err != nil {
+			return fmt.Errorf("failed to update %s: %w", branch, err)
+		}
+	}
+
+	refSpecs := []config.RefSpec{config.RefSpec(fmt.Sprintf("%s:%s", branch, branch))}
+	if opts.Tag {
+		ref := plumbing.NewTagReferenceName(tag)
+		refSpecs = append(refSpecs, config.RefSpec(fmt.Sprintf("%s:%s", ref, ref)))
+	}
+
+	auth, err := pushAuth(repo, cmp.Or(opts.Token, ctx.Token))
+	if err != nil {
+		return err
+	}
+
+	err = repo.Push(&git.PushOptions{RemoteName: git.DefaultRemoteName, RefSpecs: refSpecs, Auth: auth})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to push: %w", err)
+	}
+	slog.Info("Pushed release", "branch", branch.Short())
+	return nil
+}
+
+// pushAuth authenticates to the origin remote with the token, if it's
+// accessed over HTTP.
+func pushAuth(repo *git.Repository, token string) (transport.AuthMethod, error) {
+	remote, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find remote: %w", err)
+	}
+	if token == "" || len(remote.Config().URLs) == 0 {
+		return nil, nil
+	}
+
+	endpoint, err := transport.NewEndpoint(remote.Config().URLs[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote URL: %w", err)
+	}
+	if endpoint.Protocol != "http" && endpoint.Protocol != "https" {
+		return nil, nil
+	}
+	return &githttp.BasicAuth{Username: "x-access-token", Password: token}, nil
+}
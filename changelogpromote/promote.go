@@ -0,0 +1,116 @@
+package changelogpromote
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"chameth.com/actions/common"
+)
+
+type Options struct {
+	// Changelog is the path to the changelog to update.
+	Changelog string
+	// Heading matches the changelog's version headings. If nil, the Keep a
+	// Changelog format is expected.
+	Heading *regexp.Regexp
+	// Version is the version to release. If empty, the version of the tag
+	// that triggered the workflow is used, in which case Tag and Push can't
+	// be set.
+	Version string
+	// Date is the release date in YYYY-MM-DD format, defaulting to today.
+	Date string
+	// TagPrefix is added to the version to form the tag name, and removed
+	// from the triggering tag to find the version.
+	TagPrefix string
+	// Commit commits the updated changelog in the repository containing it.
+	Commit bool
+	// Tag tags the commit with the version, and implies Commit.
+	Tag bool
+	// Push pushes the commit and tag to the origin remote.
+	Push bool
+	// UserName and UserEmail identify the author of the commit and tag.
+	// They default to the repository's config, then a bot identity.
+	UserName  string
+	UserEmail string
+	// Token authenticates pushes in place of the job token.
+	Token string
+}
+
+func Run(ctx *common.Context, opts Options) error {
+	ctx.AddMask(opts.Token)
+
+	version := opts.Version
+	if version == "" {
+		// The triggering tag already exists, so it can't be created again,
+		// and it doesn't point to the commit this would create.
+		if opts.Tag || opts.Push {
+			return errors.New("a version must be given to tag or push, as the triggering tag already exists")
+		}
+		version = ctx.Tag()
+	}
+	version = strings.TrimPrefix(version, opts.TagPrefix)
+	if version == "" {
+		return errors.New("no version given, and the workflow was not triggered by a tag")
+	}
+
+	date := opts.Date
+	if date == "" {
+		date = time.Now().UTC().Format(time.DateOnly)
+	} else if _, err := time.Parse(time.DateOnly, date); err != nil {
+		return fmt.Errorf("invalid date %q: must be in YYYY-MM-DD format", date)
+	}
+	tag := opts.TagPrefix + version
+
+	changelog, err := common.ReadChangelogMatching(opts.Changelog, opts.Heading)
+	if err != nil {
+		return err
+	}
+
+	release, err := changelog.Promote(version, date, tag)
+	if err != nil {
+		return fmt.Errorf("failed to promote unreleased changes: %w", err)
+	}
+
+	info, err := os.Stat(opts.Changelog)
+	if err != nil {
+		return fmt.Errorf("failed to stat changelog: %w", err)
+	}
+	if err := os.WriteFile(opts.Changelog, []byte(changelog.String()), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write changelog: %w", err)
+	}
+
+	slog.Info("Promoted unreleased changes", "version", version, "date", date)
+
+	outputs := map[string]string{"version": version, "date": date, "tag": "", "sha": ""}
+	if opts.Commit || opts.Tag || opts.Push {
+		sha, err := commit(ctx, opts, version, tag)
+		if err != nil {
+			return err
+		}
+		outputs["sha"] = sha
+		if opts.Tag {
+			outputs["tag"] = tag
+		}
+	}
+
+	if err := ctx.WriteOutput(outputs); err != nil {
+		return err
+	}
+
+	s := ctx.NewSummary().
+		Heading(3, "Released "+version).
+		Paragraph(fmt.Sprintf("Moved the unreleased changes in %s under %s, dated %s.", common.Code(opts.Changelog), common.Code(version), date))
+	if outputs["sha"] != "" {
+		s.Table([]string{"Property", "Value"}, [][]string{
+			{"Commit", common.Code(outputs["sha"])},
+			{"Tag", common.Code(outputs["tag"])},
+			{"Pushed", fmt.Sprintf("%t", opts.Push)},
+		})
+	}
+	return s.Details("Changes", release.Body()).Write()
+}
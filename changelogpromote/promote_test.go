@@ -0,0 +1,309 @@
+package changelogpromote
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"chameth.com/actions/common"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testChangelog = `# Changelog
+
+## [Unreleased]
+
+### Added
+- Widgets
+
+## [1.0.0] - 2024-01-01
+
+Initial release.
+
+[Unreleased]: https://example.com/compare/v1.0.0...HEAD
+[1.0.0]: https://example.com/releases/tag/v1.0.0
+`
+
+const promotedChangelog = `# Changelog
+
+## [Unreleased]
+
+## [1.1.0] - 2024-02-01
+
+### Added
+- Widgets
+
+## [1.0.0] - 2024-01-01
+
+Initial release.
+
+[Unreleased]: https://example.com/compare/v1.1.0...HEAD
+[1.1.0]: https://example.com/compare/v1.0.0...v1.1.0
+[1.0.0]: https://example.com/releases/tag/v1.0.0
+`
+
+type fixture struct {
+	t         *testing.T
+	ctx       *common.Context
+	repo      *git.Repository
+	remote    *git.Repository
+	changelog string
+}
+
+// newFixture creates a repository containing a changelog, with a bare
+// repository as its origin.
+func newFixture(t *testing.T) *fixture {
+	workspace := t.TempDir()
+	dir := filepath.Join(workspace, "src")
+
+	remoteDir := t.TempDir()
+	remote, err := git.PlainInit(remoteDir, true)
+	require.NoError(t, err)
+
+	repo, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+	_, err = repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{remoteDir}})
+	require.NoError(t, err)
+
+	changelog := filepath.Join(dir, "CHANGELOG.md")
+	require.NoError(t, os.WriteFile(changelog, []byte(testChangelog), 0644))
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+	_, err = worktree.Add("CHANGELOG.md")
+	require.NoError(t, err)
+	_, err = worktree.Commit("Initial commit", &git.CommitOptions{
+		Author: &object.Signature{Name: "Dev", Email: "dev@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+
+	return &fixture{
+		t: t,
+		ctx: &common.Context{
+			Workspace:   workspace,
+			ServerURL:   "https://git.example.com",
+			Ref:         "refs/heads/master",
+			OutputFile:  filepath.Join(workspace, "output"),
+			SummaryFile: filepath.Join(workspace, "summary.md"),
+			Stdout:      io.Discard,
+		},
+		repo:      repo,
+		remote:    remote,
+		changelog: changelog,
+	}
+}
+
+func (f *fixture) outputs() map[string]string {
+	f.t.Helper()
+	outputs, err := common.ReadKeyValueFile(f.ctx.OutputFile)
+	require.NoError(f.t, err)
+	return outputs
+}
+
+func TestRun(t *testing.T) {
+	f := newFixture(t)
+
+	require.NoError(t, Run(f.ctx, Options{Changelog: f.changelog, Version: "1.1.0", Date: "2024-02-01", TagPrefix: "v"}))
+
+	content, err := os.ReadFile(f.changelog)
+	require.NoError(t, err)
+	assert.Equal(t, promotedChangelog, string(content))
+	assert.Equal(t, map[string]string{"version": "1.1.0", "date": "2024-02-01", "tag": "", "sha": ""}, f.outputs())
+
+	// Nothing is committed unless asked.
+	worktree, err := f.repo.Worktree()
+	require.NoError(t, err)
+	status, err := worktree.Status()
+	require.NoError(t, err)
+	assert.False(t, status.IsClean())
+
+	summary, err := os.ReadFile(f.ctx.SummaryFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(summary), "### Released 1.1.0")
+}
+
+func TestRun_VersionFromTag(t *testing.T) {
+	f := newFixture(t)
+	f.ctx.Ref = "refs/tags/v1.1.0"
+
+	require.NoError(t, Run(f.ctx, Options{Changelog: f.changelog, TagPrefix: "v"}))
+
+	today := time.Now().UTC().Format(time.DateOnly)
+	assert.Equal(t, map[string]string{"version": "1.1.0", "date": today, "tag": "", "sha": ""}, f.outputs())
+	content, err := os.ReadFile(f.changelog)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "## [1.1.0] - "+today+"\n")
+}
+
+func TestRun_HeadingPattern(t *testing.T) {
+	tests := []struct {
+		preset   string
+		content  string
+		expected string
+	}{
+		{
+			preset:   "keepachangelog",
+			content:  "## [Unreleased]\n\n- Widgets\n\n## [1.0.0] - 2024-01-01\n",
+			expected: "## [Unreleased]\n\n## 1.1.0 - 2024-02-01\n\n- Widgets\n\n## [1.0.0] - 2024-01-01\n",
+		},
+		{
+			preset:   "plain",
+			content:  "# Unreleased\n\n- Widgets\n\n# 1.0.0\n\nInitial release.\n",
+			expected: "# Unreleased\n\n# 1.1.0 - 2024-02-01\n\n- Widgets\n\n# 1.0.0\n\nInitial release.\n",
+		},
+		{
+			preset:   "version",
+			content:  "### Unreleased\n\n- Widgets\n\n### Version 1.0.0 (2024-01-01)\n",
+			expected: "### Unreleased\n\n### Version 1.1.0 (2024-02-01)\n\n- Widgets\n\n### Version 1.0.0 (2024-01-01)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.preset, func(t *testing.T) {
+			f := newFixture(t)
+			require.NoError(t, os.WriteFile(f.changelog, []byte(tt.content), 0644))
+			heading, err := common.ParseHeadingPattern(tt.preset)
+			require.NoError(t, err)
+
+			require.NoError(t, Run(f.ctx, Options{
+				Changelog: f.changelog,
+				Heading:   heading,
+				Version:   "1.1.0",
+				Date:      "2024-02-01",
+				TagPrefix: "v",
+			}))
+
+			content, err := os.ReadFile(f.changelog)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(content))
+
+			promoted := common.ParseChangelogMatching(string(content), heading).Release("1.1.0")
+			require.NotNil(t, promoted)
+			assert.Equal(t, "2024-02-01", promoted.Date)
+		})
+	}
+}
+
+func TestRun_CommitTagAndPush(t *testing.T) {
+	f := newFixture(t)
+
+	require.NoError(t, Run(f.ctx, Options{
+		Changelog: f.changelog,
+		Version:   "1.1.0",
+		Date:      "2024-02-01",
+		TagPrefix: "v",
+		Tag:       true,
+		Push:      true,
+	}))
+
+	outputs := f.outputs()
+	assert.Equal(t, "v1.1.0", outputs["tag"])
+
+	head, err := f.repo.Head()
+	require.NoError(t, err)
+	assert.Equal(t, head.Hash().String(), outputs["sha"])
+
+	commit, err := f.repo.CommitObject(head.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, "Release 1.1.0", commit.Message)
+	assert.Equal(t, "actions[bot]", commit.Author.Name)
+	assert.Equal(t, "actionsbot@noreply.git.example.com", commit.Author.Email)
+
+	file, err := commit.File("CHANGELOG.md")
+	require.NoError(t, err)
+	content, err := file.Contents()
+	require.NoError(t, err)
+	assert.Equal(t, promotedChangelog, content)
+
+	tag, err := f.repo.Tag("v1.1.0")
+	require.NoError(t, err)
+	tagObject, err := f.repo.TagObject(tag.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, head.Hash(), tagObject.Target)
+
+	remoteBranch, err := f.remote.Reference(plumbing.NewBranchReferenceName("master"), true)
+	require.NoError(t, err)
+	assert.Equal(t, head.Hash(), remoteBranch.Hash())
+	remoteTag, err := f.remote.Reference(plumbing.NewTagReferenceName("v1.1.0"), true)
+	require.NoError(t, err)
+	assert.Equal(t, tag.Hash(), remoteTag.Hash())
+}
+
+func TestRun_PushDetached(t *testing.T) {
+	f := newFixture(t)
+	head, err := f.repo.Head()
+	require.NoError(t, err)
+	worktree, err := f.repo.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, worktree.Checkout(&git.CheckoutOptions{Hash: head.Hash()}))
+	f.ctx.Ref = "refs/heads/release"
+
+	require.NoError(t, Run(f.ctx, Options{
+		Changelog: f.changelog,
+		Version:   "1.1.0",
+		Date:      "2024-02-01",
+		UserName:  "Release Bot",
+		Push:      true,
+	}))
+
+	remoteBranch, err := f.remote.Reference(plumbing.NewBranchReferenceName("release"), true)
+	require.NoError(t, err)
+	assert.Equal(t, f.outputs()["sha"], remoteBranch.Hash().String())
+
+	commit, err := f.repo.CommitObject(remoteBranch.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, "Release Bot", commit.Author.Name)
+	assert.Equal(t, "release-bot@noreply.git.example.com", commit.Author.Email)
+}
+
+func TestRun_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		err  string
+	}{
+		{
+			name: "no version",
+			opts: Options{TagPrefix: "v"},
+			err:  "no version given, and the workflow was not triggered by a tag",
+		},
+		{
+			name: "tag with version from tag",
+			opts: Options{TagPrefix: "v", Tag: true},
+			err:  "a version must be given to tag or push, as the triggering tag already exists",
+		},
+		{
+			name: "push with version from tag",
+			opts: Options{TagPrefix: "v", Commit: true, Push: true},
+			err:  "a version must be given to tag or push, as the triggering tag already exists",
+		},
+		{
+			name: "invalid date",
+			opts: Options{Version: "1.1.0", Date: "01/02/2024"},
+			err:  `invalid date "01/02/2024": must be in YYYY-MM-DD format`,
+		},
+		{
+			name: "existing version",
+			opts: Options{Version: "1.0.0", TagPrefix: "v"},
+			err:  "failed to promote unreleased changes: changelog already has a section for 1.0.0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			tt.opts.Changelog = f.changelog
+			assert.EqualError(t, Run(f.ctx, tt.opts), tt.err)
+
+			content, err := os.ReadFile(f.changelog)
+			require.NoError(t, err)
+			assert.Equal(t, testChangelog, string(content))
+		})
+	}
+}
@@ -1,46 +1,486 @@
 package checkout
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
-	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
 
 	"chameth.com/actions/common"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
 )
 
-func Run(ctx *common.Context, path string, fetchTags bool) error {
-	targetDir := ctx.ResolvePath(path)
-	slog.Info("Checking out repository", "repo", ctx.Repository, "sha", ctx.SHA, "target_dir", targetDir)
+// unshallowDepth is the depth git uses to request the full history of a
+// shallow repository.
+const unshallowDepth = 0x7fffffff
+
+type Options struct {
+	// Repository is the owner/name of the repository to check out, on the
+	// same server as the workflow. Empty uses the triggering repository.
+	Repository string
+	// Ref is the branch, tag or commit SHA to check out. Empty uses the
+	// triggering commit, or the default branch if Repository is set.
+	Ref string
+	// Token authenticates to the server in place of the job token.
+	Token string
+	// Merge controls how pull requests are checked out: "local" merges the
+	// head into the base branch, "forge" uses the forge's merge ref, and
+	// empty or "false" checks out the head. Ignored if Repository or Ref are
+	// set, or the workflow was not triggered by a pull request.
+	Merge string
+	// Path is the directory to check out into, relative to the workspace.
+	Path string
+	// FetchTags fetches every tag from the remote, rather than just those
+	// pointing into the fetched history. For shallow clones, history is
+	// deepened until a tag is reachable from the checked out commit.
+	FetchTags bool
+	// Depth limits the fetched history to the given number of commits. Zero
+	// fetches the full history.
+	Depth int
+	// Filter is the partial clone mode: "blobless", "treeless" or empty.
+	Filter string
+	// Submodules controls submodule checkout: "false" to skip them, "true"
+	// for top-level submodules only, or "recursive".
+	Submodules string
+	// LFS replaces Git LFS pointer files with the objects they refer to.
+	LFS bool
+	// CredentialHosts lists hosts other than the forge that the job token
+	// may be sent to when fetching submodules and LFS objects.
+	CredentialHosts []string
+	// Sparse restricts the worktree to the given directories (in cone mode)
+	// or gitignore-style patterns. Empty materialises everything.
+	Sparse []string
+	// SparseCone interprets Sparse as a list of directories.
+	SparseCone bool
+	// Clean controls what is removed when reusing an existing repository:
+	// "true" (or empty) removes untracked files, "all" also removes ignored
+	// files, and "false" leaves them in place.
+	Clean string
+	// Reclone removes an existing repository that cannot be read and checks
+	// out from scratch, rather than failing.
+	Reclone bool
+	// PersistCredentials stores the token in the repository's local config,
+	// scoped to the forge, so that later steps can push. Post removes it when
+	// the job ends, or Cleanup can be used to remove it sooner.
+	PersistCredentials bool
+	// UserName and UserEmail are configured as the identity for commits made
+	// in the repository. They default to a bot identity on the forge.
+	UserName  string
+	UserEmail string
+}
+
+func Run(ctx *common.Context, opts Options) error {
+	if opts.Depth < 0 {
+		return fmt.Errorf("fetch depth must not be negative")
+	}
+
+	filter, err := parseFilter(opts.Filter)
+	if err != nil {
+		return err
+	}
+
+	submodules, recursive, err := parseSubmodules(opts.Submodules)
+	if err != nil {
+		return err
+	}
+
+	sparse, err := newSparseCheckout(opts.Sparse, opts.SparseCone)
+	if err != nil {
+		return err
+	}
+
+	cleanMode, err := parseClean(opts.Clean)
+	if err != nil {
+		return err
+	}
+
+	merge, err := parseMerge(opts.Merge)
+	if err != nil {
+		return err
+	}
+	if opts.Repository != "" || opts.Ref != "" || ctx.PullRequest == 0 {
+		merge = ""
+	}
+
+	source := *ctx
+	if opts.Repository != "" {
+		source.Repository = opts.Repository
+	}
+	if opts.Repository != "" || merge != "" {
+		source.HeadRepository = ""
+	}
+	if opts.Token != "" {
+		source.Token = opts.Token
+		ctx.AddMask(source.Token)
+		ctx.AddMask(source.BasicAuth())
+	}
+
+	targetDir := ctx.ResolvePath(opts.Path)
+	slog.Info("Checking out repository", "repo", source.Repository, "ref", opts.Ref, "target_dir", targetDir, "depth", opts.Depth, "filter", filter)
 
 	if err := os.MkdirAll(targetDir, 0755); err != nil {
 		return fmt.Errorf("failed to create workspace: %w", err)
 	}
 
-	if err := os.Chdir(targetDir); err != nil {
-		return fmt.Errorf("failed to change to workspace: %w", err)
+	repo, reused, err := openRepository(targetDir, source.RepoUrl(), opts.Reclone)
+	if err != nil {
+		return err
+	}
+
+	if filter != "" {
+		if err := configurePromisor(repo, git.DefaultRemoteName, filter); err != nil {
+			return err
+		}
+	}
+
+	signature := ctx.BotSignature(opts.UserName, opts.UserEmail)
+	creds := newCredentials(&source, opts.CredentialHosts)
+	remote, err := openRemote(source.RepoUrl(), creds)
+	if err != nil {
+		return err
+	}
+
+	var sha plumbing.Hash
+	if merge != "" {
+		sha, err = pullRequestBase(ctx, remote, merge)
+	} else {
+		ref := opts.Ref
+		if ref == "" && opts.Repository == "" {
+			ref = ctx.SHA
+		}
+		sha, err = remote.resolve(ref)
+	}
+	if err != nil {
+		return err
+	}
+	slog.Debug("Resolved commit", "ref", opts.Ref, "merge", merge, "sha", sha)
+
+	if err := fetchHistory(repo, remote, sha, opts, filter); err != nil {
+		return err
+	}
+
+	depth := opts.Depth
+	if opts.FetchTags && depth > 0 {
+		depth, err = deepenToTag(repo, remote, sha, depth, filter)
+		if err != nil {
+			return err
+		}
+	}
+
+	if merge == "local" {
+		head := source
+		head.HeadRepository = ctx.HeadRepository
+		headRemote, headSha, err := pullRequestHead(&head, remote, creds)
+		if err != nil {
+			return err
+		}
+
+		message := fmt.Sprintf("Merge %s into %s", headSha, ctx.BaseRef)
+		sha, err = mergePullRequest(repo, remote, headRemote, sha, headSha, opts.Depth, filter, sparse.includes, signature, message)
+		if err != nil {
+			return err
+		}
+	}
+
+	var preserved *preservedFiles
+	if reused {
+		if preserved, err = preserveUntracked(repo, cleanMode); err != nil {
+			return err
+		}
+	}
+
+	materialised, err := materialise(repo, remote, sha, filter, sparse)
+	if err := errors.Join(err, preserved.restore()); err != nil {
+		return err
+	}
+
+	if submodules {
+		if err := updateSubmodules(repo, creds, opts.Depth, filter, recursive, opts.LFS); err != nil {
+			return err
+		}
+	}
+
+	if opts.LFS {
+		if err := fetchLFS(repo, source.RepoUrl(), creds); err != nil {
+			return err
+		}
+	}
+
+	if err := configureRepository(repo, &source, signature, opts.PersistCredentials); err != nil {
+		return err
+	}
+
+	if opts.PersistCredentials {
+		if err := ctx.SaveState(credentialsState, opts.Path); err != nil {
+			return err
+		}
+	}
+
+	shallows, err := repo.Storer.Shallow()
+	if err != nil {
+		return fmt.Errorf("failed to read shallow commits: %w", err)
+	}
+	if len(shallows) == 0 {
+		depth = 0
+	}
+
+	outputs := map[string]string{
+		"path":   opts.Path,
+		"sha":    sha.String(),
+		"depth":  strconv.Itoa(depth),
+		"filter": string(filter),
+	}
+	if sparse != nil {
+		slog.Info("Sparse checkout populated", "files", len(materialised))
+		outputs["sparse-paths"] = strings.Join(materialised, ",")
+	}
+
+	slog.Info("Repository checked out successfully", "path", opts.Path, "sha", sha, "depth", depth, "filter", filter)
+	if err := ctx.WriteOutput(outputs); err != nil {
+		return err
+	}
+
+	history := "full"
+	if depth > 0 {
+		history = fmt.Sprintf("%d commit(s)", depth)
+	}
+	rows := [][]string{
+		{"Repository", strings.TrimSuffix(source.RepoUrl(), ".git")},
+		{"Commit", common.Code(sha.String())},
+		{"Path", common.Code(opts.Path)},
+		{"History", history},
+	}
+	if filter != "" {
+		rows = append(rows, []string{"Filter", common.Code(string(filter))})
+	}
+	if sparse != nil {
+		rows = append(rows, []string{"Sparse files", strconv.Itoa(len(materialised))})
+	}
+	return ctx.NewSummary().
+		Heading(3, "Checked out "+cmp.Or(source.HeadRepository, source.Repository)).
+		Table([]string{"Property", "Value"}, rows).
+		Write()
+}
+
+// materialise populates the worktree with the given commit, first fetching
+// any objects omitted by a partial clone filter. For sparse checkouts, it
+// returns the paths that were populated.
+func materialise(repo *git.Repository, remote *remote, sha plumbing.Hash, filter packp.Filter, sparse *sparseCheckout) ([]string, error) {
+	if filter != "" {
+		if err := hydrate(repo, remote, sha, sparse.includes); err != nil {
+			return nil, err
+		}
+		if err := markPromisorPacks(repo); err != nil {
+			return nil, err
+		}
+	}
+
+	slog.Debug("Checking out SHA", "sha", sha, "sparse", sparse != nil)
+	if sparse != nil {
+		return sparse.apply(repo, sha)
+	}
+
+	if err := disableSparse(repo); err != nil {
+		return nil, err
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open worktree: %w", err)
+	}
+
+	if err := worktree.Checkout(&git.CheckoutOptions{Hash: sha, Force: true}); err != nil {
+		return nil, fmt.Errorf("git checkout failed: %w", err)
+	}
+	return nil, nil
+}
+
+// fetchHistory fetches the commit to be checked out, along with branches and
+// tags from the remote, and records them as local references.
+func fetchHistory(repo *git.Repository, remote *remote, sha plumbing.Hash, opts Options, filter packp.Filter) error {
+	heads := remote.matching("refs/heads/")
+	tags := remote.matching("refs/tags/")
+
+	var wants []plumbing.Hash
+	if opts.Depth == 0 {
+		for _, hash := range heads {
+			wants = append(wants, hash)
+		}
+	}
+
+	if !slices.Contains(wants, sha) {
+		if remote.canWant(sha) {
+			wants = append(wants, sha)
+		} else if opts.Depth > 0 {
+			return fmt.Errorf("remote does not allow fetching commit %s directly, so a shallow fetch is not possible", sha)
+		}
+	}
+
+	if opts.FetchTags {
+		for _, hash := range tags {
+			wants = append(wants, hash)
+		}
+	}
+
+	depth := opts.Depth
+	if depth == 0 {
+		shallows, err := repo.Storer.Shallow()
+		if err != nil {
+			return fmt.Errorf("failed to read shallow commits: %w", err)
+		}
+		if len(shallows) > 0 {
+			slog.Debug("Fetching full history for a shallow repository")
+			depth = unshallowDepth
+		}
+	}
+
+	slog.Debug("Fetching repository", "fetch_tags", opts.FetchTags)
+	if err := remote.fetch(repo, fetchRequest{
+		wants:       wants,
+		depth:       depth,
+		filter:      filter,
+		includeTags: !opts.FetchTags,
+	}); err != nil {
+		return fmt.Errorf("git fetch failed: %w", err)
+	}
+
+	if !hasObject(repo, sha) {
+		return fmt.Errorf("commit %s not found in remote", sha)
+	}
+
+	if err := pruneRemoteBranches(repo, heads); err != nil {
+		return err
 	}
 
-	slog.Debug("Cloning repository", "url", ctx.RepoUrl())
-	cmd := exec.Command("git", "-c", fmt.Sprintf("http.extraHeader=Authorization: basic %s", ctx.BasicAuth()), "clone", ctx.RepoUrl(), ".")
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("git clone failed: %w\n%s", err, output)
+	for name, hash := range heads {
+		if !hasObject(repo, hash) {
+			continue
+		}
+		local := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, name.Short())
+		if err := repo.Storer.SetReference(plumbing.NewHashReference(local, hash)); err != nil {
+			return fmt.Errorf("failed to update %s: %w", local, err)
+		}
 	}
 
-	slog.Debug("Checking out SHA", "sha", ctx.SHA)
-	cmd = exec.Command("git", "checkout", ctx.SHA)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("git checkout failed: %w\n%s", err, output)
+	for name, hash := range tags {
+		if !hasObject(repo, hash) {
+			continue
+		}
+		if err := repo.Storer.SetReference(plumbing.NewHashReference(name, hash)); err != nil {
+			return fmt.Errorf("failed to update %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// pruneRemoteBranches removes remote-tracking branches that the remote no
+// longer advertises, left behind when reusing an existing repository.
+func pruneRemoteBranches(repo *git.Repository, heads map[plumbing.ReferenceName]plumbing.Hash) error {
+	iter, err := repo.References()
+	if err != nil {
+		return fmt.Errorf("failed to list references: %w", err)
+	}
+	defer iter.Close()
+
+	prefix := fmt.Sprintf("refs/remotes/%s/", git.DefaultRemoteName)
+	var stale []plumbing.ReferenceName
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		branch, ok := strings.CutPrefix(ref.Name().String(), prefix)
+		if ok && ref.Type() == plumbing.HashReference {
+			if _, exists := heads[plumbing.NewBranchReferenceName(branch)]; !exists {
+				stale = append(stale, ref.Name())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, name := range stale {
+		slog.Debug("Pruning stale branch", "ref", name)
+		if err := repo.Storer.RemoveReference(name); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// deepenToTag repeatedly doubles the depth of a shallow history until a tag is
+// reachable from the given commit, or the remote has no more history to send.
+// It returns the resulting depth.
+func deepenToTag(repo *git.Repository, remote *remote, sha plumbing.Hash, depth int, filter packp.Filter) (int, error) {
+	tagged, err := common.TaggedCommits(repo)
+	if err != nil {
+		return 0, err
 	}
+	if len(tagged) == 0 {
+		return depth, nil
+	}
+
+	for {
+		shallows, err := repo.Storer.Shallow()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read shallow commits: %w", err)
+		}
 
-	if fetchTags {
-		slog.Debug("Fetching tags")
-		cmd = exec.Command("git", "-c", fmt.Sprintf("http.extraHeader=Authorization: basic %s", ctx.BasicAuth()), "fetch", "--tags")
-		if output, err := cmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("git fetch --tags failed: %w\n%s", err, output)
+		found, err := reachesAny(repo, sha, tagged, shallows)
+		if err != nil {
+			return 0, err
+		}
+		if found || len(shallows) == 0 {
+			return depth, nil
+		}
+
+		depth *= 2
+		slog.Debug("Deepening history to reach a tag", "depth", depth)
+		if err := remote.fetch(repo, fetchRequest{wants: []plumbing.Hash{sha}, depth: depth, filter: filter}); err != nil {
+			return 0, fmt.Errorf("failed to deepen history: %w", err)
+		}
+
+		after, err := repo.Storer.Shallow()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read shallow commits: %w", err)
+		}
+		if slices.Equal(shallows, after) {
+			return depth, nil
 		}
 	}
+}
+
+// reachesAny walks the local history of the given commit, stopping at shallow
+// boundaries, and reports whether any of the targets were encountered.
+func reachesAny(repo *git.Repository, from plumbing.Hash, targets map[plumbing.Hash]bool, shallows []plumbing.Hash) (bool, error) {
+	seen := make(map[plumbing.Hash]bool)
+	queue := []plumbing.Hash{from}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+
+		if targets[hash] {
+			return true, nil
+		}
+		if slices.Contains(shallows, hash) {
+			continue
+		}
 
-	slog.Info("Repository checked out successfully", "path", path)
-	return ctx.WriteOutput(map[string]string{"path": path})
+		commit, err := object.GetCommit(repo.Storer, hash)
+		if err != nil {
+			return false, fmt.Errorf("failed to read commit %s: %w", hash, err)
+		}
+		queue = append(queue, commit.ParentHashes...)
+	}
+	return false, nil
 }
@@ -0,0 +1,998 @@
+package checkout
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"chameth.com/actions/common"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testToken = "s3cret"
+
+// fixture serves a bare repository over smart HTTP using git http-backend,
+// populated from a scratch working copy.
+type fixture struct {
+	t      *testing.T
+	root   string
+	name   string
+	work   string
+	server *httptest.Server
+	lfs    map[string][]byte
+	// flaky is the number of upload-pack requests still to fail with 502.
+	flaky *atomic.Int32
+}
+
+func newFixture(t *testing.T) *fixture {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git binary not available")
+	}
+
+	f := &fixture{
+		t:     t,
+		root:  t.TempDir(),
+		name:  "owner/repo",
+		work:  t.TempDir(),
+		lfs:   make(map[string][]byte),
+		flaky: &atomic.Int32{},
+	}
+	f.init()
+
+	backend := &cgi.Handler{
+		Path: gitPath,
+		Args: []string{"http-backend"},
+		Env: []string{
+			"GIT_PROJECT_ROOT=" + f.root,
+			"GIT_HTTP_EXPORT_ALL=1",
+		},
+	}
+
+	expected := (&common.Context{Token: testToken}).BasicAuth()
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if oid, ok := strings.CutPrefix(r.URL.Path, "/lfs/"); ok {
+			f.serveLFSObject(w, oid)
+			return
+		}
+		if r.Header.Get("Authorization") != "Basic "+expected {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			http.Error(w, "unauthorised", http.StatusUnauthorized)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/git-upload-pack") && f.flaky.Add(-1) >= 0 {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/info/lfs/objects/batch") {
+			f.serveLFSBatch(w, r)
+			return
+		}
+		backend.ServeHTTP(w, r)
+	}))
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+// sibling creates another repository served by the same fixture.
+func (f *fixture) sibling(name string) *fixture {
+	s := *f
+	s.name = name
+	s.work = f.t.TempDir()
+	s.init()
+	return &s
+}
+
+func (f *fixture) init() {
+	bare := filepath.Join(f.root, f.name+".git")
+	f.git(f.work, "init", "--initial-branch=main")
+	f.git(f.root, "init", "--bare", "--initial-branch=main", bare)
+	f.git(bare, "config", "uploadpack.allowFilter", "true")
+	f.git(bare, "config", "uploadpack.allowAnySHA1InWant", "true")
+}
+
+func (f *fixture) serveLFSBatch(w http.ResponseWriter, r *http.Request) {
+	var req lfsBatchRequest
+	require.NoError(f.t, json.NewDecoder(r.Body).Decode(&req))
+
+	type action struct {
+		Href string `json:"href"`
+	}
+	type object struct {
+		lfsObject
+		Actions map[string]action `json:"actions"`
+	}
+
+	var objects []object
+	for _, o := range req.Objects {
+		objects = append(objects, object{
+			lfsObject: o,
+			Actions:   map[string]action{"download": {Href: f.server.URL + "/lfs/" + o.OID}},
+		})
+	}
+
+	w.Header().Set("Content-Type", lfsMediaType)
+	require.NoError(f.t, json.NewEncoder(w).Encode(map[string]any{"objects": objects}))
+}
+
+func (f *fixture) serveLFSObject(w http.ResponseWriter, oid string) {
+	content, ok := f.lfs[oid]
+	if !ok {
+		http.NotFound(w, nil)
+		return
+	}
+	_, _ = w.Write(content)
+}
+
+// lfsPointer stores content on the fixture's LFS server, and returns a pointer
+// file referring to it.
+func (f *fixture) lfsPointer(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	oid := hex.EncodeToString(sum[:])
+	f.lfs[oid] = []byte(content)
+	return fmt.Sprintf("%s\noid sha256:%s\nsize %d\n", lfsPointerVersion, oid, len(content))
+}
+
+func (f *fixture) git(dir string, args ...string) string {
+	f.t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Test",
+		"GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test",
+		"GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=protocol.file.allow",
+		"GIT_CONFIG_VALUE_0=always",
+		"HOME="+f.root,
+	)
+	output, err := cmd.CombinedOutput()
+	require.NoError(f.t, err, "git %s: %s", strings.Join(args, " "), output)
+	return strings.TrimSpace(string(output))
+}
+
+// commit writes the given files into the working copy and commits them,
+// returning the new commit's SHA.
+func (f *fixture) commit(message string, files map[string]string) string {
+	f.t.Helper()
+	for name, content := range files {
+		path := filepath.Join(f.work, name)
+		require.NoError(f.t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(f.t, os.WriteFile(path, []byte(content), 0644))
+	}
+	f.git(f.work, "add", "-A")
+	f.git(f.work, "commit", "-q", "-m", message)
+	return f.git(f.work, "rev-parse", "HEAD")
+}
+
+// push mirrors all branches and tags from the working copy to the served
+// repository.
+func (f *fixture) push() {
+	f.t.Helper()
+	f.git(f.work, "push", "-q", "--prune", filepath.Join(f.root, f.name+".git"), "+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*")
+}
+
+func (f *fixture) context(sha string) *common.Context {
+	workspace := f.t.TempDir()
+	return &common.Context{
+		Workspace:  workspace,
+		Token:      testToken,
+		ServerURL:  f.server.URL,
+		Repository: f.name,
+		Ref:        "refs/heads/main",
+		SHA:        sha,
+		OutputFile: filepath.Join(workspace, "output"),
+		StateFile:  filepath.Join(workspace, "state"),
+	}
+}
+
+func outputs(t *testing.T, ctx *common.Context) map[string]string {
+	content, err := os.ReadFile(ctx.OutputFile)
+	require.NoError(t, err)
+
+	res := make(map[string]string)
+	for line := range strings.Lines(string(content)) {
+		k, v, _ := strings.Cut(strings.TrimSuffix(line, "\n"), "=")
+		res[k] = v
+	}
+	return res
+}
+
+func TestRun(t *testing.T) {
+	f := newFixture(t)
+	first := f.commit("first", map[string]string{"README.md": "one\n"})
+	f.commit("second", map[string]string{"README.md": "two\n", "sub/file.txt": "nested\n"})
+	f.push()
+
+	ctx := f.context(first)
+	require.NoError(t, Run(ctx, Options{Path: "src"}))
+
+	content, err := os.ReadFile(filepath.Join(ctx.Workspace, "src", "README.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "one\n", string(content))
+	assert.NoFileExists(t, filepath.Join(ctx.Workspace, "src", "sub", "file.txt"))
+
+	repo, err := git.PlainOpen(filepath.Join(ctx.Workspace, "src"))
+	require.NoError(t, err)
+	head, err := repo.Head()
+	require.NoError(t, err)
+	assert.Equal(t, first, head.Hash().String())
+
+	assert.Equal(t, map[string]string{"path": "src", "sha": first, "depth": "0", "filter": ""}, outputs(t, ctx))
+}
+
+func TestRun_RetriesFetch(t *testing.T) {
+	f := newFixture(t)
+	sha := f.commit("first", map[string]string{"README.md": "one\n"})
+	f.push()
+	f.flaky.Store(1)
+
+	ctx := f.context(sha)
+	require.NoError(t, Run(ctx, Options{Path: "src"}))
+
+	content, err := os.ReadFile(filepath.Join(ctx.Workspace, "src", "README.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "one\n", string(content))
+	assert.Negative(t, f.flaky.Load())
+}
+
+func TestRun_FetchTags(t *testing.T) {
+	f := newFixture(t)
+	sha := f.commit("first", map[string]string{"README.md": "one\n"})
+	f.git(f.work, "tag", "v1.0.0")
+	f.git(f.work, "checkout", "-q", "--orphan", "other")
+	f.commit("unrelated", map[string]string{"other.txt": "other\n"})
+	f.git(f.work, "tag", "v0.1.0")
+	f.git(f.work, "checkout", "-q", "main")
+	f.git(f.work, "branch", "-D", "other")
+	f.push()
+
+	tests := []struct {
+		name      string
+		fetchTags bool
+		expected  []string
+	}{
+		{
+			name:      "reachable tags only",
+			fetchTags: false,
+			expected:  []string{"v1.0.0"},
+		},
+		{
+			name:      "all tags",
+			fetchTags: true,
+			expected:  []string{"v0.1.0", "v1.0.0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := f.context(sha)
+			require.NoError(t, Run(ctx, Options{Path: "src", FetchTags: tt.fetchTags}))
+
+			repo, err := git.PlainOpen(filepath.Join(ctx.Workspace, "src"))
+			require.NoError(t, err)
+			iter, err := repo.Tags()
+			require.NoError(t, err)
+
+			var tags []string
+			for ref, err := iter.Next(); err == nil; ref, err = iter.Next() {
+				tags = append(tags, ref.Name().Short())
+			}
+			assert.ElementsMatch(t, tt.expected, tags)
+		})
+	}
+}
+
+func TestRun_BadToken(t *testing.T) {
+	f := newFixture(t)
+	sha := f.commit("first", map[string]string{"README.md": "one\n"})
+	f.push()
+
+	ctx := f.context(sha)
+	ctx.Token = "wrong"
+	assert.Error(t, Run(ctx, Options{Path: "src"}))
+}
+
+func TestRun_OtherRepository(t *testing.T) {
+	f := newFixture(t)
+	triggering := f.commit("first", map[string]string{"README.md": "main\n"})
+	f.push()
+
+	other := f.sibling("owner/other")
+	initial := other.commit("first", map[string]string{"config.txt": "one\n"})
+	other.git(other.work, "tag", "-a", "-m", "Release", "v1.0.0")
+	other.git(other.work, "checkout", "-q", "-b", "feature")
+	feature := other.commit("feature", map[string]string{"config.txt": "feature\n"})
+	other.git(other.work, "checkout", "-q", "main")
+	head := other.commit("second", map[string]string{"config.txt": "two\n"})
+	other.push()
+
+	tests := []struct {
+		name     string
+		ref      string
+		expected string
+	}{
+		{name: "default branch", ref: "", expected: head},
+		{name: "branch", ref: "feature", expected: feature},
+		{name: "annotated tag", ref: "v1.0.0", expected: initial},
+		{name: "full reference", ref: "refs/heads/feature", expected: feature},
+		{name: "sha", ref: initial, expected: initial},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := f.context(triggering)
+			ctx.Token = "job-token"
+			require.NoError(t, Run(ctx, Options{Path: "other", Repository: "owner/other", Ref: tt.ref, Token: testToken}))
+
+			repo, err := git.PlainOpen(filepath.Join(ctx.Workspace, "other"))
+			require.NoError(t, err)
+			h, err := repo.Head()
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, h.Hash().String())
+			assert.Equal(t, tt.expected, outputs(t, ctx)["sha"])
+		})
+	}
+}
+
+func TestRun_UnknownRef(t *testing.T) {
+	f := newFixture(t)
+	sha := f.commit("first", map[string]string{"README.md": "one\n"})
+	f.push()
+
+	err := Run(f.context(sha), Options{Path: "src", Ref: "missing"})
+	assert.ErrorContains(t, err, `reference "missing" not found`)
+}
+
+// pullRequest creates a repository where main and a feature branch have both
+// changed since they diverged, returning the tips of each. The feature branch
+// edits the given line of a shared file.
+func (f *fixture) pullRequest(featureLine string) (base, head string) {
+	f.t.Helper()
+	f.commit("first", map[string]string{"shared.txt": "one\ntwo\nthree\nfour\nfive\n"})
+	f.git(f.work, "checkout", "-q", "-b", "feature")
+	head = f.commit("feature", map[string]string{"shared.txt": featureLine + "\ntwo\nthree\nfour\nfive\n", "feature.txt": "feature\n"})
+	f.git(f.work, "checkout", "-q", "main")
+	f.commit("padding", map[string]string{"padding.txt": "padding\n"})
+	base = f.commit("base", map[string]string{"shared.txt": "one\ntwo\nthree\nfour\nFIVE\n"})
+	f.push()
+	return base, head
+}
+
+func (f *fixture) pullRequestContext(head string) *common.Context {
+	ctx := f.context(head)
+	ctx.Ref = "refs/pull/1/head"
+	ctx.BaseRef = "main"
+	ctx.HeadRef = "feature"
+	ctx.HeadSHA = head
+	ctx.PullRequest = 1
+	return ctx
+}
+
+func TestRun_MergeLocal(t *testing.T) {
+	tests := []struct {
+		name  string
+		depth int
+		fork  bool
+	}{
+		{name: "pull ref"},
+		{name: "pull ref shallow", depth: 1},
+		{name: "fork", fork: true},
+		{name: "fork shallow", depth: 1, fork: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			base, head := f.pullRequest("ONE")
+			ctx := f.pullRequestContext(head)
+
+			if tt.fork {
+				fork := f.sibling("contributor/repo")
+				fork.git(fork.work, "fetch", "-q", f.work, "feature")
+				fork.git(fork.work, "reset", "-q", "--hard", "FETCH_HEAD")
+				fork.push()
+				ctx.HeadRepository = fork.name
+			} else {
+				f.git(f.work, "push", "-q", filepath.Join(f.root, f.name+".git"), head+":refs/pull/1/head")
+			}
+
+			require.NoError(t, Run(ctx, Options{Path: "src", Merge: "local", Depth: tt.depth}))
+
+			dir := filepath.Join(ctx.Workspace, "src")
+			content, err := os.ReadFile(filepath.Join(dir, "shared.txt"))
+			require.NoError(t, err)
+			assert.Equal(t, "ONE\ntwo\nthree\nfour\nFIVE\n", string(content))
+			assert.FileExists(t, filepath.Join(dir, "feature.txt"))
+			assert.FileExists(t, filepath.Join(dir, "padding.txt"))
+
+			repo, err := git.PlainOpen(dir)
+			require.NoError(t, err)
+			ref, err := repo.Head()
+			require.NoError(t, err)
+			commit, err := repo.CommitObject(ref.Hash())
+			require.NoError(t, err)
+			assert.Equal(t, []plumbing.Hash{plumbing.NewHash(base), plumbing.NewHash(head)}, commit.ParentHashes)
+			assert.Equal(t, ref.Hash().String(), outputs(t, ctx)["sha"])
+
+			assert.Empty(t, f.git(dir, "status", "--porcelain"))
+		})
+	}
+}
+
+func TestRun_MergeConflict(t *testing.T) {
+	f := newFixture(t)
+	f.commit("first", map[string]string{"shared.txt": "one\ntwo\n"})
+	f.git(f.work, "checkout", "-q", "-b", "feature")
+	head := f.commit("feature", map[string]string{"shared.txt": "one\nfeature\n"})
+	f.git(f.work, "checkout", "-q", "main")
+	f.commit("base", map[string]string{"shared.txt": "one\nbase\n"})
+	f.push()
+	f.git(f.work, "push", "-q", filepath.Join(f.root, f.name+".git"), head+":refs/pull/1/head")
+
+	err := Run(f.pullRequestContext(head), Options{Path: "src", Merge: "local"})
+	assert.ErrorContains(t, err, "merge conflicts in 1 file(s): shared.txt")
+}
+
+func TestRun_MergeForge(t *testing.T) {
+	f := newFixture(t)
+	_, head := f.pullRequest("ONE")
+	ctx := f.pullRequestContext(head)
+
+	err := Run(ctx, Options{Path: "src", Merge: "forge"})
+	assert.ErrorContains(t, err, "refs/pull/1/merge")
+
+	f.git(f.work, "merge", "-q", "--no-edit", "feature")
+	merged := f.git(f.work, "rev-parse", "HEAD")
+	f.git(f.work, "push", "-q", filepath.Join(f.root, f.name+".git"), merged+":refs/pull/1/merge")
+
+	ctx = f.pullRequestContext(head)
+	require.NoError(t, Run(ctx, Options{Path: "src", Merge: "forge", Depth: 1}))
+	assert.Equal(t, merged, outputs(t, ctx)["sha"])
+}
+
+func TestRun_MergeIgnoredOutsidePullRequests(t *testing.T) {
+	f := newFixture(t)
+	sha := f.commit("first", map[string]string{"README.md": "one\n"})
+	f.push()
+
+	ctx := f.context(sha)
+	require.NoError(t, Run(ctx, Options{Path: "src", Merge: "local"}))
+	assert.Equal(t, sha, outputs(t, ctx)["sha"])
+}
+
+func TestRun_PersistCredentials(t *testing.T) {
+	f := newFixture(t)
+	sha := f.commit("first", map[string]string{"README.md": "one\n"})
+	f.push()
+
+	ctx := f.context(sha)
+	require.NoError(t, Run(ctx, Options{Path: "src", PersistCredentials: true, UserName: "Release Bot"}))
+
+	dir := filepath.Join(ctx.Workspace, "src")
+	assert.Equal(t, "Release Bot", f.git(dir, "config", "user.name"))
+	assert.Equal(t, "release-bot@noreply.127.0.0.1", f.git(dir, "config", "user.email"))
+
+	f.commit("second", map[string]string{"README.md": "two\n"})
+	f.push()
+	f.git(dir, "fetch", "-q", "origin")
+
+	state, err := os.ReadFile(ctx.StateFile)
+	require.NoError(t, err)
+	assert.Equal(t, "credentials_path=src\n", string(state))
+
+	t.Setenv("STATE_credentials_path", "src")
+	require.NoError(t, Post(ctx))
+	assert.NotContains(t, f.git(dir, "config", "--list", "--local"), "extraheader")
+
+	cmd := exec.Command("git", "fetch", "-q", "origin")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "HOME="+f.root, "GIT_TERMINAL_PROMPT=0", "GIT_CONFIG_NOSYSTEM=1")
+	assert.Error(t, cmd.Run())
+}
+
+func TestRun_DefaultIdentity(t *testing.T) {
+	f := newFixture(t)
+	sha := f.commit("first", map[string]string{"README.md": "one\n"})
+	f.push()
+
+	ctx := f.context(sha)
+	require.NoError(t, Run(ctx, Options{Path: "src"}))
+
+	dir := filepath.Join(ctx.Workspace, "src")
+	assert.Equal(t, "actions[bot]", f.git(dir, "config", "user.name"))
+	assert.Equal(t, "actionsbot@noreply.127.0.0.1", f.git(dir, "config", "user.email"))
+	assert.NotContains(t, f.git(dir, "config", "--list", "--local"), "extraheader")
+	assert.NoFileExists(t, ctx.StateFile)
+	require.NoError(t, Post(ctx))
+}
+
+func TestRun_ReusesExisting(t *testing.T) {
+	tests := []struct {
+		name      string
+		clean     string
+		untracked bool
+		ignored   bool
+	}{
+		{name: "default", clean: "", untracked: false, ignored: true},
+		{name: "all", clean: "all", untracked: false, ignored: false},
+		{name: "disabled", clean: "false", untracked: true, ignored: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			first := f.commit("first", map[string]string{"README.md": "one\n", ".gitignore": "*.log\n"})
+			f.git(f.work, "branch", "old")
+			f.push()
+
+			ctx := f.context(first)
+			require.NoError(t, Run(ctx, Options{Path: "src", Depth: 1, Sparse: []string{"docs"}, SparseCone: true}))
+
+			dir := filepath.Join(ctx.Workspace, "src")
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("modified\n"), 0644))
+			require.NoError(t, os.MkdirAll(filepath.Join(dir, "scratch"), 0755))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "scratch", "notes.txt"), []byte("notes\n"), 0644))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "build.log"), []byte("log\n"), 0644))
+
+			second := f.commit("second", map[string]string{"docs/guide.md": "guide\n"})
+			f.git(f.work, "branch", "-D", "old")
+			f.push()
+
+			ctx = f.context(second)
+			ctx.Workspace = filepath.Dir(dir)
+			require.NoError(t, Run(ctx, Options{Path: "src", Clean: tt.clean}))
+
+			content, err := os.ReadFile(filepath.Join(dir, "README.md"))
+			require.NoError(t, err)
+			assert.Equal(t, "one\n", string(content))
+			assert.FileExists(t, filepath.Join(dir, "docs", "guide.md"))
+			assert.Equal(t, tt.untracked, fileExists(filepath.Join(dir, "scratch", "notes.txt")))
+			assert.Equal(t, tt.ignored, fileExists(filepath.Join(dir, "build.log")))
+
+			assert.Equal(t, "0", outputs(t, ctx)["depth"])
+			assert.NoFileExists(t, filepath.Join(dir, ".git", "shallow"))
+			assert.NoFileExists(t, filepath.Join(dir, ".git", "info", "sparse-checkout"))
+			assert.NotContains(t, f.git(dir, "branch", "-r"), "origin/old")
+			assert.Equal(t, second, f.git(dir, "rev-parse", "HEAD"))
+			f.git(dir, "fsck", "--no-progress")
+		})
+	}
+}
+
+func TestRun_CorruptExisting(t *testing.T) {
+	f := newFixture(t)
+	sha := f.commit("first", map[string]string{"README.md": "one\n"})
+	f.push()
+
+	ctx := f.context(sha)
+	require.NoError(t, Run(ctx, Options{Path: "src"}))
+
+	dir := filepath.Join(ctx.Workspace, "src")
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, ".git", "objects")))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".git", "objects"), 0755))
+
+	assert.ErrorContains(t, Run(ctx, Options{Path: "src"}), "existing repository is unusable")
+
+	require.NoError(t, Run(ctx, Options{Path: "src", Reclone: true}))
+	assert.Equal(t, sha, f.git(dir, "rev-parse", "HEAD"))
+	f.git(dir, "fsck", "--no-progress")
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestRun_Shallow(t *testing.T) {
+	f := newFixture(t)
+	f.commit("first", map[string]string{"README.md": "one\n"})
+	second := f.commit("second", map[string]string{"README.md": "two\n"})
+	f.commit("third", map[string]string{"README.md": "three\n"})
+	f.push()
+
+	ctx := f.context(second)
+	require.NoError(t, Run(ctx, Options{Path: "src", Depth: 1}))
+
+	content, err := os.ReadFile(filepath.Join(ctx.Workspace, "src", "README.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "two\n", string(content))
+
+	repo, err := git.PlainOpen(filepath.Join(ctx.Workspace, "src"))
+	require.NoError(t, err)
+	shallows, err := repo.Storer.Shallow()
+	require.NoError(t, err)
+	assert.Equal(t, []plumbing.Hash{plumbing.NewHash(second)}, shallows)
+
+	commit, err := repo.CommitObject(plumbing.NewHash(second))
+	require.NoError(t, err)
+	assert.False(t, hasObject(repo, commit.ParentHashes[0]))
+
+	assert.Equal(t, "1", outputs(t, ctx)["depth"])
+}
+
+func TestRun_ShallowDeeperThanHistory(t *testing.T) {
+	f := newFixture(t)
+	f.commit("first", map[string]string{"README.md": "one\n"})
+	sha := f.commit("second", map[string]string{"README.md": "two\n"})
+	f.push()
+
+	ctx := f.context(sha)
+	require.NoError(t, Run(ctx, Options{Path: "src", Depth: 10}))
+	assert.Equal(t, "0", outputs(t, ctx)["depth"])
+}
+
+func TestRun_DeepensForTags(t *testing.T) {
+	f := newFixture(t)
+	tagged := f.commit("first", map[string]string{"README.md": "one\n"})
+	f.git(f.work, "tag", "-a", "-m", "Release", "v1.0.0")
+	f.commit("second", map[string]string{"README.md": "two\n"})
+	f.commit("third", map[string]string{"README.md": "three\n"})
+	sha := f.commit("fourth", map[string]string{"README.md": "four\n"})
+	f.commit("fifth", map[string]string{"README.md": "five\n"})
+	f.push()
+
+	ctx := f.context(sha)
+	require.NoError(t, Run(ctx, Options{Path: "src", Depth: 1, FetchTags: true}))
+
+	repo, err := git.PlainOpen(filepath.Join(ctx.Workspace, "src"))
+	require.NoError(t, err)
+	shallows, err := repo.Storer.Shallow()
+	require.NoError(t, err)
+
+	found, err := reachesAny(repo, plumbing.NewHash(sha), map[plumbing.Hash]bool{plumbing.NewHash(tagged): true}, shallows)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "4", outputs(t, ctx)["depth"])
+}
+
+func TestRun_Filter(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   string
+		expected string
+	}{
+		{
+			name:     "blobless",
+			filter:   "blobless",
+			expected: "blob:none",
+		},
+		{
+			name:     "treeless",
+			filter:   "treeless",
+			expected: "tree:0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			f.commit("first", map[string]string{"README.md": "one\n", "old/file.txt": "old\n"})
+			f.git(f.work, "rm", "-q", "-r", "old")
+			sha := f.commit("second", map[string]string{"README.md": "two\n", "sub/dir/file.txt": "nested\n"})
+			f.push()
+
+			ctx := f.context(sha)
+			require.NoError(t, Run(ctx, Options{Path: "src", Filter: tt.filter}))
+
+			content, err := os.ReadFile(filepath.Join(ctx.Workspace, "src", "sub", "dir", "file.txt"))
+			require.NoError(t, err)
+			assert.Equal(t, "nested\n", string(content))
+
+			repo, err := git.PlainOpen(filepath.Join(ctx.Workspace, "src"))
+			require.NoError(t, err)
+			assert.False(t, hasObject(repo, plumbing.ComputeHash(plumbing.BlobObject, []byte("old\n"))))
+
+			cfg, err := repo.Config()
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, cfg.Raw.Section("remote").Subsection("origin").Option("partialclonefilter"))
+			assert.Equal(t, tt.expected, outputs(t, ctx)["filter"])
+		})
+	}
+}
+
+func TestRun_InvalidFilter(t *testing.T) {
+	ctx := &common.Context{Workspace: t.TempDir()}
+	assert.ErrorContains(t, Run(ctx, Options{Path: "src", Filter: "bogus"}), "unknown filter")
+}
+
+func TestRun_Submodules(t *testing.T) {
+	f := newFixture(t)
+
+	inner := f.sibling("owner/inner")
+	inner.commit("inner", map[string]string{"inner.txt": "inner\n"})
+	inner.push()
+
+	lib := f.sibling("owner/lib")
+	lib.commit("lib", map[string]string{"lib.txt": "lib\n"})
+	lib.git(lib.work, "submodule", "-q", "add", filepath.Join(f.root, "owner/inner.git"), "inner")
+	lib.git(lib.work, "config", "-f", ".gitmodules", "submodule.inner.url", "../inner.git")
+	lib.commit("add inner", nil)
+	lib.push()
+
+	f.git(f.work, "submodule", "-q", "add", filepath.Join(f.root, "owner/lib.git"), "vendor/lib")
+	f.git(f.work, "config", "-f", ".gitmodules", "submodule.vendor/lib.url", "../lib.git")
+	sha := f.commit("add lib", map[string]string{"README.md": "main\n"})
+	f.push()
+
+	tests := []struct {
+		name       string
+		submodules string
+		lib        bool
+		inner      bool
+	}{
+		{
+			name:       "disabled",
+			submodules: "false",
+		},
+		{
+			name:       "top level only",
+			submodules: "true",
+			lib:        true,
+		},
+		{
+			name:       "recursive",
+			submodules: "recursive",
+			lib:        true,
+			inner:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := f.context(sha)
+			require.NoError(t, Run(ctx, Options{Path: "src", Submodules: tt.submodules}))
+
+			libFile := filepath.Join(ctx.Workspace, "src", "vendor", "lib", "lib.txt")
+			innerFile := filepath.Join(ctx.Workspace, "src", "vendor", "lib", "inner", "inner.txt")
+			if tt.lib {
+				assert.FileExists(t, libFile)
+			} else {
+				assert.NoFileExists(t, libFile)
+			}
+			if tt.inner {
+				assert.FileExists(t, innerFile)
+			} else {
+				assert.NoFileExists(t, innerFile)
+			}
+		})
+	}
+}
+
+func TestRun_SubmoduleCredentials(t *testing.T) {
+	f := newFixture(t)
+
+	lib := f.sibling("owner/lib")
+	lib.commit("lib", map[string]string{"lib.txt": "lib\n"})
+	lib.push()
+
+	otherHost := strings.Replace(f.server.URL, "127.0.0.1", "localhost", 1)
+	f.git(f.work, "submodule", "-q", "add", filepath.Join(f.root, "owner/lib.git"), "lib")
+	f.git(f.work, "config", "-f", ".gitmodules", "submodule.lib.url", otherHost+"/owner/lib.git")
+	sha := f.commit("add lib", nil)
+	f.push()
+
+	ctx := f.context(sha)
+	assert.ErrorContains(t, Run(ctx, Options{Path: "src", Submodules: "true"}), "authentication required")
+
+	ctx = f.context(sha)
+	require.NoError(t, Run(ctx, Options{Path: "src", Submodules: "true", CredentialHosts: []string{"localhost"}}))
+	assert.FileExists(t, filepath.Join(ctx.Workspace, "src", "lib", "lib.txt"))
+}
+
+func TestRun_LFS(t *testing.T) {
+	f := newFixture(t)
+	sha := f.commit("first", map[string]string{
+		"README.md":      "readme\n",
+		"assets/big.bin": f.lfsPointer("large binary content\n"),
+		"assets/dup.bin": f.lfsPointer("large binary content\n"),
+	})
+	f.push()
+
+	ctx := f.context(sha)
+	require.NoError(t, Run(ctx, Options{Path: "src", LFS: true}))
+
+	for _, name := range []string{"big.bin", "dup.bin"} {
+		content, err := os.ReadFile(filepath.Join(ctx.Workspace, "src", "assets", name))
+		require.NoError(t, err)
+		assert.Equal(t, "large binary content\n", string(content))
+	}
+
+	ctx = f.context(sha)
+	require.NoError(t, Run(ctx, Options{Path: "src"}))
+	content, err := os.ReadFile(filepath.Join(ctx.Workspace, "src", "assets", "big.bin"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(content), lfsPointerVersion))
+}
+
+func TestMergeLines(t *testing.T) {
+	base := "a\nb\nc\nd\ne\n"
+	tests := []struct {
+		name     string
+		ours     string
+		theirs   string
+		expected string
+		ok       bool
+	}{
+		{name: "unchanged", ours: base, theirs: base, expected: base, ok: true},
+		{name: "one side", ours: "a\nB\nc\nd\ne\n", theirs: base, expected: "a\nB\nc\nd\ne\n", ok: true},
+		{name: "separate lines", ours: "A\nb\nc\nd\ne\n", theirs: "a\nb\nc\nd\nE\n", expected: "A\nb\nc\nd\nE\n", ok: true},
+		{name: "same change", ours: "a\nb\nC\nd\ne\n", theirs: "a\nb\nC\nd\ne\n", expected: "a\nb\nC\nd\ne\n", ok: true},
+		{name: "insert and delete", ours: "a\nb\nc\nd\ne\nf\n", theirs: "b\nc\nd\ne\n", expected: "b\nc\nd\ne\nf\n", ok: true},
+		{name: "same line", ours: "a\nb\nX\nd\ne\n", theirs: "a\nb\nY\nd\ne\n"},
+		{name: "adjacent lines", ours: "a\nB\nc\nd\ne\n", theirs: "a\nb\nC\nd\ne\n"},
+		{name: "delete and modify", ours: "a\nb\nd\ne\n", theirs: "a\nb\nX\nd\ne\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, ok := mergeLines(base, tt.ours, tt.theirs)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestParseLFSPointer(t *testing.T) {
+	oid := strings.Repeat("ab", 32)
+	tests := []struct {
+		name     string
+		input    string
+		expected lfsObject
+		ok       bool
+	}{
+		{
+			name:     "valid pointer",
+			input:    lfsPointerVersion + "\noid sha256:" + oid + "\nsize 12\n",
+			expected: lfsObject{OID: oid, Size: 12},
+			ok:       true,
+		},
+		{
+			name:  "ordinary file",
+			input: "hello world\n",
+		},
+		{
+			name:  "truncated oid",
+			input: lfsPointerVersion + "\noid sha256:abcd\nsize 12\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, ok := parseLFSPointer([]byte(tt.input))
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestCredentialsAllowed(t *testing.T) {
+	creds := credentials{hosts: []string{"git.example.com", "cdn.example.com:8443"}}
+
+	assert.True(t, creds.allowed("https://git.example.com/owner/repo.git"))
+	assert.True(t, creds.allowed("https://git.example.com:3000/owner/repo.git"))
+	assert.True(t, creds.allowed("https://cdn.example.com:8443/object"))
+	assert.False(t, creds.allowed("https://cdn.example.com/object"))
+	assert.False(t, creds.allowed("https://evil.example.com/owner/repo.git"))
+}
+
+func TestRun_Sparse(t *testing.T) {
+	f := newFixture(t)
+	f.commit("first", map[string]string{
+		"README.md":          "readme\n",
+		"a/x.txt":            "x\n",
+		"a/b/c.txt":          "c\n",
+		"a/other/y.txt":      "y\n",
+		"docs/guide.md":      "guide\n",
+		"docs/internal.md":   "internal\n",
+		"z/w.txt":            "w\n",
+		"z/deep/nested.txt":  "nested\n",
+		"z/deep/nested.md":   "nested\n",
+		"z/deep/other/a.txt": "a\n",
+	})
+	f.git(f.work, "tag", "v1.0.0")
+	sha := f.commit("second", map[string]string{"README.md": "updated\n"})
+	f.push()
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected []string
+	}{
+		{
+			name:     "cone directories",
+			opts:     Options{Sparse: []string{"a/b"}, SparseCone: true},
+			expected: []string{"README.md", "a/b/c.txt", "a/x.txt"},
+		},
+		{
+			name:     "cone with trailing slash",
+			opts:     Options{Sparse: []string{"/z/deep/"}, SparseCone: true},
+			expected: []string{"README.md", "z/deep/nested.md", "z/deep/nested.txt", "z/deep/other/a.txt", "z/w.txt"},
+		},
+		{
+			name:     "patterns",
+			opts:     Options{Sparse: []string{"*.md", "!docs/internal.md"}},
+			expected: []string{"README.md", "docs/guide.md", "z/deep/nested.md"},
+		},
+		{
+			name:     "blobless with tags",
+			opts:     Options{Sparse: []string{"a/b"}, SparseCone: true, Filter: "blobless", FetchTags: true},
+			expected: []string{"README.md", "a/b/c.txt", "a/x.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := f.context(sha)
+			tt.opts.Path = "src"
+			require.NoError(t, Run(ctx, tt.opts))
+
+			var files []string
+			root := filepath.Join(ctx.Workspace, "src")
+			require.NoError(t, filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+				if d.IsDir() && d.Name() == ".git" {
+					return filepath.SkipDir
+				}
+				if !d.IsDir() {
+					rel, _ := filepath.Rel(root, path)
+					files = append(files, filepath.ToSlash(rel))
+				}
+				return err
+			}))
+			assert.ElementsMatch(t, tt.expected, files)
+			assert.Equal(t, strings.Join(tt.expected, ","), outputs(t, ctx)["sparse-paths"])
+
+			repo, err := git.PlainOpen(root)
+			require.NoError(t, err)
+			_, err = repo.Tag("v1.0.0")
+			assert.NoError(t, err)
+
+			if tt.opts.Filter != "" {
+				assert.False(t, hasObject(repo, plumbing.ComputeHash(plumbing.BlobObject, []byte("w\n"))))
+			}
+		})
+	}
+}
+
+func TestNewSparseCheckout(t *testing.T) {
+	_, err := newSparseCheckout([]string{"src/*.go"}, true)
+	assert.ErrorContains(t, err, "disable cone mode")
+
+	_, err = newSparseCheckout([]string{"/"}, true)
+	assert.Error(t, err)
+
+	s, err := newSparseCheckout(nil, true)
+	require.NoError(t, err)
+	assert.Nil(t, s)
+	assert.True(t, s.includes("anything/at/all"))
+}
+
+func TestSparseCheckoutDefinition(t *testing.T) {
+	s, err := newSparseCheckout([]string{"a/b/c", "a/d", "e"}, true)
+	require.NoError(t, err)
+	assert.Equal(t, "/*\n!/*/\n/a/\n!/a/*/\n/a/b/\n!/a/b/*/\n/a/b/c/\n/a/d/\n/e/\n", s.definition())
+
+	s, err = newSparseCheckout([]string{"*.md", "!docs/"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, "*.md\n!docs/\n", s.definition())
+}
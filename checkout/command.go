@@ -0,0 +1,61 @@
+package checkout
+
+import "chameth.com/actions/common"
+
+func Command() *common.Command {
+	c := common.NewCommand("checkout", "Checkout a repository")
+	path := c.String("path", "src", "Path to checkout to (relative to workspace)")
+	repository := c.String("repository", "", "Repository to check out, as owner/name (defaults to the triggering repository)")
+	ref := c.String("ref", "", "Branch, tag or SHA to check out (defaults to the triggering commit)")
+	merge := c.String("merge", "false", "How to check out pull requests (false for the head, local or forge to merge into the base)")
+	token := c.Secret("token", "TOKEN", "Token to use in place of the job token")
+	fetchTags := c.Bool("fetch-tags", true, "Fetch tags from the remote")
+	depth := c.Int("fetch-depth", 0, "Number of commits of history to fetch (0 for full history)")
+	filter := c.String("filter", "", "Partial clone filter to use (blobless or treeless)")
+	submodules := c.String("submodules", "false", "Whether to check out submodules (true, false or recursive)")
+	lfs := c.Bool("lfs", false, "Download Git LFS objects")
+	credentialHosts := c.List("credential-hosts", "", "Comma-separated list of additional hosts the token may be sent to")
+	sparse := c.List("sparse", "", "Directories or patterns to check out, separated by newlines or commas (empty for everything)")
+	sparseCone := c.Bool("sparse-cone", true, "Treat sparse entries as directories rather than gitignore-style patterns")
+	clean := c.String("clean", "true", "What to remove when reusing an existing repository (true for untracked files, all to include ignored files, or false)")
+	reclone := c.Bool("reclone", false, "Remove and check out again if the existing repository is unusable")
+	persist := c.Bool("persist-credentials", false, "Store the token in the repository's local git config for later steps")
+	userName := c.String("user-name", "", "Name to configure for commits (defaults to a bot identity)")
+	userEmail := c.String("user-email", "", "Email to configure for commits (defaults to a bot identity)")
+	cleanup := c.Bool("cleanup", false, "Remove persisted credentials from a previous checkout instead of checking out")
+
+	c.Output("path", "The path the repository was checked out to")
+	c.Output("sha", "The commit SHA that was checked out")
+	c.Output("depth", "The depth of the fetched history (0 if the full history was fetched)")
+	c.Output("filter", "The partial clone filter that was used, if any")
+	c.Output("sparse-paths", "Comma-separated list of files materialised by a sparse checkout")
+
+	c.Run = func(ctx *common.Context) error {
+		if cleanup.Value() {
+			return Cleanup(ctx, path.Value())
+		}
+
+		return Run(ctx, Options{
+			Path:               path.Value(),
+			Repository:         repository.Value(),
+			Ref:                ref.Value(),
+			Token:              token.Value(),
+			Merge:              merge.Value(),
+			FetchTags:          fetchTags.Value(),
+			Depth:              depth.Value(),
+			Filter:             filter.Value(),
+			Submodules:         submodules.Value(),
+			LFS:                lfs.Value(),
+			CredentialHosts:    credentialHosts.Value(),
+			Sparse:             sparse.Value(),
+			SparseCone:         sparseCone.Value(),
+			Clean:              clean.Value(),
+			Reclone:            reclone.Value(),
+			PersistCredentials: persist.Value(),
+			UserName:           userName.Value(),
+			UserEmail:          userEmail.Value(),
+		})
+	}
+	c.Post = Post
+	return c
+}
@@ -0,0 +1,266 @@
+package checkout
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// parseClean converts a user-facing clean mode into "true" to remove
+// untracked files, "all" to also remove ignored files, or "false" to keep
+// them.
+func parseClean(mode string) (string, error) {
+	switch mode {
+	case "", "true":
+		return "true", nil
+	case "false", "all":
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown clean mode %q: expected true, false or all", mode)
+	}
+}
+
+// openRepository opens the repository in dir if one exists, pointing its
+// origin at url, or initialises a new one. It reports whether an existing
+// repository was reused. If the existing repository is unusable and reclone
+// is set, the directory is emptied and a new repository initialised.
+func openRepository(dir, url string, reclone bool) (*git.Repository, bool, error) {
+	if _, err := os.Stat(filepath.Join(dir, git.GitDirName)); err == nil {
+		repo, err := reuseRepository(dir, url)
+		if err == nil {
+			slog.Info("Reusing existing repository", "path", dir)
+			return repo, true, nil
+		}
+		if !reclone {
+			return nil, false, fmt.Errorf("existing repository is unusable: %w", err)
+		}
+
+		slog.Warn("Existing repository is unusable, removing it", "path", dir, "error", err)
+		if err := emptyDir(dir); err != nil {
+			return nil, false, err
+		}
+	}
+
+	slog.Debug("Initialising repository", "url", url)
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to initialise repository: %w", err)
+	}
+
+	if _, err := repo.CreateRemote(&config.RemoteConfig{
+		Name:  git.DefaultRemoteName,
+		URLs:  []string{url},
+		Fetch: []config.RefSpec{config.RefSpec(fmt.Sprintf("+refs/heads/*:refs/remotes/%s/*", git.DefaultRemoteName))},
+	}); err != nil {
+		return nil, false, fmt.Errorf("failed to create remote: %w", err)
+	}
+	return repo, false, nil
+}
+
+// reuseRepository opens an existing repository, checks that it can be read,
+// and updates the URL of its origin remote.
+func reuseRepository(dir, url string) (*git.Repository, error) {
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if _, err := repo.Storer.Index(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	head, err := repo.Head()
+	switch {
+	case errors.Is(err, plumbing.ErrReferenceNotFound):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read HEAD: %w", err)
+	default:
+		commit, err := repo.CommitObject(head.Hash())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read HEAD commit: %w", err)
+		}
+		if _, err := commit.Tree(); err != nil {
+			return nil, fmt.Errorf("failed to read HEAD tree: %w", err)
+		}
+	}
+
+	origin, ok := cfg.Remotes[git.DefaultRemoteName]
+	if !ok {
+		origin = &config.RemoteConfig{
+			Name:  git.DefaultRemoteName,
+			Fetch: []config.RefSpec{config.RefSpec(fmt.Sprintf("+refs/heads/*:refs/remotes/%s/*", git.DefaultRemoteName))},
+		}
+		cfg.Remotes[git.DefaultRemoteName] = origin
+	}
+	if len(origin.URLs) == 0 || origin.URLs[0] != url {
+		slog.Debug("Updating remote url", "url", url)
+		origin.URLs = []string{url}
+	}
+
+	if err := repo.SetConfig(cfg); err != nil {
+		return nil, fmt.Errorf("failed to write config: %w", err)
+	}
+	return repo, nil
+}
+
+// emptyDir removes everything inside dir, leaving the directory itself.
+func emptyDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// preservedFiles holds untracked files that have been moved out of the
+// worktree while a commit is checked out.
+type preservedFiles struct {
+	root  string
+	stash string
+	paths []string
+}
+
+// preserveUntracked moves files that are not tracked in the current index
+// into the git directory, so they survive checking out a new commit (which
+// removes everything untracked). In mode "true" only ignored files are kept,
+// along with nested repositories; in mode "false" all untracked files are
+// kept; in mode "all" nothing is.
+func preserveUntracked(repo *git.Repository, mode string) (*preservedFiles, error) {
+	if mode == "all" {
+		return nil, nil
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open worktree: %w", err)
+	}
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	tracked := make(map[string]bool)
+	dirs := make(map[string]bool)
+	for _, entry := range idx.Entries {
+		tracked[entry.Name] = true
+		for dir := path.Dir(entry.Name); dir != "."; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+
+	patterns, err := gitignore.ReadPatterns(worktree.Filesystem, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ignore patterns: %w", err)
+	}
+	ignored := gitignore.NewMatcher(append(patterns, worktree.Excludes...))
+
+	root := worktree.Filesystem.Root()
+	p := &preservedFiles{
+		root:  root,
+		stash: filepath.Join(root, git.GitDirName, "preserved"),
+	}
+	if err := os.RemoveAll(p.stash); err != nil {
+		return nil, fmt.Errorf("failed to remove %s: %w", p.stash, err)
+	}
+
+	err = filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		switch {
+		case rel == git.GitDirName:
+			return filepath.SkipDir
+		case tracked[rel]:
+			// Tracked files, and submodules, are managed by the checkout.
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		case d.IsDir() && dirs[rel]:
+			return nil
+		}
+
+		keep := mode == "false" || ignored.Match(strings.Split(rel, "/"), d.IsDir())
+		if !keep && d.IsDir() {
+			_, err := os.Stat(filepath.Join(file, git.GitDirName))
+			keep = err == nil
+		}
+		if !keep {
+			return nil
+		}
+
+		slog.Debug("Preserving untracked path", "path", rel)
+		target := filepath.Join(p.stash, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to preserve %s: %w", rel, err)
+		}
+		if err := os.Rename(file, target); err != nil {
+			return fmt.Errorf("failed to preserve %s: %w", rel, err)
+		}
+		p.paths = append(p.paths, rel)
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Cleaning worktree", "mode", mode, "preserved", len(p.paths))
+	return p, nil
+}
+
+// restore moves preserved files back into the worktree. Files that clash
+// with the newly checked out commit are discarded.
+func (p *preservedFiles) restore() error {
+	if p == nil {
+		return nil
+	}
+
+	for _, rel := range p.paths {
+		target := filepath.Join(p.root, filepath.FromSlash(rel))
+		if _, err := os.Lstat(target); err == nil {
+			slog.Warn("Untracked path is now tracked, discarding it", "path", rel)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", rel, err)
+		}
+		if err := os.Rename(filepath.Join(p.stash, filepath.FromSlash(rel)), target); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", rel, err)
+		}
+	}
+
+	if err := os.RemoveAll(p.stash); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", p.stash, err)
+	}
+	return nil
+}
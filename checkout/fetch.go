@@ -0,0 +1,353 @@
+package checkout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"chameth.com/actions/common"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/sideband"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// basicAuth authenticates smart HTTP requests using a precomputed basic auth
+// token, as returned by common.Context.BasicAuth.
+type basicAuth string
+
+func (a basicAuth) SetAuth(r *http.Request) {
+	r.Header.Set("Authorization", "Basic "+string(a))
+}
+
+func (a basicAuth) Name() string {
+	return "http-basic-auth"
+}
+
+func (a basicAuth) String() string {
+	return fmt.Sprintf("%s - %s", a.Name(), "*******")
+}
+
+// credentials decides which hosts the job token may be sent to.
+type credentials struct {
+	auth  basicAuth
+	hosts []string
+}
+
+func newCredentials(ctx *common.Context, extraHosts []string) credentials {
+	hosts := slices.Clone(extraHosts)
+	if u, err := url.Parse(ctx.ServerURL); err == nil {
+		hosts = append(hosts, u.Host)
+	}
+	return credentials{auth: basicAuth(ctx.BasicAuth()), hosts: hosts}
+}
+
+// allowed determines whether the token may be sent to the given URL. Hosts in
+// the allow-list may omit the port to match any port.
+func (c credentials) allowed(target string) bool {
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+
+	for _, host := range c.hosts {
+		if strings.EqualFold(host, u.Host) || strings.EqualFold(host, u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorise adds the token to the request if its host is trusted.
+func (c credentials) authorise(req *http.Request) {
+	if c.allowed(req.URL.String()) {
+		c.auth.SetAuth(req)
+	}
+}
+
+// forURL returns the auth method to use for the given URL, or nil if the
+// request should be made anonymously.
+func (c credentials) forURL(target string) transport.AuthMethod {
+	if c.allowed(target) {
+		return c.auth
+	}
+	slog.Debug("Not sending credentials to untrusted host", "url", target)
+	return nil
+}
+
+// remote is a repository served over smart HTTP that objects can be fetched
+// from.
+type remote struct {
+	url     string
+	session transport.UploadPackSession
+	adv     *packp.AdvRefs
+	refs    map[plumbing.ReferenceName]plumbing.Hash
+}
+
+// fetchRequest describes the objects to request from a remote in a single
+// upload-pack exchange.
+type fetchRequest struct {
+	wants       []plumbing.Hash
+	depth       int
+	filter      packp.Filter
+	includeTags bool
+}
+
+func openRemote(target string, creds credentials) (*remote, error) {
+	endpoint, err := transport.NewEndpoint(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository url %q: %w", target, err)
+	}
+
+	session, err := githttp.NewClient(common.HTTPClient).NewUploadPackSession(endpoint, creds.forURL(target))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", target, err)
+	}
+
+	adv, err := session.AdvertisedReferences()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list references for %s: %w", target, err)
+	}
+
+	refs := make(map[plumbing.ReferenceName]plumbing.Hash)
+	for name, hash := range adv.References {
+		refs[plumbing.ReferenceName(name)] = hash
+	}
+
+	return &remote{
+		url:     target,
+		session: session,
+		adv:     adv,
+		refs:    refs,
+	}, nil
+}
+
+// canWant determines whether the remote will serve the given object when it
+// is requested directly.
+func (r *remote) canWant(hash plumbing.Hash) bool {
+	if r.adv.Capabilities.Supports(capability.AllowReachableSHA1InWant) {
+		return true
+	}
+
+	for _, h := range r.refs {
+		if h == hash {
+			return true
+		}
+	}
+	for _, h := range r.adv.Peeled {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve finds the commit that the given branch, tag, full reference name
+// or commit SHA refers to. An empty ref resolves to the remote's HEAD.
+func (r *remote) resolve(ref string) (plumbing.Hash, error) {
+	if ref == "" {
+		if r.adv.Head == nil {
+			return plumbing.ZeroHash, fmt.Errorf("remote %s does not advertise a default branch", r.url)
+		}
+		return *r.adv.Head, nil
+	}
+
+	if plumbing.IsHash(ref) {
+		return plumbing.NewHash(ref), nil
+	}
+
+	candidates := []string{ref}
+	if !strings.HasPrefix(ref, "refs/") {
+		candidates = []string{
+			plumbing.NewBranchReferenceName(ref).String(),
+			plumbing.NewTagReferenceName(ref).String(),
+		}
+	}
+
+	for _, name := range candidates {
+		if hash, ok := r.adv.Peeled[name]; ok {
+			return hash, nil
+		}
+		if hash, ok := r.refs[plumbing.ReferenceName(name)]; ok {
+			return hash, nil
+		}
+	}
+	return plumbing.ZeroHash, fmt.Errorf("reference %q not found in %s", ref, r.url)
+}
+
+// matching returns the advertised references with the given prefix.
+func (r *remote) matching(prefix string) map[plumbing.ReferenceName]plumbing.Hash {
+	res := make(map[plumbing.ReferenceName]plumbing.Hash)
+	for name, hash := range r.refs {
+		if strings.HasPrefix(name.String(), prefix) {
+			res[name] = hash
+		}
+	}
+	return res
+}
+
+// fetch performs a single upload-pack exchange, writing the received objects
+// and any shallow boundary changes into the repository's storage.
+func (r *remote) fetch(repo *git.Repository, req fetchRequest) error {
+	var wants []plumbing.Hash
+	for _, want := range req.wants {
+		if req.depth > 0 || !hasObject(repo, want) {
+			wants = append(wants, want)
+		}
+	}
+	if len(wants) == 0 {
+		slog.Debug("Nothing to fetch", "url", r.url)
+		return nil
+	}
+
+	upload := packp.NewUploadPackRequestFromCapabilities(r.adv.Capabilities)
+	upload.Wants = wants
+
+	if r.adv.Capabilities.Supports(capability.NoProgress) {
+		if err := upload.Capabilities.Set(capability.NoProgress); err != nil {
+			return err
+		}
+	}
+
+	if req.includeTags && r.adv.Capabilities.Supports(capability.IncludeTag) {
+		if err := upload.Capabilities.Set(capability.IncludeTag); err != nil {
+			return err
+		}
+	}
+
+	shallows, err := repo.Storer.Shallow()
+	if err != nil {
+		return fmt.Errorf("failed to read shallow commits: %w", err)
+	}
+
+	if req.depth > 0 || len(shallows) > 0 {
+		if !r.adv.Capabilities.Supports(capability.Shallow) {
+			return fmt.Errorf("remote does not support shallow fetches")
+		}
+		if err := upload.Capabilities.Set(capability.Shallow); err != nil {
+			return err
+		}
+		upload.Shallows = shallows
+		upload.Depth = packp.DepthCommits(req.depth)
+	}
+
+	if req.filter != "" {
+		if !r.adv.Capabilities.Supports(capability.Filter) {
+			return fmt.Errorf("remote does not support partial clone filters")
+		}
+		if err := upload.Capabilities.Set(capability.Filter); err != nil {
+			return err
+		}
+		upload.Filter = req.filter
+	}
+
+	upload.Haves, err = haves(repo)
+	if err != nil {
+		return err
+	}
+
+	slog.Debug("Fetching objects", "url", r.url, "wants", len(wants), "depth", req.depth, "filter", req.filter)
+	resp, err := r.session.UploadPack(context.Background(), upload)
+	if err != nil {
+		if errors.Is(err, transport.ErrEmptyUploadPackRequest) {
+			return nil
+		}
+		return fmt.Errorf("upload-pack failed: %w", err)
+	}
+	defer resp.Close()
+
+	if err := updateShallows(repo, shallows, resp.ShallowUpdate); err != nil {
+		return err
+	}
+
+	var pack io.Reader = resp
+	if upload.Capabilities.Supports(capability.Sideband64k) {
+		pack = sideband.NewDemuxer(sideband.Sideband64k, resp)
+	} else if upload.Capabilities.Supports(capability.Sideband) {
+		pack = sideband.NewDemuxer(sideband.Sideband, resp)
+	}
+
+	if err := packfile.UpdateObjectStorage(repo.Storer, pack); err != nil {
+		return fmt.Errorf("failed to store fetched objects: %w", err)
+	}
+
+	return nil
+}
+
+// haves lists the commits that local references point at, so the remote can
+// avoid sending objects we already have.
+func haves(repo *git.Repository) ([]plumbing.Hash, error) {
+	iter, err := repo.Storer.IterReferences()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list local references: %w", err)
+	}
+	defer iter.Close()
+
+	seen := make(map[plumbing.Hash]bool)
+	var res []plumbing.Hash
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference || seen[ref.Hash()] {
+			return nil
+		}
+		seen[ref.Hash()] = true
+		if hasObject(repo, ref.Hash()) {
+			res = append(res, ref.Hash())
+		}
+		return nil
+	})
+	return res, err
+}
+
+func updateShallows(repo *git.Repository, existing []plumbing.Hash, update packp.ShallowUpdate) error {
+	if len(update.Shallows) == 0 && len(update.Unshallows) == 0 {
+		return nil
+	}
+
+	shallow := make(map[plumbing.Hash]bool)
+	for _, h := range existing {
+		shallow[h] = true
+	}
+	for _, h := range update.Shallows {
+		shallow[h] = true
+	}
+	for _, h := range update.Unshallows {
+		delete(shallow, h)
+	}
+
+	var res []plumbing.Hash
+	for h := range shallow {
+		res = append(res, h)
+	}
+	plumbing.HashesSort(res)
+
+	if err := repo.Storer.SetShallow(res); err != nil {
+		return fmt.Errorf("failed to update shallow commits: %w", err)
+	}
+
+	// Git treats the repository as shallow if the file exists, even if empty.
+	if storage, ok := repo.Storer.(*filesystem.Storage); ok && len(res) == 0 {
+		file := filepath.Join(storage.Filesystem().Root(), "shallow")
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove shallow file: %w", err)
+		}
+	}
+	return nil
+}
+
+func hasObject(repo *git.Repository, hash plumbing.Hash) bool {
+	return repo.Storer.HasEncodedObject(hash) == nil
+}
@@ -0,0 +1,277 @@
+package checkout
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"chameth.com/actions/common"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+const (
+	lfsPointerVersion = "version https://git-lfs.github.com/spec/v1"
+	lfsMediaType      = "application/vnd.git-lfs+json"
+	lfsMaxPointerSize = 1024
+)
+
+type lfsObject struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+type lfsBatchRequest struct {
+	Operation string      `json:"operation"`
+	Transfers []string    `json:"transfers"`
+	Objects   []lfsObject `json:"objects"`
+}
+
+type lfsBatchResponse struct {
+	Objects []struct {
+		lfsObject
+		Actions struct {
+			Download *struct {
+				Href   string            `json:"href"`
+				Header map[string]string `json:"header"`
+			} `json:"download"`
+		} `json:"actions"`
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"objects"`
+}
+
+// fetchLFS downloads the objects referenced by any Git LFS pointer files in
+// the worktree, and writes their contents in place of the pointers.
+func fetchLFS(repo *git.Repository, remoteURL string, creds credentials) error {
+	pointers, err := lfsPointers(repo)
+	if err != nil {
+		return err
+	}
+	if len(pointers) == 0 {
+		slog.Debug("No LFS pointers found")
+		return nil
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to open worktree: %w", err)
+	}
+
+	var objects []lfsObject
+	for object := range pointers {
+		objects = append(objects, object)
+	}
+
+	endpoint := lfsEndpoint(remoteURL)
+	slog.Info("Fetching LFS objects", "count", len(objects), "endpoint", endpoint)
+
+	batch, err := lfsBatch(endpoint, creds, objects)
+	if err != nil {
+		return err
+	}
+
+	for _, object := range batch.Objects {
+		if object.Error != nil {
+			return fmt.Errorf("LFS object %s unavailable: %d %s", object.OID, object.Error.Code, object.Error.Message)
+		}
+		if object.Actions.Download == nil {
+			return fmt.Errorf("LFS server did not provide a download for object %s", object.OID)
+		}
+
+		content, err := lfsDownload(object.Actions.Download.Href, object.Actions.Download.Header, creds, object.lfsObject)
+		if err != nil {
+			return err
+		}
+
+		if err := storeLFSObject(repo, object.OID, content); err != nil {
+			return err
+		}
+
+		for _, path := range pointers[object.lfsObject] {
+			slog.Debug("Writing LFS object", "path", path, "oid", object.OID)
+			target := filepath.Join(worktree.Filesystem.Root(), filepath.FromSlash(path))
+			if err := os.WriteFile(target, content, 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", path, err)
+			}
+		}
+	}
+
+	slog.Info("Fetched LFS objects", "count", len(batch.Objects))
+	return nil
+}
+
+// lfsPointers finds files in the index whose content is an LFS pointer,
+// returning the paths that refer to each object.
+func lfsPointers(repo *git.Repository) (map[lfsObject][]string, error) {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	res := make(map[lfsObject][]string)
+	for _, entry := range idx.Entries {
+		if entry.SkipWorktree || (entry.Mode != filemode.Regular && entry.Mode != filemode.Executable) {
+			continue
+		}
+		if entry.Size > lfsMaxPointerSize || !hasObject(repo, entry.Hash) {
+			continue
+		}
+
+		blob, err := repo.BlobObject(entry.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", entry.Name, err)
+		}
+		r, err := blob.Reader()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", entry.Name, err)
+		}
+		data, err := io.ReadAll(io.LimitReader(r, lfsMaxPointerSize))
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", entry.Name, err)
+		}
+
+		if object, ok := parseLFSPointer(data); ok {
+			res[object] = append(res[object], entry.Name)
+		}
+	}
+	return res, nil
+}
+
+func parseLFSPointer(data []byte) (lfsObject, bool) {
+	var object lfsObject
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	if !scanner.Scan() || scanner.Text() != lfsPointerVersion {
+		return object, false
+	}
+
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), " ")
+		switch key {
+		case "oid":
+			object.OID, _ = strings.CutPrefix(value, "sha256:")
+		case "size":
+			object.Size, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+
+	if len(object.OID) != sha256.Size*2 || object.Size < 0 {
+		return object, false
+	}
+	return object, true
+}
+
+func lfsEndpoint(remoteURL string) string {
+	remoteURL = strings.TrimSuffix(remoteURL, "/")
+	if strings.HasSuffix(remoteURL, ".git") {
+		return remoteURL + "/info/lfs"
+	}
+	return remoteURL + ".git/info/lfs"
+}
+
+func lfsBatch(endpoint string, creds credentials, objects []lfsObject) (*lfsBatchResponse, error) {
+	body, err := json.Marshal(lfsBatchRequest{
+		Operation: "download",
+		Transfers: []string{"basic"},
+		Objects:   objects,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal LFS batch request: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", endpoint+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", lfsMediaType)
+	req.Header.Set("Content-Type", lfsMediaType)
+	creds.authorise(req)
+
+	// A download batch only reads, so is safe to retry.
+	resp, err := common.HTTPClient.Do(common.Repeatable(req))
+	if err != nil {
+		return nil, fmt.Errorf("LFS batch request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("LFS batch API returned status %d: %s", resp.StatusCode, string(data))
+	}
+
+	var batch lfsBatchResponse
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return nil, fmt.Errorf("failed to parse LFS batch response: %w", err)
+	}
+	return &batch, nil
+}
+
+func lfsDownload(href string, headers map[string]string, creds credentials, object lfsObject) ([]byte, error) {
+	req, err := http.NewRequest("GET", href, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if req.Header.Get("Authorization") == "" {
+		creds.authorise(req)
+	}
+
+	resp, err := common.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("LFS download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("LFS download of %s returned status %d", object.OID, resp.StatusCode)
+	}
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download LFS object %s: %w", object.OID, err)
+	}
+
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != object.OID || int64(len(content)) != object.Size {
+		return nil, fmt.Errorf("LFS object %s failed verification", object.OID)
+	}
+	return content, nil
+}
+
+// storeLFSObject saves an object in the repository's LFS store, where git-lfs
+// expects to find it.
+func storeLFSObject(repo *git.Repository, oid string, content []byte) error {
+	storage, ok := repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil
+	}
+
+	dir := filepath.Join(storage.Filesystem().Root(), "lfs", "objects", oid[0:2], oid[2:4])
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create LFS object store: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, oid), content, 0644); err != nil {
+		return fmt.Errorf("failed to store LFS object %s: %w", oid, err)
+	}
+	return nil
+}
@@ -0,0 +1,581 @@
+package checkout
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"chameth.com/actions/common"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// parseMerge converts a user-facing merge mode into either "local", "forge",
+// or empty to check out the head of the pull request.
+func parseMerge(mode string) (string, error) {
+	switch mode {
+	case "", "false":
+		return "", nil
+	case "local", "forge":
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown merge mode %q: expected local, forge or false", mode)
+	}
+}
+
+// pullRequestBase resolves the commit to fetch from the base repository for a
+// pull request: the forge's merge ref in forge mode, or the tip of the base
+// branch when merging locally.
+func pullRequestBase(ctx *common.Context, base *remote, mode string) (plumbing.Hash, error) {
+	if mode == "forge" {
+		ref := fmt.Sprintf("refs/pull/%d/merge", ctx.PullRequest)
+		hash, ok := base.refs[plumbing.ReferenceName(ref)]
+		if !ok {
+			return plumbing.ZeroHash, fmt.Errorf("forge did not provide %s: the pull request may have conflicts, or the forge may not support merge refs (try local mode)", ref)
+		}
+		return hash, nil
+	}
+
+	if ctx.BaseRef == "" {
+		return plumbing.ZeroHash, fmt.Errorf("base branch of pull request #%d is unknown", ctx.PullRequest)
+	}
+	return base.resolve(plumbing.NewBranchReferenceName(ctx.BaseRef).String())
+}
+
+// pullRequestHead finds a remote serving the head of the pull request, and
+// the commit to merge. The base repository's refs/pull/N/head is preferred, so
+// that private forks work with the job token; otherwise the fork is used.
+func pullRequestHead(ctx *common.Context, base *remote, creds credentials) (*remote, plumbing.Hash, error) {
+	ref := plumbing.ReferenceName(fmt.Sprintf("refs/pull/%d/head", ctx.PullRequest))
+	if hash, ok := base.refs[ref]; ok && (ctx.HeadSHA == "" || hash.String() == ctx.HeadSHA) {
+		return base, hash, nil
+	}
+
+	if ctx.HeadRepository == "" {
+		return nil, plumbing.ZeroHash, fmt.Errorf("head repository of pull request #%d is unknown", ctx.PullRequest)
+	}
+
+	slog.Debug("Fetching pull request head from fork", "repo", ctx.HeadRepository)
+	head, err := openRemote(ctx.RepoUrl(), creds)
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+
+	if ctx.HeadSHA != "" {
+		return head, plumbing.NewHash(ctx.HeadSHA), nil
+	}
+	hash, err := head.resolve(ctx.HeadRef)
+	return head, hash, err
+}
+
+// merger performs a three-way merge of two commits, fetching any objects that
+// are missing locally from its remotes.
+type merger struct {
+	repo      *git.Repository
+	remotes   []*remote
+	conflicts []string
+}
+
+// mergePullRequest merges the head commit into the base commit, deepening
+// shallow history as needed to find a merge base, and returns the resulting
+// merge commit, authored by signature. For partial clones, blobs from the head
+// that include accepts are fetched.
+func mergePullRequest(repo *git.Repository, base, head *remote, baseSha, headSha plumbing.Hash, depth int, filter packp.Filter, include func(string) bool, signature object.Signature, message string) (plumbing.Hash, error) {
+	slog.Info("Merging pull request", "base", baseSha, "head", headSha)
+	if err := head.fetch(repo, fetchRequest{wants: []plumbing.Hash{headSha}, depth: depth, filter: filter}); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to fetch pull request head: %w", err)
+	}
+	if !hasObject(repo, headSha) {
+		return plumbing.ZeroHash, fmt.Errorf("commit %s not found in remote", headSha)
+	}
+
+	mergeBase, err := findMergeBase(repo, base, head, baseSha, headSha, depth, filter)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	slog.Debug("Found merge base", "sha", mergeBase)
+
+	if mergeBase == headSha {
+		slog.Info("Pull request head is already merged into base")
+		return baseSha, nil
+	}
+
+	m := &merger{repo: repo, remotes: []*remote{base, head}}
+	commits := make([]*object.Commit, 3)
+	for i, hash := range []plumbing.Hash{mergeBase, baseSha, headSha} {
+		if commits[i], err = object.GetCommit(repo.Storer, hash); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to read commit %s: %w", hash, err)
+		}
+	}
+
+	tree, err := m.mergeTrees("", commits[0].TreeHash, commits[1].TreeHash, commits[2].TreeHash)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if len(m.conflicts) > 0 {
+		return plumbing.ZeroHash, fmt.Errorf("pull request has merge conflicts in %d file(s): %s", len(m.conflicts), strings.Join(m.conflicts, ", "))
+	}
+
+	if filter != "" && head != base {
+		// Objects only present in the fork must be fetched from it, as the
+		// worktree will later be hydrated from the base repository.
+		if err := hydrate(repo, head, headSha, include); err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	signature.When = time.Now()
+	commit := &object.Commit{
+		Author:       signature,
+		Committer:    signature,
+		Message:      message,
+		TreeHash:     tree,
+		ParentHashes: []plumbing.Hash{baseSha, headSha},
+	}
+
+	obj := repo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to encode merge commit: %w", err)
+	}
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to write merge commit: %w", err)
+	}
+
+	slog.Info("Pull request merged", "sha", hash)
+	return hash, nil
+}
+
+// findMergeBase finds the best common ancestor of two commits, doubling the
+// depth of shallow history until one is reachable.
+func findMergeBase(repo *git.Repository, base, head *remote, baseSha, headSha plumbing.Hash, depth int, filter packp.Filter) (plumbing.Hash, error) {
+	for {
+		shallows, err := repo.Storer.Shallow()
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to read shallow commits: %w", err)
+		}
+
+		candidates, err := mergeBases(repo, baseSha, headSha, shallows)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if len(candidates) > 0 {
+			if len(candidates) > 1 {
+				slog.Warn("Multiple merge bases found, using the first", "candidates", candidates)
+			}
+			return candidates[0], nil
+		}
+		if len(shallows) == 0 || depth == 0 {
+			return plumbing.ZeroHash, fmt.Errorf("pull request head %s shares no history with base %s", headSha, baseSha)
+		}
+
+		depth *= 2
+		slog.Debug("Deepening history to find a merge base", "depth", depth)
+		if err := base.fetch(repo, fetchRequest{wants: []plumbing.Hash{baseSha}, depth: depth, filter: filter}); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to deepen history: %w", err)
+		}
+		if err := head.fetch(repo, fetchRequest{wants: []plumbing.Hash{headSha}, depth: depth, filter: filter}); err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to deepen history: %w", err)
+		}
+
+		after, err := repo.Storer.Shallow()
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to read shallow commits: %w", err)
+		}
+		if slices.Equal(shallows, after) {
+			return plumbing.ZeroHash, fmt.Errorf("pull request head %s shares no history with base %s", headSha, baseSha)
+		}
+	}
+}
+
+// mergeBases returns the common ancestors of two commits that are not
+// themselves ancestors of another common ancestor, sorted by hash.
+func mergeBases(repo *git.Repository, a, b plumbing.Hash, shallows []plumbing.Hash) ([]plumbing.Hash, error) {
+	fromA, err := ancestors(repo, a, shallows, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var common []plumbing.Hash
+	_, err = ancestors(repo, b, shallows, func(hash plumbing.Hash) bool {
+		if fromA[hash] {
+			common = append(common, hash)
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var res []plumbing.Hash
+	for _, candidate := range common {
+		redundant := false
+		for _, other := range common {
+			if other == candidate {
+				continue
+			}
+			reached, err := reachesAny(repo, other, map[plumbing.Hash]bool{candidate: true}, shallows)
+			if err != nil {
+				return nil, err
+			}
+			if reached {
+				redundant = true
+				break
+			}
+		}
+		if !redundant {
+			res = append(res, candidate)
+		}
+	}
+
+	slices.SortFunc(res, func(x, y plumbing.Hash) int { return strings.Compare(x.String(), y.String()) })
+	return slices.Compact(res), nil
+}
+
+// ancestors walks the local history of a commit, stopping at shallow
+// boundaries and wherever visit returns false, and returns every commit seen.
+func ancestors(repo *git.Repository, from plumbing.Hash, shallows []plumbing.Hash, visit func(plumbing.Hash) bool) (map[plumbing.Hash]bool, error) {
+	seen := make(map[plumbing.Hash]bool)
+	queue := []plumbing.Hash{from}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+
+		if visit != nil && !visit(hash) {
+			continue
+		}
+		if slices.Contains(shallows, hash) {
+			continue
+		}
+
+		commit, err := object.GetCommit(repo.Storer, hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read commit %s: %w", hash, err)
+		}
+		queue = append(queue, commit.ParentHashes...)
+	}
+	return seen, nil
+}
+
+// mergeTrees merges the changes made to a tree on each side, returning the
+// hash of the resulting tree. Conflicting paths are recorded on the merger.
+func (m *merger) mergeTrees(dir string, base, ours, theirs plumbing.Hash) (plumbing.Hash, error) {
+	switch {
+	case ours == theirs, base == theirs:
+		return ours, nil
+	case base == ours:
+		return theirs, nil
+	}
+
+	entries := make([]map[string]object.TreeEntry, 3)
+	var names []string
+	for i, hash := range []plumbing.Hash{base, ours, theirs} {
+		tree, err := m.tree(hash)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		entries[i] = make(map[string]object.TreeEntry)
+		for _, entry := range tree.Entries {
+			entries[i][entry.Name] = entry
+			names = append(names, entry.Name)
+		}
+	}
+	slices.Sort(names)
+
+	var result []object.TreeEntry
+	for _, name := range slices.Compact(names) {
+		b, hasBase := entries[0][name]
+		o, hasOurs := entries[1][name]
+		t, hasTheirs := entries[2][name]
+		p := path.Join(dir, name)
+
+		switch {
+		case hasOurs == hasTheirs && o == t, hasBase == hasTheirs && b == t:
+			if hasOurs {
+				result = append(result, o)
+			}
+		case hasBase == hasOurs && b == o:
+			if hasTheirs {
+				result = append(result, t)
+			}
+		case hasOurs && hasTheirs && o.Mode == filemode.Dir && t.Mode == filemode.Dir && (!hasBase || b.Mode == filemode.Dir):
+			hash, err := m.mergeTrees(p, b.Hash, o.Hash, t.Hash)
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+			if hash != plumbing.ZeroHash {
+				result = append(result, object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: hash})
+			}
+		case hasOurs && hasTheirs && isFile(o.Mode) && isFile(t.Mode) && (!hasBase || isFile(b.Mode)):
+			entry, ok, err := m.mergeFiles(b, o, t, hasBase)
+			if err != nil {
+				return plumbing.ZeroHash, fmt.Errorf("failed to merge %s: %w", p, err)
+			}
+			if !ok {
+				m.conflicts = append(m.conflicts, p)
+				continue
+			}
+			result = append(result, entry)
+		default:
+			m.conflicts = append(m.conflicts, p)
+		}
+	}
+
+	if len(result) == 0 && dir != "" {
+		return plumbing.ZeroHash, nil
+	}
+	return m.writeTree(result)
+}
+
+// mergeFiles merges the contents of a file changed on both sides. It reports
+// false if the changes conflict.
+func (m *merger) mergeFiles(base, ours, theirs object.TreeEntry, hasBase bool) (object.TreeEntry, bool, error) {
+	mode := ours.Mode
+	if ours.Mode != theirs.Mode {
+		switch {
+		case hasBase && base.Mode == ours.Mode:
+			mode = theirs.Mode
+		case hasBase && base.Mode == theirs.Mode:
+			mode = ours.Mode
+		default:
+			return object.TreeEntry{}, false, nil
+		}
+	}
+
+	if ours.Hash == theirs.Hash {
+		return object.TreeEntry{Name: ours.Name, Mode: mode, Hash: ours.Hash}, true, nil
+	}
+
+	contents := make([][]byte, 3)
+	for i, entry := range []object.TreeEntry{base, ours, theirs} {
+		if i == 0 && !hasBase {
+			continue
+		}
+		data, err := m.blob(entry.Hash)
+		if err != nil {
+			return object.TreeEntry{}, false, err
+		}
+		if bytes.IndexByte(data, 0) >= 0 {
+			return object.TreeEntry{}, false, nil
+		}
+		contents[i] = data
+	}
+
+	merged, ok := mergeLines(string(contents[0]), string(contents[1]), string(contents[2]))
+	if !ok {
+		return object.TreeEntry{}, false, nil
+	}
+
+	hash, err := m.writeBlob([]byte(merged))
+	if err != nil {
+		return object.TreeEntry{}, false, err
+	}
+	return object.TreeEntry{Name: ours.Name, Mode: mode, Hash: hash}, true, nil
+}
+
+// tree reads a tree, fetching it if it was omitted by a partial clone. The
+// zero hash is treated as an empty tree.
+func (m *merger) tree(hash plumbing.Hash) (*object.Tree, error) {
+	if hash == plumbing.ZeroHash {
+		return &object.Tree{}, nil
+	}
+	if err := m.ensure(hash, packp.FilterBlobNone()); err != nil {
+		return nil, err
+	}
+	return object.GetTree(m.repo.Storer, hash)
+}
+
+// blob reads the contents of a blob, fetching it if it was omitted by a
+// partial clone.
+func (m *merger) blob(hash plumbing.Hash) ([]byte, error) {
+	if err := m.ensure(hash, ""); err != nil {
+		return nil, err
+	}
+
+	blob, err := object.GetBlob(m.repo.Storer, hash)
+	if err != nil {
+		return nil, err
+	}
+	r, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// ensure fetches an object from whichever remote has it, if it is missing.
+func (m *merger) ensure(hash plumbing.Hash, filter packp.Filter) error {
+	for _, r := range m.remotes {
+		if hasObject(m.repo, hash) {
+			return nil
+		}
+		if err := r.fetch(m.repo, fetchRequest{wants: []plumbing.Hash{hash}, filter: filter}); err != nil {
+			slog.Debug("Failed to fetch object", "hash", hash, "url", r.url, "error", err)
+		}
+	}
+	if !hasObject(m.repo, hash) {
+		return fmt.Errorf("object %s not found in remote", hash)
+	}
+	return nil
+}
+
+func (m *merger) writeTree(entries []object.TreeEntry) (plumbing.Hash, error) {
+	// Git orders tree entries as if directory names had a trailing slash.
+	slices.SortFunc(entries, func(a, b object.TreeEntry) int {
+		return strings.Compare(sortName(a), sortName(b))
+	})
+
+	obj := m.repo.Storer.NewEncodedObject()
+	if err := (&object.Tree{Entries: entries}).Encode(obj); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to encode tree: %w", err)
+	}
+	return m.repo.Storer.SetEncodedObject(obj)
+}
+
+func (m *merger) writeBlob(content []byte) (plumbing.Hash, error) {
+	obj := m.repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err := w.Write(content); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return m.repo.Storer.SetEncodedObject(obj)
+}
+
+func sortName(entry object.TreeEntry) string {
+	if entry.Mode == filemode.Dir {
+		return entry.Name + "/"
+	}
+	return entry.Name
+}
+
+func isFile(mode filemode.FileMode) bool {
+	return mode == filemode.Regular || mode == filemode.Executable || mode == filemode.Deprecated
+}
+
+// hunk replaces the lines [start, end) of a base text.
+type hunk struct {
+	start, end int
+	lines      []string
+}
+
+// mergeLines performs a line-based three-way merge. Changes that overlap or
+// touch on both sides conflict, unless both sides made the same change.
+func mergeLines(base, ours, theirs string) (string, bool) {
+	baseLines := splitLines(base)
+	a := hunks(base, ours)
+	b := hunks(base, theirs)
+
+	var out []string
+	pos := 0
+	for len(a) > 0 || len(b) > 0 {
+		start := len(baseLines)
+		if len(a) > 0 {
+			start = a[0].start
+		}
+		if len(b) > 0 && b[0].start < start {
+			start = b[0].start
+		}
+
+		end := start
+		var fromA, fromB []hunk
+	overlapping:
+		for {
+			switch {
+			case len(a) > 0 && a[0].start <= end:
+				end = max(end, a[0].end)
+				fromA, a = append(fromA, a[0]), a[1:]
+			case len(b) > 0 && b[0].start <= end:
+				end = max(end, b[0].end)
+				fromB, b = append(fromB, b[0]), b[1:]
+			default:
+				break overlapping
+			}
+		}
+
+		out = append(out, baseLines[pos:start]...)
+		ourRegion := applyHunks(baseLines, start, end, fromA)
+		theirRegion := applyHunks(baseLines, start, end, fromB)
+		switch {
+		case len(fromA) == 0:
+			out = append(out, theirRegion...)
+		case len(fromB) == 0, slices.Equal(ourRegion, theirRegion):
+			out = append(out, ourRegion...)
+		default:
+			return "", false
+		}
+		pos = end
+	}
+
+	out = append(out, baseLines[pos:]...)
+	return strings.Join(out, ""), true
+}
+
+// hunks returns the changes needed to turn base into other.
+func hunks(base, other string) []hunk {
+	var res []hunk
+	pos := 0
+	inHunk := false
+	for _, d := range diff.Do(base, other) {
+		lines := splitLines(d.Text)
+		if d.Type == diffmatchpatch.DiffEqual {
+			pos += len(lines)
+			inHunk = false
+			continue
+		}
+
+		if !inHunk {
+			res = append(res, hunk{start: pos, end: pos})
+			inHunk = true
+		}
+		current := &res[len(res)-1]
+		if d.Type == diffmatchpatch.DiffDelete {
+			pos += len(lines)
+			current.end = pos
+		} else {
+			current.lines = append(current.lines, lines...)
+		}
+	}
+	return res
+}
+
+func applyHunks(base []string, start, end int, changes []hunk) []string {
+	var res []string
+	pos := start
+	for _, h := range changes {
+		res = append(res, base[pos:h.start]...)
+		res = append(res, h.lines...)
+		pos = h.end
+	}
+	return append(res, base[pos:end]...)
+}
+
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,136 @@
+package checkout
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// parseFilter converts a user-facing filter mode into a partial clone filter
+// specification.
+func parseFilter(mode string) (packp.Filter, error) {
+	switch mode {
+	case "", "none":
+		return "", nil
+	case "blobless":
+		return packp.FilterBlobNone(), nil
+	case "treeless":
+		return packp.FilterTreeDepth(0), nil
+	default:
+		return "", fmt.Errorf("unknown filter %q: expected blobless, treeless or none", mode)
+	}
+}
+
+// configurePromisor records the remote as a promisor in the repository config
+// so that git can lazily fetch any objects that were filtered out.
+func configurePromisor(repo *git.Repository, remoteName string, filter packp.Filter) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("failed to read repository config: %w", err)
+	}
+
+	section := cfg.Raw.Section("remote").Subsection(remoteName)
+	section.SetOption("promisor", "true")
+	section.SetOption("partialclonefilter", string(filter))
+
+	if err := repo.SetConfig(cfg); err != nil {
+		return fmt.Errorf("failed to write repository config: %w", err)
+	}
+	return nil
+}
+
+// markPromisorPacks writes a .promisor marker alongside each pack in the
+// repository, telling git that objects they reference may be missing.
+func markPromisorPacks(repo *git.Repository) error {
+	storage, ok := repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil
+	}
+
+	packs, err := filepath.Glob(filepath.Join(storage.Filesystem().Root(), "objects", "pack", "*.pack"))
+	if err != nil {
+		return err
+	}
+
+	for _, pack := range packs {
+		marker := strings.TrimSuffix(pack, ".pack") + ".promisor"
+		if err := os.WriteFile(marker, nil, 0644); err != nil {
+			return fmt.Errorf("failed to mark promisor pack: %w", err)
+		}
+	}
+	return nil
+}
+
+// hydrate fetches any trees and blobs that are needed to check out the given
+// commit, but were omitted by a partial clone filter. Blobs are only fetched
+// for paths that include accepts.
+func hydrate(repo *git.Repository, remote *remote, commit plumbing.Hash, include func(path string) bool) error {
+	c, err := object.GetCommit(repo.Storer, commit)
+	if err != nil {
+		return fmt.Errorf("failed to read commit %s: %w", commit, err)
+	}
+
+	type pendingTree struct {
+		path string
+		hash plumbing.Hash
+	}
+
+	var blobs []plumbing.Hash
+	pending := []pendingTree{{hash: c.TreeHash}}
+	for len(pending) > 0 {
+		var missing []plumbing.Hash
+		for _, t := range pending {
+			if !hasObject(repo, t.hash) {
+				missing = append(missing, t.hash)
+			}
+		}
+
+		if len(missing) > 0 {
+			slog.Debug("Fetching missing trees", "count", len(missing))
+			if err := remote.fetch(repo, fetchRequest{wants: missing, filter: packp.FilterBlobNone()}); err != nil {
+				return fmt.Errorf("failed to fetch trees: %w", err)
+			}
+		}
+
+		var next []pendingTree
+		for _, t := range pending {
+			tree, err := object.GetTree(repo.Storer, t.hash)
+			if err != nil {
+				return fmt.Errorf("failed to read tree %s: %w", t.path, err)
+			}
+
+			for _, entry := range tree.Entries {
+				path := filepath.ToSlash(filepath.Join(t.path, entry.Name))
+				switch entry.Mode {
+				case filemode.Dir:
+					next = append(next, pendingTree{path: path, hash: entry.Hash})
+				case filemode.Submodule:
+					continue
+				default:
+					if include(path) && !hasObject(repo, entry.Hash) {
+						blobs = append(blobs, entry.Hash)
+					}
+				}
+			}
+		}
+		pending = next
+	}
+
+	if len(blobs) > 0 {
+		slog.Debug("Fetching missing blobs", "count", len(blobs))
+		if err := remote.fetch(repo, fetchRequest{wants: blobs}); err != nil {
+			return fmt.Errorf("failed to fetch blobs: %w", err)
+		}
+	}
+
+	return nil
+}
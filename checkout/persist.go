@@ -0,0 +1,104 @@
+package checkout
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+
+	"chameth.com/actions/common"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// credentialsState names the state recording where Run persisted
+// credentials, so that Post can remove them when the job ends.
+const credentialsState = "credentials_path"
+
+// extraHeaderSection returns the config subsection that scopes an extra HTTP
+// header to the forge, so that it is never sent to other hosts.
+func extraHeaderSection(ctx *common.Context) string {
+	return strings.TrimSuffix(ctx.ServerURL, "/") + "/"
+}
+
+// configureRepository sets the bot's identity in the repository's local
+// config and, if persist is set, an extra HTTP header carrying the token so
+// that later steps can push and fetch.
+func configureRepository(repo *git.Repository, ctx *common.Context, signature object.Signature, persist bool) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("failed to read repository config: %w", err)
+	}
+
+	cfg.User.Name = signature.Name
+	cfg.User.Email = signature.Email
+
+	if persist {
+		slog.Debug("Persisting credentials", "scope", extraHeaderSection(ctx))
+		cfg.Raw.Section("http").Subsection(extraHeaderSection(ctx)).
+			SetOption("extraheader", "AUTHORIZATION: Basic "+ctx.BasicAuth())
+	}
+
+	if err := repo.SetConfig(cfg); err != nil {
+		return fmt.Errorf("failed to write repository config: %w", err)
+	}
+	return nil
+}
+
+// Post removes any credentials persisted by Run in the main step. It runs as
+// a post-job hook, so that the token does not outlive the job.
+func Post(ctx *common.Context) error {
+	path := ctx.GetState(credentialsState)
+	if path == "" {
+		slog.Debug("No credentials were persisted")
+		return nil
+	}
+
+	if _, err := os.Stat(ctx.ResolvePath(path)); errors.Is(err, fs.ErrNotExist) {
+		slog.Info("Checkout no longer exists, nothing to clean up", "path", path)
+		return nil
+	}
+
+	return Cleanup(ctx, path)
+}
+
+// Cleanup removes credentials persisted by Run from the repository at the
+// given path, relative to the workspace.
+func Cleanup(ctx *common.Context, path string) error {
+	targetDir := ctx.ResolvePath(path)
+	slog.Info("Removing persisted credentials", "path", path)
+
+	repo, err := git.PlainOpen(targetDir)
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("failed to read repository config: %w", err)
+	}
+
+	section := cfg.Raw.Section("http")
+	if !section.HasSubsection(extraHeaderSection(ctx)) {
+		slog.Info("No persisted credentials found")
+		return nil
+	}
+
+	subsection := section.Subsection(extraHeaderSection(ctx))
+	subsection.RemoveOption("extraheader")
+	if len(subsection.Options) == 0 {
+		section.RemoveSubsection(extraHeaderSection(ctx))
+	}
+	if len(section.Options) == 0 && len(section.Subsections) == 0 {
+		cfg.Raw.RemoveSection("http")
+	}
+
+	if err := repo.SetConfig(cfg); err != nil {
+		return fmt.Errorf("failed to write repository config: %w", err)
+	}
+
+	slog.Info("Persisted credentials removed")
+	return nil
+}
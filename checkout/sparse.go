@@ -0,0 +1,207 @@
+package checkout
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+)
+
+// sparseCheckout restricts the paths that are materialised in the worktree.
+type sparseCheckout struct {
+	patterns []string
+	cone     bool
+	matcher  gitignore.Matcher
+}
+
+// newSparseCheckout parses the given patterns. In cone mode, each pattern is
+// a directory to include recursively, and files at the root and in parent
+// directories are always included. Otherwise, patterns are gitignore-style
+// with matching paths being included.
+func newSparseCheckout(patterns []string, cone bool) (*sparseCheckout, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	s := &sparseCheckout{cone: cone}
+	for _, p := range patterns {
+		if cone {
+			if strings.ContainsAny(p, "*?[\\!") {
+				return nil, fmt.Errorf("sparse pattern %q is not a directory: disable cone mode to use patterns", p)
+			}
+			p = path.Clean(strings.Trim(p, "/"))
+			if p == "." || strings.HasPrefix(p, "../") {
+				return nil, fmt.Errorf("invalid sparse directory %q", p)
+			}
+		}
+		s.patterns = append(s.patterns, p)
+	}
+
+	if !cone {
+		var parsed []gitignore.Pattern
+		for _, p := range s.patterns {
+			parsed = append(parsed, gitignore.ParsePattern(p, nil))
+		}
+		s.matcher = gitignore.NewMatcher(parsed)
+	}
+
+	return s, nil
+}
+
+// includes determines whether the file at the given path should be
+// materialised. A nil sparseCheckout includes everything.
+func (s *sparseCheckout) includes(name string) bool {
+	if s == nil {
+		return true
+	}
+
+	if !s.cone {
+		return s.matcher.Match(strings.Split(name, "/"), false)
+	}
+
+	dir := path.Dir(name)
+	if dir == "." {
+		return true
+	}
+
+	for _, p := range s.patterns {
+		if strings.HasPrefix(name, p+"/") || strings.HasPrefix(p+"/", dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// apply checks out the given commit, populating only the included paths, and
+// returns the paths that were materialised.
+func (s *sparseCheckout) apply(repo *git.Repository, sha plumbing.Hash) ([]string, error) {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open worktree: %w", err)
+	}
+
+	if err := worktree.Checkout(&git.CheckoutOptions{Hash: sha, Keep: true}); err != nil {
+		return nil, fmt.Errorf("git checkout failed: %w", err)
+	}
+
+	if err := worktree.Reset(&git.ResetOptions{Commit: sha, Mode: git.MixedReset}); err != nil {
+		return nil, fmt.Errorf("failed to populate index: %w", err)
+	}
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	var materialised []string
+	for _, entry := range idx.Entries {
+		entry.SkipWorktree = !s.includes(entry.Name)
+		if !entry.SkipWorktree {
+			materialised = append(materialised, entry.Name)
+		}
+	}
+
+	if err := repo.Storer.SetIndex(idx); err != nil {
+		return nil, fmt.Errorf("failed to write index: %w", err)
+	}
+
+	if err := worktree.Reset(&git.ResetOptions{Commit: sha, Mode: git.HardReset}); err != nil {
+		return nil, fmt.Errorf("git checkout failed: %w", err)
+	}
+
+	if err := s.configure(repo); err != nil {
+		return nil, err
+	}
+
+	slices.Sort(materialised)
+	return materialised, nil
+}
+
+// configure records the sparse checkout in the repository, so that later git
+// commands respect it.
+func (s *sparseCheckout) configure(repo *git.Repository) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("failed to read repository config: %w", err)
+	}
+
+	core := cfg.Raw.Section("core")
+	core.SetOption("sparseCheckout", "true")
+	core.SetOption("sparseCheckoutCone", fmt.Sprintf("%t", s.cone))
+
+	if err := repo.SetConfig(cfg); err != nil {
+		return fmt.Errorf("failed to write repository config: %w", err)
+	}
+
+	storage, ok := repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil
+	}
+
+	file := filepath.Join(storage.Filesystem().Root(), "info", "sparse-checkout")
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("failed to create sparse-checkout file: %w", err)
+	}
+	if err := os.WriteFile(file, []byte(s.definition()), 0644); err != nil {
+		return fmt.Errorf("failed to write sparse-checkout file: %w", err)
+	}
+	return nil
+}
+
+// definition renders the patterns in the format git uses for the
+// sparse-checkout file.
+func (s *sparseCheckout) definition() string {
+	if !s.cone {
+		return strings.Join(s.patterns, "\n") + "\n"
+	}
+
+	lines := []string{"/*", "!/*/"}
+	parents := make(map[string]bool)
+	for _, p := range slices.Sorted(slices.Values(s.patterns)) {
+		parts := strings.Split(p, "/")
+		for i := 1; i < len(parts); i++ {
+			parent := strings.Join(parts[:i], "/")
+			if !parents[parent] {
+				parents[parent] = true
+				lines = append(lines, fmt.Sprintf("/%s/", parent), fmt.Sprintf("!/%s/*/", parent))
+			}
+		}
+		lines = append(lines, fmt.Sprintf("/%s/", p))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// disableSparse removes any sparse checkout configuration left by a previous
+// checkout of the repository.
+func disableSparse(repo *git.Repository) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("failed to read repository config: %w", err)
+	}
+
+	core := cfg.Raw.Section("core")
+	if !core.HasOption("sparseCheckout") {
+		return nil
+	}
+	core.RemoveOption("sparseCheckout")
+	core.RemoveOption("sparseCheckoutCone")
+
+	if err := repo.SetConfig(cfg); err != nil {
+		return fmt.Errorf("failed to write repository config: %w", err)
+	}
+
+	if storage, ok := repo.Storer.(*filesystem.Storage); ok {
+		file := filepath.Join(storage.Filesystem().Root(), "info", "sparse-checkout")
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove sparse-checkout file: %w", err)
+		}
+	}
+	return nil
+}
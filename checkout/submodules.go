@@ -0,0 +1,136 @@
+package checkout
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+)
+
+// parseSubmodules converts a user-facing submodule mode into whether
+// submodules should be checked out, and whether to recurse into them.
+func parseSubmodules(mode string) (enabled, recursive bool, err error) {
+	switch mode {
+	case "", "false":
+		return false, false, nil
+	case "true":
+		return true, false, nil
+	case "recursive":
+		return true, true, nil
+	default:
+		return false, false, fmt.Errorf("unknown submodules mode %q: expected true, false or recursive", mode)
+	}
+}
+
+// updateSubmodules initialises each submodule listed in the repository's
+// .gitmodules, and checks out the commit recorded for it in the index.
+func updateSubmodules(repo *git.Repository, creds credentials, depth int, filter packp.Filter, recursive, lfs bool) error {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to open worktree: %w", err)
+	}
+
+	submodules, err := worktree.Submodules()
+	if err != nil {
+		return fmt.Errorf("failed to read submodules: %w", err)
+	}
+
+	slices.SortFunc(submodules, func(a, b *git.Submodule) int {
+		return strings.Compare(a.Config().Path, b.Config().Path)
+	})
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+
+	for i, submodule := range submodules {
+		cfg := submodule.Config()
+		if entry, err := idx.Entry(cfg.Path); err == nil && entry.SkipWorktree {
+			slog.Debug("Submodule is outside of the sparse checkout, skipping", "name", cfg.Name, "path", cfg.Path)
+			continue
+		}
+
+		slog.Info("Checking out submodule", "name", cfg.Name, "path", cfg.Path, "progress", fmt.Sprintf("%d/%d", i+1, len(submodules)))
+
+		if err := submodule.Init(); err != nil && !errors.Is(err, git.ErrSubmoduleAlreadyInitialized) {
+			return fmt.Errorf("failed to initialise submodule %s: %w", cfg.Name, err)
+		}
+
+		status, err := submodule.Status()
+		if err != nil {
+			return fmt.Errorf("failed to read status of submodule %s: %w", cfg.Name, err)
+		}
+		if status.Expected.IsZero() {
+			slog.Warn("Submodule is not recorded in the tree, skipping", "name", cfg.Name, "path", cfg.Path)
+			continue
+		}
+
+		subRepo, err := submodule.Repository()
+		if err != nil {
+			return fmt.Errorf("failed to open submodule %s: %w", cfg.Name, err)
+		}
+
+		if err := checkoutSubmodule(subRepo, creds, status.Expected, depth, filter); err != nil {
+			return fmt.Errorf("failed to check out submodule %s: %w", cfg.Name, err)
+		}
+
+		if recursive {
+			if err := updateSubmodules(subRepo, creds, depth, filter, recursive, lfs); err != nil {
+				return err
+			}
+		}
+
+		if lfs {
+			url, err := remoteURL(subRepo)
+			if err != nil {
+				return err
+			}
+			if err := fetchLFS(subRepo, url, creds); err != nil {
+				return fmt.Errorf("failed to fetch LFS objects for submodule %s: %w", cfg.Name, err)
+			}
+		}
+
+		slog.Info("Submodule checked out", "name", cfg.Name, "path", cfg.Path, "sha", status.Expected)
+	}
+
+	return nil
+}
+
+func checkoutSubmodule(repo *git.Repository, creds credentials, sha plumbing.Hash, depth int, filter packp.Filter) error {
+	url, err := remoteURL(repo)
+	if err != nil {
+		return err
+	}
+
+	if filter != "" {
+		if err := configurePromisor(repo, git.DefaultRemoteName, filter); err != nil {
+			return err
+		}
+	}
+
+	remote, err := openRemote(url, creds)
+	if err != nil {
+		return err
+	}
+
+	if err := fetchHistory(repo, remote, sha, Options{Depth: depth}, filter); err != nil {
+		return err
+	}
+
+	_, err = materialise(repo, remote, sha, filter, nil)
+	return err
+}
+
+func remoteURL(repo *git.Repository) (string, error) {
+	remote, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return "", fmt.Errorf("failed to read remote: %w", err)
+	}
+	return remote.Config().URLs[0], nil
+}
@@ -1,30 +1,117 @@
 package common
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 )
 
-var versionHeadingRe = regexp.MustCompile(`^## \[?v?([^\]\s]+)\]?`)
+// HeadingPresets are the named heading patterns, matched against headings in
+// ATX form even if they are underlined.
+var HeadingPresets = map[string]*regexp.Regexp{
+	// keepachangelog matches "## [1.2.0] - 2024-03-01" and "## v1.2.0".
+	"keepachangelog": regexp.MustCompile(`^## \[?v?([^\]\s]+)\]?`),
+	// plain matches a version at the start of a heading of any level, such
+	// as "# 1.2.0" or "v1.2.0" underlined with "=".
+	"plain": regexp.MustCompile(`^#+ \[?v?(\d+(?:\.\d+)+(?:[-+][0-9A-Za-z.+-]*)?)\]?(?:\s|$)`),
+	// version matches "Version 1.2.0" at any level, such as
+	// "### Version 1.2.0 (2024-03-01)".
+	"version": regexp.MustCompile(`^#+ (?i:version)\s+\[?v?([^\]\s()]+)\]?(?:\s+\((?P<date>[^)\s]+)\))?`),
+}
+
+// headingFormats render release headings for the presets that don't use the
+// Keep a Changelog format.
+var headingFormats = map[*regexp.Regexp]func(r *ChangelogRelease) string{
+	HeadingPresets["version"]: versionHeadingText,
+}
+
+// DefaultHeadingPreset is the preset used when no pattern is given.
+const DefaultHeadingPreset = "keepachangelog"
+
+var (
+	setextUnderlineRe = regexp.MustCompile(`^ {0,3}(=+|-+)\s*$`)
+	versionHeadingRe  = HeadingPresets[DefaultHeadingPreset]
+)
+
+// ParseHeadingPattern returns the named preset, or compiles a pattern that
+// captures the version in its first or "version" group, and optionally "date".
+func ParseHeadingPattern(value string) (*regexp.Regexp, error) {
+	if value == "" {
+		value = DefaultHeadingPreset
+	}
+	if re, ok := HeadingPresets[value]; ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid heading pattern %q: %w", value, err)
+	}
+	if re.NumSubexp() == 0 {
+		return nil, fmt.Errorf("invalid heading pattern %q: must capture the version in a group", value)
+	}
+	return re, nil
+}
 
-func (c *Context) Changelog(filename string, versions ...string) (string, error) {
+// HeadingPattern declares an input naming a heading preset or giving a
+// custom pattern, as understood by ParseHeadingPattern.
+func (c *Command) HeadingPattern(name, def, description string) *Input[*regexp.Regexp] {
+	return declare(c, InputSpec{Name: name, Description: description, Kind: KindString, Default: def},
+		func(_ *Context, raw string) (*regexp.Regexp, error) { return ParseHeadingPattern(raw) })
+}
+
+// Changelog returns the section for the first of the versions the changelog has.
+func (c *Context) Changelog(filename string, pattern *regexp.Regexp, versions ...string) (string, error) {
 	content, err := os.ReadFile(c.ResolvePath(filename))
 	if err != nil {
 		return "", fmt.Errorf("failed to read changelog: %w", err)
 	}
-	return FindChangelogSection(string(content), versions...), nil
+	return FindChangelogSectionMatching(string(content), pattern, versions...), nil
 }
 
+// ReleaseNotes returns the changelog section, as Changelog does, or else notes
+// generated from the Conventional Commits since the previous tag.
+func (c *Context) ReleaseNotes(filename string, pattern *regexp.Regexp, versions ...string) (string, error) {
+	section, err := c.Changelog(filename, pattern, versions...)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	if section != "" {
+		return section, nil
+	}
+
+	generated, genErr := GenerateChangelog(filepath.Dir(c.ResolvePath(filename)), c.SHA)
+	if genErr != nil {
+		return "", errors.Join(err, fmt.Errorf("failed to generate changelog from commits: %w", genErr))
+	}
+	if generated == "" {
+		return "", err
+	}
+
+	slog.Info("Generated changelog from commits", "versions", versions)
+	return generated, nil
+}
+
+// FindChangelogSection returns the section of a Keep a Changelog formatted
+// changelog for the first of the versions it has.
 func FindChangelogSection(content string, versions ...string) string {
-	normalized := make([]string, len(versions))
-	for i, v := range versions {
-		normalized[i] = strings.TrimPrefix(v, "v")
+	return FindChangelogSectionMatching(content, versionHeadingRe, versions...)
+}
+
+// FindChangelogSectionMatching returns the section for the first of the
+// versions, up to the next heading of the same or a higher level.
+func FindChangelogSectionMatching(content string, pattern *regexp.Regexp, versions ...string) string {
+	if pattern == nil {
+		pattern = versionHeadingRe
 	}
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
 
-	for _, target := range normalized {
-		if section := extractSection(content, target); section != "" {
+	for _, v := range versions {
+		if section := extractSection(lines, pattern, strings.TrimPrefix(v, "v")); section != "" {
 			return section
 		}
 	}
@@ -32,26 +119,86 @@ func FindChangelogSection(content string, versions ...string) string {
 	return ""
 }
 
-func extractSection(content, target string) string {
-	lines := strings.Split(content, "\n")
+func extractSection(lines []string, pattern *regexp.Regexp, target string) string {
 	var sectionLines []string
-	found := false
+	// level is the level of the version's heading, or zero until it's found.
+	level := 0
+	fenced := false
 
-	for _, line := range lines {
-		matches := versionHeadingRe.FindStringSubmatch(line)
-		if len(matches) > 1 {
-			if found {
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if fenceRe.MatchString(line) {
+			fenced = !fenced
+		} else if headingLevel, text := changelogHeading(lines, i); !fenced && headingLevel > 0 {
+			if level > 0 && headingLevel <= level {
 				break
 			}
-			if matches[1] == target {
-				found = true
+			if level == 0 {
+				if headingVersion(pattern, headingLevel, text) == target {
+					level = headingLevel
+					if !atxHeadingRe.MatchString(line) {
+						// Skip the underline of a setext heading.
+						i++
+					}
+				}
+				continue
 			}
-			continue
 		}
-		if found {
+		if level > 0 {
 			sectionLines = append(sectionLines, line)
 		}
 	}
 
 	return strings.Trim(strings.Join(sectionLines, "\n"), "\n")
 }
+
+// changelogHeading returns the level and text of an ATX or setext heading.
+func changelogHeading(lines []string, i int) (int, string) {
+	if matches := atxHeadingRe.FindStringSubmatch(lines[i]); matches != nil {
+		return len(matches[1]), matches[2]
+	}
+
+	line := lines[i]
+	if i+1 >= len(lines) || strings.TrimSpace(line) == "" || interruptsParagraph(line) || strings.HasPrefix(line, "    ") {
+		return 0, ""
+	}
+	if i > 0 && strings.TrimSpace(lines[i-1]) != "" && !atxHeadingRe.MatchString(lines[i-1]) {
+		// Only the last line of a paragraph can be underlined, and changelog
+		// headings are a single line.
+		return 0, ""
+	}
+	if matches := setextUnderlineRe.FindStringSubmatch(lines[i+1]); matches != nil {
+		if matches[1][0] == '=' {
+			return 1, strings.TrimSpace(line)
+		}
+		return 2, strings.TrimSpace(line)
+	}
+	return 0, ""
+}
+
+// headingVersion returns the version the pattern captures from the heading,
+// without any "v" prefix, or an empty string if it doesn't match.
+func headingVersion(pattern *regexp.Regexp, level int, text string) string {
+	matches := pattern.FindStringSubmatch(strings.Repeat("#", level) + " " + text)
+	if matches == nil {
+		return ""
+	}
+	group := pattern.SubexpIndex("version")
+	if group < 0 {
+		group = 1
+	}
+	return strings.TrimPrefix(matches[group], "v")
+}
+
+// headingDate returns the date the pattern captures from the heading in a
+// group named "date", or an empty string if it doesn't have one.
+func headingDate(pattern *regexp.Regexp, level int, text string) string {
+	group := pattern.SubexpIndex("date")
+	if group < 0 {
+		return ""
+	}
+	if matches := pattern.FindStringSubmatch(strings.Repeat("#", level) + " " + text); matches != nil {
+		return matches[group]
+	}
+	return ""
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const testChangelog = `# Changelog
@@ -138,3 +139,123 @@ func TestFindChangelogSection(t *testing.T) {
 		})
 	}
 }
+
+func TestFindChangelogSectionMatching(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		content  string
+		versions []string
+		expected string
+	}{
+		{
+			name:     "default preset",
+			content:  testChangelog,
+			versions: []string{"1.1.0"},
+			expected: "### Added\n- Feature A",
+		},
+		{
+			name:     "default preset ends at sibling headings",
+			content:  "## 1.0.0\n\n### Added\n- Thing\n\n## Links\n\nElsewhere\n",
+			versions: []string{"1.0.0"},
+			expected: "### Added\n- Thing",
+		},
+		{
+			name:     "default preset ignores other levels",
+			content:  "# 1.0.0\n\nWrong\n\n## 1.0.0\n\nRight\n",
+			versions: []string{"1.0.0"},
+			expected: "Right",
+		},
+		{
+			name:     "plain level one headings",
+			pattern:  "plain",
+			content:  "# Changelog\n\n# 1.2.0\n\n## Added\n- Thing\n\n### Details\nMore\n\n# 1.1.0\n\n- Older\n",
+			versions: []string{"v1.2.0"},
+			expected: "## Added\n- Thing\n\n### Details\nMore",
+		},
+		{
+			name:     "plain with date",
+			pattern:  "plain",
+			content:  "## v1.2.0 - 2024-03-01\n\nNew\n\n## v1.1.0 - 2024-02-01\n\nOld\n",
+			versions: []string{"1.1.0"},
+			expected: "Old",
+		},
+		{
+			name:     "plain setext headings",
+			pattern:  "plain",
+			content:  "v1.2.0\n======\n\nAdded\n-----\n\n- Thing\n\nv1.1.0\n======\n\n- Older\n",
+			versions: []string{"1.2.0"},
+			expected: "Added\n-----\n\n- Thing",
+		},
+		{
+			name:     "plain ignores prose",
+			pattern:  "plain",
+			content:  "# 1.2.0\n\nSee 1.1.0 for details\n---\n\n# 1.1.0\n\nOld\n",
+			versions: []string{"1.1.0"},
+			expected: "Old",
+		},
+		{
+			name:     "version headings",
+			pattern:  "version",
+			content:  "## Releases\n\n### Version 1.2.0 (2024-03-01)\n\n#### Fixed\n- Bug\n\n### Version 1.1.0 (2024-02-01)\n\n- Older\n",
+			versions: []string{"1.2.0"},
+			expected: "#### Fixed\n- Bug",
+		},
+		{
+			name:     "version headings end at higher levels",
+			pattern:  "version",
+			content:  "### version v1.2.0\n\n- Thing\n\n## Appendix\n\nUnrelated\n",
+			versions: []string{"1.2.0"},
+			expected: "- Thing",
+		},
+		{
+			name:     "custom pattern with named group",
+			pattern:  `^## Release (?P<name>\S+) \((?P<version>[\d.]+)\)`,
+			content:  "## Release Banana (2.0.0)\n\nYellow\n\n## Release Apple (1.0.0)\n\nRed\n",
+			versions: []string{"1.0.0"},
+			expected: "Red",
+		},
+		{
+			name:     "headings in code blocks",
+			content:  "## 1.0.0\n\n```sh\n## 2.0.0\n```\n\n## 0.9.0\n",
+			versions: []string{"1.0.0"},
+			expected: "```sh\n## 2.0.0\n```",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, err := ParseHeadingPattern(tt.pattern)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, FindChangelogSectionMatching(tt.content, pattern, tt.versions...))
+		})
+	}
+
+	assert.Equal(t, "Right", FindChangelogSectionMatching("## 1.0.0\r\n\r\nRight\r\n", nil, "1.0.0"))
+}
+
+func TestParseHeadingPattern(t *testing.T) {
+	pattern, err := ParseHeadingPattern("")
+	require.NoError(t, err)
+	assert.Equal(t, HeadingPresets[DefaultHeadingPreset], pattern)
+
+	pattern, err = ParseHeadingPattern("version")
+	require.NoError(t, err)
+	assert.Equal(t, HeadingPresets["version"], pattern)
+
+	_, err = ParseHeadingPattern("^## (")
+	assert.ErrorContains(t, err, `invalid heading pattern "^## ("`)
+
+	_, err = ParseHeadingPattern("^## .*")
+	assert.EqualError(t, err, `invalid heading pattern "^## .*": must capture the version in a group`)
+}
+
+func TestCommand_HeadingPattern(t *testing.T) {
+	c := NewCommand("test", "Test command")
+	preset := c.HeadingPattern("preset", "keepachangelog", "Preset")
+	custom := c.HeadingPattern("custom", "keepachangelog", "Custom")
+
+	require.NoError(t, loadInputs(c, &Context{}, `-custom=^# v(\S+)`))
+	assert.Equal(t, HeadingPresets["keepachangelog"], preset.Value())
+	assert.Equal(t, `^# v(\S+)`, custom.Value().String())
+}
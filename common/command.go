@@ -0,0 +1,317 @@
+package common
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// InputKind describes how an input's value is interpreted.
+type InputKind string
+
+const (
+	KindString InputKind = "string"
+	KindBool   InputKind = "bool"
+	KindInt    InputKind = "int"
+	// KindList is split on commas and newlines, ignoring empty entries.
+	KindList InputKind = "list"
+	// KindPath is resolved relative to the workspace, unless empty.
+	KindPath InputKind = "path"
+	// KindSecret is read from an environment variable and masked.
+	KindSecret InputKind = "secret"
+)
+
+// InputSpec describes an input to an action.
+type InputSpec struct {
+	Name        string
+	Description string
+	Kind        InputKind
+	Default     string
+	Required    bool
+	// Env is the environment variable a secret is read from.
+	Env string
+}
+
+// Input is a typed input declared on a Command.
+type Input[T any] struct {
+	spec  InputSpec
+	raw   string
+	value T
+	parse func(ctx *Context, raw string) (T, error)
+}
+
+// Required marks the input as needing a non-empty value.
+func (i *Input[T]) Required() *Input[T] {
+	i.spec.Required = true
+	return i
+}
+
+// Value returns the parsed value of the input.
+func (i *Input[T]) Value() T {
+	return i.value
+}
+
+// Spec describes the input.
+func (i *Input[T]) Spec() InputSpec {
+	return i.spec
+}
+
+func (i *Input[T]) String() string {
+	return i.raw
+}
+
+func (i *Input[T]) Set(value string) error {
+	i.raw = value
+	return nil
+}
+
+func (i *Input[T]) IsBoolFlag() bool {
+	return i.spec.Kind == KindBool
+}
+
+func (i *Input[T]) load(ctx *Context) error {
+	if i.spec.Kind == KindSecret {
+		if i.raw == "" {
+			i.raw = os.Getenv(i.spec.Env)
+		}
+		ctx.AddMask(i.raw)
+	}
+
+	if i.spec.Required && strings.TrimSpace(i.raw) == "" {
+		if i.spec.Kind == KindSecret {
+			return fmt.Errorf("input %s is required (set %s)", i.spec.Name, i.spec.Env)
+		}
+		return fmt.Errorf("input %s is required", i.spec.Name)
+	}
+
+	value, err := i.parse(ctx, i.raw)
+	if err != nil {
+		return fmt.Errorf("invalid value for input %s: %w", i.spec.Name, err)
+	}
+	i.value = value
+	return nil
+}
+
+// OutputSpec describes an output of an action.
+type OutputSpec struct {
+	Name        string
+	Description string
+}
+
+type input interface {
+	flag.Value
+	Spec() InputSpec
+	load(ctx *Context) error
+}
+
+// Command parses an action's inputs, runs it and reports any error.
+type Command struct {
+	// Name is the name of the action, matching its directory.
+	Name string
+	// Description summarises what the action does.
+	Description string
+	// Run performs the action.
+	Run func(ctx *Context) error
+	// Post, if set, runs as a post-job hook. See IsPost.
+	Post func(ctx *Context) error
+
+	inputs  []input
+	outputs []OutputSpec
+	debug   *Input[bool]
+}
+
+// NewCommand creates a command with the debug input every action provides.
+func NewCommand(name, description string) *Command {
+	c := &Command{Name: name, Description: description}
+	c.debug = c.Bool("debug", false, "Enable debug logging")
+	return c
+}
+
+// Inputs describes the inputs declared on the command, in order.
+func (c *Command) Inputs() []InputSpec {
+	res := make([]InputSpec, len(c.inputs))
+	for i, in := range c.inputs {
+		res[i] = in.Spec()
+	}
+	return res
+}
+
+// Outputs describes the outputs declared on the command, in order.
+func (c *Command) Outputs() []OutputSpec {
+	return slices.Clone(c.outputs)
+}
+
+// Output declares an output that the action writes.
+func (c *Command) Output(name, description string) {
+	c.outputs = append(c.outputs, OutputSpec{Name: name, Description: description})
+}
+
+func (c *Command) String(name, def, description string) *Input[string] {
+	return declare(c, InputSpec{Name: name, Description: description, Kind: KindString, Default: def},
+		func(_ *Context, raw string) (string, error) { return raw, nil })
+}
+
+func (c *Command) Bool(name string, def bool, description string) *Input[bool] {
+	return declare(c, InputSpec{Name: name, Description: description, Kind: KindBool, Default: strconv.FormatBool(def)},
+		func(_ *Context, raw string) (bool, error) {
+			if raw == "" {
+				return false, nil
+			}
+			return strconv.ParseBool(raw)
+		})
+}
+
+func (c *Command) Int(name string, def int, description string) *Input[int] {
+	return declare(c, InputSpec{Name: name, Description: description, Kind: KindInt, Default: strconv.Itoa(def)},
+		func(_ *Context, raw string) (int, error) {
+			if raw == "" {
+				return 0, nil
+			}
+			return strconv.Atoi(raw)
+		})
+}
+
+func (c *Command) List(name, def, description string) *Input[[]string] {
+	return declare(c, InputSpec{Name: name, Description: description, Kind: KindList, Default: def},
+		func(_ *Context, raw string) ([]string, error) { return SplitList(raw), nil })
+}
+
+func (c *Command) Path(name, def, description string) *Input[string] {
+	return declare(c, InputSpec{Name: name, Description: description, Kind: KindPath, Default: def},
+		func(ctx *Context, raw string) (string, error) {
+			if raw == "" {
+				return "", nil
+			}
+			return ctx.ResolvePath(raw), nil
+		})
+}
+
+// Secret declares an input that is passed in the given environment variable.
+func (c *Command) Secret(name, env, description string) *Input[string] {
+	return declare(c, InputSpec{Name: name, Description: description, Kind: KindSecret, Env: env},
+		func(_ *Context, raw string) (string, error) { return raw, nil })
+}
+
+func declare[T any](c *Command, spec InputSpec, parse func(*Context, string) (T, error)) *Input[T] {
+	in := &Input[T]{spec: spec, raw: spec.Default, parse: parse}
+	c.inputs = append(c.inputs, in)
+	return in
+}
+
+// SplitList splits a list input on commas and newlines.
+func SplitList(input string) []string {
+	var res []string
+	for item := range strings.FieldsFuncSeq(input, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// Main runs the command with the process's arguments, and exits.
+func (c *Command) Main() {
+	os.Exit(c.Execute(os.Args[1:]))
+}
+
+// Execute runs the command, or its post-job hook, returning the exit code.
+func (c *Command) Execute(args []string) int {
+	return c.execute(args, IsPost())
+}
+
+// ExecutePost runs the command's post-job hook, returning the exit code.
+func (c *Command) ExecutePost(args []string) int {
+	return c.execute(args, true)
+}
+
+func (c *Command) execute(args []string, post bool) int {
+	fs := c.flagSet(os.Stderr)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	ctx, err := ContextFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	for _, in := range c.inputs {
+		if err := in.load(ctx); err != nil {
+			return c.fail(ctx, err)
+		}
+	}
+
+	ConfigureLogging(c.debug.Value())
+
+	run := c.Run
+	if post {
+		run = c.Post
+	}
+	if run == nil {
+		return 0
+	}
+
+	if err := run(ctx); err != nil {
+		return c.fail(ctx, err)
+	}
+	return 0
+}
+
+// Invoke runs the command in-process with an existing context, defaulting
+// any inputs that aren't given.
+func (c *Command) Invoke(ctx *Context, inputs map[string]string) error {
+	for name, value := range inputs {
+		i := slices.IndexFunc(c.inputs, func(in input) bool { return in.Spec().Name == name })
+		if i == -1 {
+			return fmt.Errorf("unknown input %q", name)
+		}
+		if err := c.inputs[i].Set(value); err != nil {
+			return err
+		}
+	}
+
+	for _, in := range c.inputs {
+		if err := in.load(ctx); err != nil {
+			return err
+		}
+	}
+
+	if c.Run == nil {
+		return nil
+	}
+	return c.Run(ctx)
+}
+
+func (c *Command) fail(ctx *Context, err error) int {
+	ctx.ReportError(err)
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	return 1
+}
+
+// flagSet creates flags for the command's inputs and local mode.
+func (c *Command) flagSet(output io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	for _, in := range c.inputs {
+		spec := in.Spec()
+		if spec.Kind == KindSecret {
+			continue
+		}
+		fs.Var(in, spec.Name, spec.Description)
+	}
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		if fs.Lookup(f.Name) == nil {
+			fs.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	return fs
+}
@@ -0,0 +1,164 @@
+package common
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadInputs parses args and loads the command's inputs, as Execute would.
+func loadInputs(c *Command, ctx *Context, args ...string) error {
+	if err := c.flagSet(io.Discard).Parse(args); err != nil {
+		return err
+	}
+	for _, in := range c.inputs {
+		if err := in.load(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestCommand_Inputs(t *testing.T) {
+	withSecrets(t)
+	t.Setenv("TEST_TOKEN", "s3cret")
+
+	c := NewCommand("test", "Test command")
+	name := c.String("name", "default", "A name")
+	force := c.Bool("force", false, "Force it")
+	depth := c.Int("depth", 1, "Depth")
+	tags := c.List("tags", "latest", "Tags")
+	dir := c.Path("dir", "src", "Directory")
+	empty := c.Path("empty", "", "Optional directory")
+	token := c.Secret("token", "TEST_TOKEN", "Token")
+
+	ctx := &Context{Workspace: "/workspace", Stdout: io.Discard}
+	require.NoError(t, loadInputs(c, ctx, "-force", "-depth=3", "-tags=v1, v1.2,\nlatest,"))
+
+	assert.Equal(t, "default", name.Value())
+	assert.True(t, force.Value())
+	assert.Equal(t, 3, depth.Value())
+	assert.Equal(t, []string{"v1", "v1.2", "latest"}, tags.Value())
+	assert.Equal(t, "/workspace/src", dir.Value())
+	assert.Equal(t, "", empty.Value())
+	assert.Equal(t, "s3cret", token.Value())
+	assert.Equal(t, "***", Redact("s3cret"))
+
+	assert.Equal(t, []InputSpec{
+		{Name: "debug", Description: "Enable debug logging", Kind: KindBool, Default: "false"},
+		{Name: "name", Description: "A name", Kind: KindString, Default: "default"},
+		{Name: "force", Description: "Force it", Kind: KindBool, Default: "false"},
+		{Name: "depth", Description: "Depth", Kind: KindInt, Default: "1"},
+		{Name: "tags", Description: "Tags", Kind: KindList, Default: "latest"},
+		{Name: "dir", Description: "Directory", Kind: KindPath, Default: "src"},
+		{Name: "empty", Description: "Optional directory", Kind: KindPath},
+		{Name: "token", Description: "Token", Kind: KindSecret, Env: "TEST_TOKEN"},
+	}, c.Inputs())
+}
+
+func TestCommand_InputErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		declare func(c *Command)
+		args    []string
+		err     string
+	}{
+		{
+			name:    "missing required flag",
+			declare: func(c *Command) { c.String("name", "", "A name").Required() },
+			err:     "input name is required",
+		},
+		{
+			name:    "blank required list",
+			declare: func(c *Command) { c.List("tags", "", "Tags").Required() },
+			args:    []string{"-tags= "},
+			err:     "input tags is required",
+		},
+		{
+			name:    "missing required secret",
+			declare: func(c *Command) { c.Secret("token", "TEST_MISSING_TOKEN", "Token").Required() },
+			err:     "input token is required (set TEST_MISSING_TOKEN)",
+		},
+		{
+			name:    "invalid bool",
+			declare: func(c *Command) { c.Bool("force", false, "Force it") },
+			args:    []string{"-force=maybe"},
+			err:     `invalid value for input force: strconv.ParseBool: parsing "maybe": invalid syntax`,
+		},
+		{
+			name:    "invalid int",
+			declare: func(c *Command) { c.Int("depth", 0, "Depth") },
+			args:    []string{"-depth=deep"},
+			err:     `invalid value for input depth: strconv.Atoi: parsing "deep": invalid syntax`,
+		},
+		{
+			name:    "invalid heading pattern",
+			declare: func(c *Command) { c.HeadingPattern("heading", "keepachangelog", "Heading") },
+			args:    []string{"-heading=^## .*"},
+			err:     `invalid value for input heading: invalid heading pattern "^## .*": must capture the version in a group`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCommand("test", "Test command")
+			tt.declare(c)
+			err := loadInputs(c, &Context{Workspace: "/workspace"}, tt.args...)
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestCommand_Execute(t *testing.T) {
+	t.Cleanup(func() {
+		*localMode = false
+		*localWorkspace = ""
+	})
+	workspace := t.TempDir()
+
+	var got string
+	c := NewCommand("test", "Test command")
+	dir := c.Path("dir", "src", "Directory")
+	c.Run = func(ctx *Context) error {
+		got = dir.Value()
+		return nil
+	}
+
+	assert.Equal(t, 0, c.Execute([]string{"-local", "-local-workspace", workspace, "-dir", "out"}))
+	assert.Equal(t, filepath.Join(workspace, "out"), got)
+
+	c.Run = func(ctx *Context) error { return errors.New("it broke") }
+	assert.Equal(t, 1, c.Execute([]string{"-local", "-local-workspace", workspace}))
+
+	assert.Equal(t, 2, c.Execute([]string{"-unknown"}))
+}
+
+func TestCommand_Invoke(t *testing.T) {
+	withSecrets(t)
+	t.Setenv("TEST_TOKEN", "from-env")
+
+	var gotName, gotToken string
+	var gotTags []string
+	c := NewCommand("test", "Test command")
+	name := c.String("name", "default", "A name")
+	tags := c.List("tags", "", "Tags").Required()
+	token := c.Secret("token", "TEST_TOKEN", "Token")
+	c.Run = func(ctx *Context) error {
+		gotName, gotTags, gotToken = name.Value(), tags.Value(), token.Value()
+		return nil
+	}
+
+	ctx := &Context{Workspace: "/workspace", Stdout: io.Discard}
+	require.NoError(t, c.Invoke(ctx, map[string]string{"tags": "v1,latest", "token": "given"}))
+	assert.Equal(t, "default", gotName)
+	assert.Equal(t, []string{"v1", "latest"}, gotTags)
+	assert.Equal(t, "given", gotToken)
+	assert.Equal(t, "***", Redact("given"))
+
+	assert.EqualError(t, NewCommand("test", "").Invoke(ctx, map[string]string{"missing": "x"}), `unknown input "missing"`)
+	assert.EqualError(t, c.Invoke(ctx, map[string]string{"tags": " "}), "input tags is required")
+}
@@ -0,0 +1,142 @@
+package common
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Annotation anchors an error, warning or notice to a location in a file.
+// All fields are optional.
+type Annotation struct {
+	Title     string
+	File      string
+	Line      int
+	EndLine   int
+	Column    int
+	EndColumn int
+}
+
+// AnnotatedError is an error that relates to a location in a file.
+type AnnotatedError struct {
+	Err        error
+	Annotation Annotation
+}
+
+func (e *AnnotatedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AnnotatedError) Unwrap() error {
+	return e.Err
+}
+
+// FileError anchors err to the given file and line. A line of zero refers to
+// the file as a whole.
+func FileError(err error, file string, line int) error {
+	return &AnnotatedError{Err: err, Annotation: Annotation{File: file, Line: line}}
+}
+
+// AddMask hides each line of the value in the forge's logs and our own.
+func (c *Context) AddMask(value string) {
+	for line := range strings.Lines(value) {
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			RegisterSecret(line)
+			c.command("add-mask", nil, line)
+		}
+	}
+}
+
+// StartGroup begins a collapsible group of log lines with the given title.
+func (c *Context) StartGroup(title string) {
+	c.command("group", nil, title)
+}
+
+// EndGroup ends the group started by StartGroup.
+func (c *Context) EndGroup() {
+	c.command("endgroup", nil, "")
+}
+
+// Error emits an error annotation.
+func (c *Context) Error(message string, a Annotation) {
+	c.command("error", a.properties(), message)
+}
+
+// Warning emits a warning annotation.
+func (c *Context) Warning(message string, a Annotation) {
+	c.command("warning", a.properties(), message)
+}
+
+// Notice emits a notice annotation.
+func (c *Context) Notice(message string, a Annotation) {
+	c.command("notice", a.properties(), message)
+}
+
+// ReportError emits an error annotation for err, anchored to a file if it
+// wraps an AnnotatedError.
+func (c *Context) ReportError(err error) {
+	var annotated *AnnotatedError
+	if errors.As(err, &annotated) {
+		c.Error(err.Error(), annotated.Annotation)
+		return
+	}
+	c.Error(err.Error(), Annotation{})
+}
+
+func (c *Context) command(name string, properties [][2]string, message string) {
+	var w io.Writer = os.Stdout
+	if c.Stdout != nil {
+		w = c.Stdout
+	}
+
+	var b strings.Builder
+	b.WriteString("::")
+	b.WriteString(name)
+	for i, p := range properties {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(p[0])
+		b.WriteByte('=')
+		b.WriteString(escapeProperty(p[1]))
+	}
+	b.WriteString("::")
+	b.WriteString(escapeData(message))
+	b.WriteByte('\n')
+
+	_, _ = io.WriteString(w, b.String())
+}
+
+func (a Annotation) properties() [][2]string {
+	var res [][2]string
+	add := func(key, value string) {
+		if value != "" {
+			res = append(res, [2]string{key, value})
+		}
+	}
+	addInt := func(key string, value int) {
+		if value > 0 {
+			add(key, strconv.Itoa(value))
+		}
+	}
+
+	add("title", a.Title)
+	add("file", a.File)
+	addInt("line", a.Line)
+	addInt("endLine", a.EndLine)
+	addInt("col", a.Column)
+	addInt("endColumn", a.EndColumn)
+	return res
+}
+
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -0,0 +1,80 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContext_Commands(t *testing.T) {
+	tests := []struct {
+		name     string
+		emit     func(ctx *Context)
+		expected string
+	}{
+		{
+			name:     "mask",
+			emit:     func(ctx *Context) { ctx.AddMask("s3cret") },
+			expected: "::add-mask::s3cret\n",
+		},
+		{
+			name:     "multi-line mask",
+			emit:     func(ctx *Context) { ctx.AddMask("line one\r\n\nline two\n") },
+			expected: "::add-mask::line one\n::add-mask::line two\n",
+		},
+		{
+			name:     "empty mask",
+			emit:     func(ctx *Context) { ctx.AddMask("") },
+			expected: "",
+		},
+		{
+			name: "group",
+			emit: func(ctx *Context) {
+				ctx.StartGroup("Building")
+				ctx.EndGroup()
+			},
+			expected: "::group::Building\n::endgroup::\n",
+		},
+		{
+			name:     "plain error",
+			emit:     func(ctx *Context) { ctx.Error("it broke", Annotation{}) },
+			expected: "::error::it broke\n",
+		},
+		{
+			name: "annotated warning",
+			emit: func(ctx *Context) {
+				ctx.Warning("check this", Annotation{Title: "Lint", File: "src/main.go", Line: 3, EndLine: 4, Column: 1, EndColumn: 10})
+			},
+			expected: "::warning title=Lint,file=src/main.go,line=3,endLine=4,col=1,endColumn=10::check this\n",
+		},
+		{
+			name:     "escaped notice",
+			emit:     func(ctx *Context) { ctx.Notice("100% done\nnext", Annotation{Title: "a: b, c"}) },
+			expected: "::notice title=a%3A b%2C c::100%25 done%0Anext\n",
+		},
+		{
+			name: "reported annotated error",
+			emit: func(ctx *Context) {
+				err := FileError(errors.New("## Interface: not found in Addon/Addon.toc"), "Addon/Addon.toc", 0)
+				ctx.ReportError(fmt.Errorf("failed to read interface: %w", err))
+			},
+			expected: "::error file=Addon/Addon.toc::failed to read interface: ## Interface: not found in Addon/Addon.toc\n",
+		},
+		{
+			name:     "reported error",
+			emit:     func(ctx *Context) { ctx.ReportError(errors.New("plain")) },
+			expected: "::error::plain\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.emit(&Context{Stdout: &buf})
+			assert.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
@@ -2,36 +2,59 @@ package common
 
 import (
 	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"maps"
+	"math/rand/v2"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 )
 
+var (
+	outputKeyRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+	envKeyRe    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Forge identifies the system running an action.
+type Forge string
+
+const (
+	ForgeGitHub  Forge = "github"
+	ForgeForgejo Forge = "forgejo"
+	ForgeGitea   Forge = "gitea"
+	// ForgeLocal is used when running outside a forge. See LocalConfig.
+	ForgeLocal Forge = "local"
+)
+
 type Context struct {
+	Forge          Forge
 	Workspace      string
 	Token          string
+	Actor          string
 	ServerURL      string
 	Repository     string
 	HeadRepository string
 	Ref            string
 	HeadRef        string
+	BaseRef        string
 	SHA            string
+	BaseSHA        string
+	HeadSHA        string
+	PullRequest    int
 	OutputFile     string
 	PathFile       string
 	EnvFile        string
-}
-
-type pullRequestEvent struct {
-	PullRequest struct {
-		Head struct {
-			Repo struct {
-				FullName string `json:"full_name"`
-			} `json:"repo"`
-			Ref string `json:"ref"`
-		} `json:"head"`
-	} `json:"pull_request"`
+	SummaryFile    string
+	StateFile      string
+	// Event is the payload of the event that triggered the workflow.
+	Event *Event
+	// Stdout receives workflow commands. Defaults to os.Stdout.
+	Stdout io.Writer
 }
 
 func (c *Context) BasicAuth() string {
@@ -53,6 +76,16 @@ func (c *Context) ResolvePath(path string) string {
 	return fmt.Sprintf("%s/%s", c.Workspace, path)
 }
 
+// WorkspacePath returns the path relative to the workspace, as annotations
+// expect, or unchanged if it's outside the workspace.
+func (c *Context) WorkspacePath(path string) string {
+	rel, err := filepath.Rel(c.Workspace, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
 func (c *Context) Tag() string {
 	if after, ok := strings.CutPrefix(c.Ref, "refs/tags/"); ok {
 		return after
@@ -61,19 +94,17 @@ func (c *Context) Tag() string {
 }
 
 func (c *Context) WriteOutput(m map[string]string) error {
-	f, err := os.OpenFile(c.OutputFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to open output file: %w", err)
-	}
-	defer f.Close()
-
-	for k, v := range m {
-		if _, err := fmt.Fprintf(f, "%s=%s\n", k, v); err != nil {
+	var b strings.Builder
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		if !outputKeyRe.MatchString(k) {
+			return fmt.Errorf("invalid output name %q", k)
+		}
+		if err := writeKeyValue(&b, k, m[k]); err != nil {
 			return fmt.Errorf("failed to write output: %w", err)
 		}
 	}
 
-	return nil
+	return appendFile(c.OutputFile, b.String(), "output")
 }
 
 func (c *Context) AddToPath(path string) error {
@@ -91,74 +122,163 @@ func (c *Context) AddToPath(path string) error {
 }
 
 func (c *Context) SetEnv(key, value string) error {
-	f, err := os.OpenFile(c.EnvFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if !envKeyRe.MatchString(key) {
+		return fmt.Errorf("invalid environment variable name %q", key)
+	}
+
+	var b strings.Builder
+	if err := writeKeyValue(&b, key, value); err != nil {
+		return fmt.Errorf("failed to write env: %w", err)
+	}
+
+	return appendFile(c.EnvFile, b.String(), "env")
+}
+
+// writeKeyValue writes a key and value, using a heredoc if it spans lines.
+func writeKeyValue(b *strings.Builder, key, value string) error {
+	if !strings.ContainsAny(value, "\r\n") {
+		fmt.Fprintf(b, "%s=%s\n", key, value)
+		return nil
+	}
+
+	for range 10 {
+		delimiter := fmt.Sprintf("ghadelimiter_%016x", rand.Uint64())
+		if !strings.Contains(value, delimiter) {
+			fmt.Fprintf(b, "%s<<%s\n%s\n%s\n", key, delimiter, value, delimiter)
+			return nil
+		}
+	}
+	return fmt.Errorf("unable to find a delimiter for %s", key)
+}
+
+// readKeyValues parses the contents of an output, env or state file, as
+// written by writeKeyValue. Later values replace earlier ones.
+func readKeyValues(content string) (map[string]string, error) {
+	res := make(map[string]string)
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if line == "" {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok && !strings.Contains(key, "<<") {
+			res[key] = value
+			continue
+		}
+		key, delimiter, ok := strings.Cut(line, "<<")
+		if !ok {
+			return nil, fmt.Errorf("invalid line %d: %q", i+1, line)
+		}
+		var value []string
+		for i++; i < len(lines) && lines[i] != delimiter; i++ {
+			value = append(value, lines[i])
+		}
+		if i == len(lines) {
+			return nil, fmt.Errorf("missing delimiter %q for %s", delimiter, key)
+		}
+		res[key] = strings.Join(value, "\n")
+	}
+	return res, nil
+}
+
+// ReadKeyValueFile parses an output, env or state file as written by the
+// Context. A missing file is treated as empty.
+func ReadKeyValueFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return readKeyValues(string(content))
+}
+
+func appendFile(path, content, kind string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to open env file: %w", err)
+		return fmt.Errorf("failed to open %s file: %w", kind, err)
 	}
 	defer f.Close()
 
-	if _, err := fmt.Fprintf(f, "%s=%s\n", key, value); err != nil {
-		return fmt.Errorf("failed to write env: %w", err)
+	if _, err := f.WriteString(content); err != nil {
+		return fmt.Errorf("failed to write %s: %w", kind, err)
 	}
 
 	return nil
 }
 
+// ContextFromEnv creates a context from the forge's environment, or from the
+// local flags if they were given.
 func ContextFromEnv() (*Context, error) {
+	if ctx, err := localContext(); ctx != nil || err != nil {
+		return ctx, err
+	}
 	if _, hasForgejoJob := os.LookupEnv("FORGEJO_JOB"); hasForgejoJob {
-		return contextFromEnv("FORGEJO")
+		return contextFromEnv(ForgeForgejo, "FORGEJO")
+	}
+	// Gitea's runner only provides the GITHUB_ variables, but marks itself
+	// with GITEA_ACTIONS.
+	if _, hasGiteaActions := os.LookupEnv("GITEA_ACTIONS"); hasGiteaActions {
+		return contextFromEnv(ForgeGitea, "GITHUB")
 	}
 	if _, hasGitHubJob := os.LookupEnv("GITHUB_JOB"); hasGitHubJob {
-		return contextFromEnv("GITHUB")
+		return contextFromEnv(ForgeGitHub, "GITHUB")
 	}
-	return nil, fmt.Errorf("unable to determine forge: neither FORGEJO_JOB nor GITHUB_JOB set")
+	return nil, fmt.Errorf("unable to determine forge: none of FORGEJO_JOB, GITEA_ACTIONS or GITHUB_JOB set (use -local to run outside a forge)")
 }
 
-func contextFromEnv(prefix string) (*Context, error) {
+func contextFromEnv(forge Forge, prefix string) (*Context, error) {
 	ctx := &Context{
-		Workspace:  lookupEnv(prefix, "WORKSPACE"),
-		Token:      lookupEnv(prefix, "TOKEN"),
-		ServerURL:  lookupEnv(prefix, "SERVER_URL"),
-		Repository: lookupEnv(prefix, "REPOSITORY"),
-		Ref:        lookupEnv(prefix, "REF"),
-		SHA:        lookupEnv(prefix, "SHA"),
-		OutputFile: lookupEnv(prefix, "OUTPUT"),
-		PathFile:   lookupEnv(prefix, "PATH"),
-		EnvFile:    lookupEnv(prefix, "ENV"),
-	}
-
-	eventName := lookupEnv(prefix, "EVENT_NAME")
-	if eventName == "pull_request" {
-		eventPath := lookupEnv(prefix, "EVENT_PATH")
-		if eventPath != "" {
-			headRepo, headRef, err := parsePullRequestEvent(eventPath)
-			if err != nil {
-				slog.Warn("Failed to parse pull request event, using base repository", "error", err)
-			} else {
-				ctx.HeadRepository = headRepo
-				ctx.HeadRef = headRef
-			}
-		}
+		Forge:       forge,
+		Workspace:   lookupEnv(prefix, "WORKSPACE"),
+		Token:       lookupEnv(prefix, "TOKEN"),
+		ServerURL:   lookupEnv(prefix, "SERVER_URL"),
+		Repository:  lookupEnv(prefix, "REPOSITORY"),
+		Ref:         lookupEnv(prefix, "REF"),
+		SHA:         lookupEnv(prefix, "SHA"),
+		OutputFile:  lookupEnv(prefix, "OUTPUT"),
+		PathFile:    lookupEnv(prefix, "PATH"),
+		EnvFile:     lookupEnv(prefix, "ENV"),
+		SummaryFile: lookupEnv(prefix, "STEP_SUMMARY"),
+		StateFile:   lookupEnv(prefix, "STATE"),
+	}
+
+	event, err := parseEvent(lookupEnv(prefix, "EVENT_NAME"), lookupEnv(prefix, "ACTOR"), lookupEnv(prefix, "EVENT_PATH"))
+	if err != nil {
+		slog.Warn("Failed to parse event payload", "event", event.Name, "error", err)
 	}
+	ctx.setEvent(event)
+	ctx.registerSecrets()
 
 	return ctx, nil
 }
 
-func lookupEnv(prefix, key string) string {
-	val, _ := os.LookupEnv(fmt.Sprintf("%s_%s", prefix, key))
-	return val
+// registerSecrets ensures the job token is never logged, whether raw or
+// encoded for basic auth.
+func (c *Context) registerSecrets() {
+	if c.Token != "" {
+		RegisterSecret(c.Token)
+		RegisterSecret(c.BasicAuth())
+	}
 }
 
-func parsePullRequestEvent(path string) (headRepo, headRef string, err error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to read event file: %w", err)
-	}
+// setEvent records the event. pull_request_target keeps the base repository,
+// so untrusted code isn't checked out alongside secrets.
+func (c *Context) setEvent(event *Event) {
+	c.Event = event
+	c.Actor = event.Actor
 
-	var event pullRequestEvent
-	if err := json.Unmarshal(data, &event); err != nil {
-		return "", "", fmt.Errorf("failed to parse event JSON: %w", err)
+	if pr := event.PullRequest; pr != nil && event.Name == "pull_request" {
+		c.HeadRepository = pr.PullRequest.Head.Repo.FullName
+		c.HeadRef = pr.PullRequest.Head.Ref
+		c.HeadSHA = pr.PullRequest.Head.SHA
+		c.BaseRef = pr.PullRequest.Base.Ref
+		c.BaseSHA = pr.PullRequest.Base.SHA
+		c.PullRequest = pr.PullRequest.Number
 	}
+}
 
-	return event.PullRequest.Head.Repo.FullName, event.PullRequest.Head.Ref, nil
+func lookupEnv(prefix, key string) string {
+	val, _ := os.LookupEnv(fmt.Sprintf("%s_%s", prefix, key))
+	return val
 }
@@ -0,0 +1,132 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var delimiterRe = regexp.MustCompile(`ghadelimiter_[0-9a-f]{16}`)
+
+func TestContext_WriteOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		outputs  map[string]string
+		expected string
+		err      string
+	}{
+		{
+			name:     "sorted single line values",
+			outputs:  map[string]string{"zebra": "1", "apple": "2", "mango-pie": ""},
+			expected: "apple=2\nmango-pie=\nzebra=1\n",
+		},
+		{
+			name:     "multiline value",
+			outputs:  map[string]string{"changelog": "### Added\n- Thing\n", "version": "1.0.0"},
+			expected: "changelog<<DELIM\n### Added\n- Thing\n\nDELIM\nversion=1.0.0\n",
+		},
+		{
+			name:     "value containing the delimiter prefix",
+			outputs:  map[string]string{"body": "ghadelimiter_\nEOF"},
+			expected: "body<<DELIM\nghadelimiter_\nEOF\nDELIM\n",
+		},
+		{
+			name:    "invalid key",
+			outputs: map[string]string{"ok": "1", "bad=key": "2"},
+			err:     `invalid output name "bad=key"`,
+		},
+		{
+			name:    "empty key",
+			outputs: map[string]string{"": "1"},
+			err:     `invalid output name ""`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &Context{OutputFile: filepath.Join(t.TempDir(), "output")}
+			err := ctx.WriteOutput(tt.outputs)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				assert.NoFileExists(t, ctx.OutputFile)
+				return
+			}
+			require.NoError(t, err)
+
+			content, err := os.ReadFile(ctx.OutputFile)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, delimiterRe.ReplaceAllString(string(content), "DELIM"))
+		})
+	}
+}
+
+func TestContext_SetEnv(t *testing.T) {
+	ctx := &Context{EnvFile: filepath.Join(t.TempDir(), "env")}
+	require.NoError(t, ctx.SetEnv("SINGLE", "value"))
+	require.NoError(t, ctx.SetEnv("MULTI", "one\r\ntwo"))
+	assert.EqualError(t, ctx.SetEnv("NOT-VALID", "value"), `invalid environment variable name "NOT-VALID"`)
+	assert.EqualError(t, ctx.SetEnv("1ST", "value"), `invalid environment variable name "1ST"`)
+
+	content, err := os.ReadFile(ctx.EnvFile)
+	require.NoError(t, err)
+	assert.Equal(t, "SINGLE=value\nMULTI<<DELIM\none\r\ntwo\nDELIM\n", delimiterRe.ReplaceAllString(string(content), "DELIM"))
+
+	delimiters := delimiterRe.FindAllString(string(content), -1)
+	require.Len(t, delimiters, 2)
+	assert.Equal(t, delimiters[0], delimiters[1])
+}
+
+func TestReadKeyValues(t *testing.T) {
+	var b strings.Builder
+	require.NoError(t, writeKeyValue(&b, "single", "value=with=equals"))
+	require.NoError(t, writeKeyValue(&b, "multi", "one\n\nthree"))
+	require.NoError(t, writeKeyValue(&b, "single", "replaced"))
+
+	values, err := readKeyValues(b.String())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"single": "replaced", "multi": "one\n\nthree"}, values)
+
+	_, err = readKeyValues("multi<<EOF\nunterminated\n")
+	assert.EqualError(t, err, `missing delimiter "EOF" for multi`)
+
+	_, err = readKeyValues("garbage\n")
+	assert.EqualError(t, err, `invalid line 1: "garbage"`)
+}
+
+func TestReadKeyValueFile(t *testing.T) {
+	ctx := &Context{OutputFile: filepath.Join(t.TempDir(), "output")}
+
+	values, err := ReadKeyValueFile(ctx.OutputFile)
+	require.NoError(t, err)
+	assert.Empty(t, values)
+
+	require.NoError(t, ctx.WriteOutput(map[string]string{"tags": "dev", "notes": "one\ntwo"}))
+	values, err = ReadKeyValueFile(ctx.OutputFile)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"tags": "dev", "notes": "one\ntwo"}, values)
+}
+
+func TestContext_WorkspacePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{name: "file in the workspace", path: "/github/workspace/MyAddon/MyAddon.toc", expected: "MyAddon/MyAddon.toc"},
+		{name: "resolved path", path: "/github/workspace/./MyAddon.toc", expected: "MyAddon.toc"},
+		{name: "outside the workspace", path: "/tmp/MyAddon.toc", expected: "/tmp/MyAddon.toc"},
+		{name: "sibling of the workspace", path: "/github/workspace-other/MyAddon.toc", expected: "/github/workspace-other/MyAddon.toc"},
+	}
+
+	ctx := &Context{Workspace: "/github/workspace"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ctx.WorkspacePath(tt.path))
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+var (
+	conventionalSubjectRe = regexp.MustCompile(`^([A-Za-z]+)(?:\(([^()]*)\))?(!)?: *(.+)$`)
+	breakingFooterRe      = regexp.MustCompile(`^BREAKING[ -]CHANGE: *(.*)$`)
+)
+
+// ConventionalCommit is a commit message following the Conventional Commits
+// specification, such as "feat(api)!: remove the v1 endpoints".
+type ConventionalCommit struct {
+	Hash        string
+	Type        string
+	Scope       string
+	Description string
+	// Breaking is set if the subject is marked with "!" or the message has a
+	// BREAKING CHANGE footer.
+	Breaking bool
+	// BreakingNote is the text of the BREAKING CHANGE footer, if any.
+	BreakingNote string
+}
+
+// ParseConventionalCommit parses a commit message, returning false if its
+// subject doesn't follow the Conventional Commits format.
+func ParseConventionalCommit(message string) (ConventionalCommit, bool) {
+	subject, body, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	matches := conventionalSubjectRe.FindStringSubmatch(strings.TrimSpace(subject))
+	if matches == nil {
+		return ConventionalCommit{}, false
+	}
+
+	commit := ConventionalCommit{
+		Type:        strings.ToLower(matches[1]),
+		Scope:       strings.TrimSpace(matches[2]),
+		Description: strings.TrimSpace(matches[4]),
+		Breaking:    matches[3] == "!",
+	}
+
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		footer := breakingFooterRe.FindStringSubmatch(strings.TrimSpace(line))
+		if footer == nil {
+			continue
+		}
+		// The note continues until the next blank line.
+		note := []string{footer[1]}
+		for _, next := range lines[i+1:] {
+			if strings.TrimSpace(next) == "" {
+				break
+			}
+			note = append(note, strings.TrimSpace(next))
+		}
+		commit.Breaking = true
+		commit.BreakingNote = strings.TrimSpace(strings.Join(note, " "))
+		break
+	}
+	return commit, true
+}
+
+// changelogSections maps commit types to changelog sections. Other types are
+// only listed if they're breaking.
+var changelogSections = []struct {
+	title string
+	types []string
+}{
+	{title: "Added", types: []string{"feat"}},
+	{title: "Changed", types: []string{"perf", "refactor", "revert"}},
+	{title: "Fixed", types: []string{"fix"}},
+}
+
+// FormatConventionalChangelog groups commits into Added, Changed and Fixed
+// sections, as a hand-written changelog would.
+func FormatConventionalChangelog(commits []ConventionalCommit) string {
+	entries := make(map[string][]string)
+	for _, commit := range commits {
+		title := "Changed"
+		listed := commit.Breaking
+		for _, section := range changelogSections {
+			if slices.Contains(section.types, commit.Type) {
+				title, listed = section.title, true
+				break
+			}
+		}
+		if listed {
+			entries[title] = append(entries[title], formatEntry(commit))
+		}
+	}
+
+	var b strings.Builder
+	for _, section := range changelogSections {
+		if len(entries[section.title]) == 0 {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "### %s\n", section.title)
+		for _, entry := range entries[section.title] {
+			b.WriteString(entry)
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func formatEntry(commit ConventionalCommit) string {
+	var b strings.Builder
+	b.WriteString("- ")
+	if commit.Breaking {
+		b.WriteString("**Breaking:** ")
+	}
+	if commit.Scope != "" {
+		fmt.Fprintf(&b, "**%s:** ", commit.Scope)
+	}
+	b.WriteString(commit.Description)
+	if commit.Hash != "" {
+		fmt.Fprintf(&b, " (%s)", commit.Hash[:min(len(commit.Hash), 7)])
+	}
+	b.WriteString("\n")
+	if commit.BreakingNote != "" && commit.BreakingNote != commit.Description {
+		fmt.Fprintf(&b, "  - %s\n", commit.BreakingNote)
+	}
+	return b.String()
+}
+
+// CommitsSinceTag returns the Conventional Commits since the last tag before
+// rev (or HEAD), oldest first.
+func CommitsSinceTag(dir, rev string) ([]ConventionalCommit, error) {
+	repo, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	if rev == "" {
+		rev = "HEAD"
+	}
+	start, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", rev, err)
+	}
+
+	tagged, err := TaggedCommits(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var commits []*object.Commit
+	seen := map[plumbing.Hash]bool{*start: true}
+	queue := []plumbing.Hash{*start}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+
+		commit, err := repo.CommitObject(hash)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			// The history is shallow, so this is as far back as we can go.
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read commit %s: %w", hash, err)
+		}
+		if hash != *start && tagged[hash] {
+			continue
+		}
+
+		commits = append(commits, commit)
+		for _, parent := range commit.ParentHashes {
+			if !seen[parent] {
+				seen[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+
+	slices.SortStableFunc(commits, func(a, b *object.Commit) int {
+		return a.Committer.When.Compare(b.Committer.When)
+	})
+
+	var res []ConventionalCommit
+	for _, commit := range commits {
+		if commit.NumParents() > 1 {
+			continue
+		}
+		if parsed, ok := ParseConventionalCommit(commit.Message); ok {
+			parsed.Hash = commit.Hash.String()
+			res = append(res, parsed)
+		}
+	}
+	return res, nil
+}
+
+// TaggedCommits returns the commits that tags point to, peeling annotated
+// tags. The commits themselves needn't be present, as in a shallow clone.
+func TaggedCommits(repo *git.Repository) (map[plumbing.Hash]bool, error) {
+	tags, err := repo.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+
+	res := make(map[plumbing.Hash]bool)
+	err = tags.ForEach(func(ref *plumbing.Reference) error {
+		hash := ref.Hash()
+		if tag, err := repo.TagObject(hash); err == nil {
+			if tag.TargetType != plumbing.CommitObject {
+				// Tags of trees or blobs don't mark a release.
+				return nil
+			}
+			hash = tag.Target
+		}
+		res[hash] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tags: %w", err)
+	}
+	return res, nil
+}
+
+// GenerateChangelog describes the Conventional Commits since the last tag.
+func GenerateChangelog(dir, rev string) (string, error) {
+	commits, err := CommitsSinceTag(dir, rev)
+	if err != nil {
+		return "", err
+	}
+	return FormatConventionalChangelog(commits), nil
+}
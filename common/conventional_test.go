@@ -0,0 +1,260 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConventionalCommit(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		expected ConventionalCommit
+		ok       bool
+	}{
+		{
+			name:     "simple",
+			message:  "feat: add widgets\n",
+			expected: ConventionalCommit{Type: "feat", Description: "add widgets"},
+			ok:       true,
+		},
+		{
+			name:     "scope",
+			message:  "fix(parser): handle empty input",
+			expected: ConventionalCommit{Type: "fix", Scope: "parser", Description: "handle empty input"},
+			ok:       true,
+		},
+		{
+			name:     "breaking marker",
+			message:  "Refactor(api)!: drop v1 endpoints",
+			expected: ConventionalCommit{Type: "refactor", Scope: "api", Description: "drop v1 endpoints", Breaking: true},
+			ok:       true,
+		},
+		{
+			name:    "breaking footer",
+			message: "feat: new config format\n\nLonger explanation.\n\nBREAKING CHANGE: the config file\nmust be rewritten\n\nRefs: #12",
+			expected: ConventionalCommit{
+				Type:         "feat",
+				Description:  "new config format",
+				Breaking:     true,
+				BreakingNote: "the config file must be rewritten",
+			},
+			ok: true,
+		},
+		{
+			name:     "breaking footer with hyphen",
+			message:  "chore: bump go\n\nBREAKING-CHANGE: requires Go 1.25",
+			expected: ConventionalCommit{Type: "chore", Description: "bump go", Breaking: true, BreakingNote: "requires Go 1.25"},
+			ok:       true,
+		},
+		{name: "not conventional", message: "Update README.md"},
+		{name: "merge", message: "Merge branch 'main' into feature"},
+		{name: "no description", message: "feat: "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, ok := ParseConventionalCommit(tt.message)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestFormatConventionalChangelog(t *testing.T) {
+	commits := []ConventionalCommit{
+		{Hash: "1111111111", Type: "fix", Scope: "ui", Description: "align buttons"},
+		{Hash: "2222222222", Type: "feat", Description: "add widgets"},
+		{Hash: "3333333333", Type: "docs", Description: "fix typo"},
+		{Hash: "4444444444", Type: "chore", Description: "require Go 1.25", Breaking: true},
+		{Hash: "5555555555", Type: "feat", Scope: "api", Description: "new config format", Breaking: true, BreakingNote: "rewrite your config"},
+		{Hash: "6666666666", Type: "perf", Description: "cache lookups"},
+	}
+
+	assert.Equal(t, `### Added
+- add widgets (2222222)
+- **Breaking:** **api:** new config format (5555555)
+  - rewrite your config
+
+### Changed
+- **Breaking:** require Go 1.25 (4444444)
+- cache lookups (6666666)
+
+### Fixed
+- **ui:** align buttons (1111111)`, FormatConventionalChangelog(commits))
+
+	assert.Equal(t, "", FormatConventionalChangelog([]ConventionalCommit{{Type: "docs", Description: "fix typo"}}))
+}
+
+// testRepository creates commits and tags in a repository in a temporary
+// directory.
+type testRepository struct {
+	t    *testing.T
+	dir  string
+	repo *git.Repository
+	when time.Time
+}
+
+func newTestRepository(t *testing.T) *testRepository {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+	return &testRepository{t: t, dir: dir, repo: repo, when: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (r *testRepository) commit(message string) plumbing.Hash {
+	r.t.Helper()
+	r.when = r.when.Add(time.Minute)
+	require.NoError(r.t, os.WriteFile(filepath.Join(r.dir, "file.txt"), []byte(message), 0644))
+
+	worktree, err := r.repo.Worktree()
+	require.NoError(r.t, err)
+	_, err = worktree.Add("file.txt")
+	require.NoError(r.t, err)
+	hash, err := worktree.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: "Test", Email: "test@example.com", When: r.when},
+	})
+	require.NoError(r.t, err)
+	return hash
+}
+
+func (r *testRepository) tag(name string, annotated bool) {
+	r.t.Helper()
+	head, err := r.repo.Head()
+	require.NoError(r.t, err)
+
+	var opts *git.CreateTagOptions
+	if annotated {
+		opts = &git.CreateTagOptions{
+			Tagger:  &object.Signature{Name: "Test", Email: "test@example.com", When: r.when},
+			Message: "Release " + name,
+		}
+	}
+	_, err = r.repo.CreateTag(name, head.Hash(), opts)
+	require.NoError(r.t, err)
+}
+
+func TestTaggedCommits(t *testing.T) {
+	r := newTestRepository(t)
+	first := r.commit("feat: initial release")
+	r.tag("v1.0.0", true)
+	second := r.commit("fix: first fix")
+	r.tag("v1.0.1", false)
+	r.commit("chore: untagged")
+
+	// A tag of a tree doesn't mark a commit.
+	commit, err := r.repo.CommitObject(second)
+	require.NoError(t, err)
+	_, err = r.repo.CreateTag("tree", commit.TreeHash, &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "Test", Email: "test@example.com", When: r.when},
+		Message: "A tree",
+	})
+	require.NoError(t, err)
+
+	tagged, err := TaggedCommits(r.repo)
+	require.NoError(t, err)
+	assert.Equal(t, map[plumbing.Hash]bool{first: true, second: true}, tagged)
+}
+
+func TestCommitsSinceTag(t *testing.T) {
+	r := newTestRepository(t)
+	r.commit("feat: initial release")
+	r.tag("v1.0.0", true)
+	r.commit("fix: first fix")
+	r.tag("v1.0.1", false)
+	r.commit("feat: shiny thing")
+	r.commit("Tidy up")
+	release := r.commit("fix(ui)!: redo layout")
+	r.tag("v1.1.0", true)
+	r.commit("feat: unreleased")
+
+	commits, err := CommitsSinceTag(r.dir, "v1.1.0")
+	require.NoError(t, err)
+	require.Len(t, commits, 2)
+	assert.Equal(t, "shiny thing", commits[0].Description)
+	assert.Equal(t, ConventionalCommit{Hash: release.String(), Type: "fix", Scope: "ui", Description: "redo layout", Breaking: true}, commits[1])
+
+	commits, err = CommitsSinceTag(filepath.Join(r.dir, "subdir"), "")
+	require.NoError(t, err)
+	require.Len(t, commits, 1)
+	assert.Equal(t, "unreleased", commits[0].Description)
+
+	commits, err = CommitsSinceTag(r.dir, "v1.0.0")
+	require.NoError(t, err)
+	require.Len(t, commits, 1)
+	assert.Equal(t, "initial release", commits[0].Description)
+
+	_, err = CommitsSinceTag(r.dir, "v9.9.9")
+	assert.ErrorContains(t, err, "failed to resolve v9.9.9")
+
+	_, err = CommitsSinceTag(t.TempDir(), "")
+	assert.ErrorContains(t, err, "failed to open repository")
+}
+
+func TestContext_ReleaseNotes(t *testing.T) {
+	r := newTestRepository(t)
+	r.commit("feat: initial release")
+	r.tag("v1.0.0", false)
+	r.commit("feat: add widgets")
+	sha := r.commit("fix: stop crashing")
+	require.NoError(t, os.WriteFile(filepath.Join(r.dir, "CHANGELOG.md"), []byte(testChangelog), 0644))
+
+	ctx := &Context{Workspace: r.dir, SHA: sha.String()}
+
+	notes, err := ctx.ReleaseNotes("CHANGELOG.md", nil, "v1.2.0")
+	require.NoError(t, err)
+	assert.Equal(t, "### Added\n- New feature X\n- New feature Y\n\n### Fixed\n- Bug fix Z", notes)
+
+	expected := "### Added\n- add widgets (" + shortHash(t, r, "HEAD~1") + ")\n\n### Fixed\n- stop crashing (" + sha.String()[:7] + ")"
+	notes, err = ctx.ReleaseNotes("CHANGELOG.md", nil, "v1.3.0")
+	require.NoError(t, err)
+	assert.Equal(t, expected, notes)
+
+	notes, err = ctx.ReleaseNotes("MISSING.md", nil, "v1.3.0")
+	require.NoError(t, err)
+	assert.Equal(t, expected, notes)
+
+	ctx.Workspace = t.TempDir()
+	_, err = ctx.ReleaseNotes("MISSING.md", nil, "v1.3.0")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.ErrorContains(t, err, "failed to generate changelog from commits: failed to open repository")
+
+	// A changelog without an entry, outside a repository, can't be described.
+	require.NoError(t, os.WriteFile(filepath.Join(ctx.Workspace, "CHANGELOG.md"), []byte(testChangelog), 0644))
+	_, err = ctx.ReleaseNotes("CHANGELOG.md", nil, "v1.3.0")
+	assert.ErrorContains(t, err, "failed to generate changelog from commits: failed to open repository")
+	assert.NotErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestContext_ReleaseNotes_NothingToSay(t *testing.T) {
+	r := newTestRepository(t)
+	r.commit("feat: initial release")
+	r.tag("v1.2.0", false)
+	sha := r.commit("chore: tidy up")
+	ctx := &Context{Workspace: r.dir, SHA: sha.String()}
+
+	// With no entry and no notable commits there are no notes, which is only
+	// an error if the changelog itself is missing.
+	require.NoError(t, os.WriteFile(filepath.Join(r.dir, "CHANGELOG.md"), []byte(testChangelog), 0644))
+	notes, err := ctx.ReleaseNotes("CHANGELOG.md", nil, "v1.3.0")
+	require.NoError(t, err)
+	assert.Empty(t, notes)
+
+	notes, err = ctx.ReleaseNotes("MISSING.md", nil, "v1.3.0")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Empty(t, notes)
+}
+
+func shortHash(t *testing.T, r *testRepository, rev string) string {
+	hash, err := r.repo.ResolveRevision(plumbing.Revision(rev))
+	require.NoError(t, err)
+	return hash.String()[:7]
+}
@@ -0,0 +1,265 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Event is the payload that triggered the workflow. Only the field matching
+// Name is set.
+type Event struct {
+	// Name is the name of the event, such as push or pull_request.
+	Name string
+	// Actor is the login of the user that triggered the event.
+	Actor string
+	// Raw is the unparsed payload.
+	Raw json.RawMessage
+
+	Push             *PushEvent
+	PullRequest      *PullRequestEvent
+	Release          *ReleaseEvent
+	WorkflowDispatch *WorkflowDispatchEvent
+	Schedule         *ScheduleEvent
+	Create           *CreateEvent
+}
+
+type User struct {
+	Login string `json:"login"`
+}
+
+type Repository struct {
+	FullName      string `json:"full_name"`
+	Name          string `json:"name"`
+	Owner         User   `json:"owner"`
+	DefaultBranch string `json:"default_branch"`
+	CloneURL      string `json:"clone_url"`
+	HTMLURL       string `json:"html_url"`
+	Private       bool   `json:"private"`
+	Fork          bool   `json:"fork"`
+}
+
+type Label struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+type CommitAuthor struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Username string `json:"username"`
+}
+
+type Commit struct {
+	ID        string       `json:"id"`
+	Message   string       `json:"message"`
+	Timestamp time.Time    `json:"timestamp"`
+	URL       string       `json:"url"`
+	Author    CommitAuthor `json:"author"`
+}
+
+// PushEvent is sent when commits or tags are pushed.
+type PushEvent struct {
+	Ref        string     `json:"ref"`
+	Before     string     `json:"before"`
+	After      string     `json:"after"`
+	BaseRef    string     `json:"base_ref"`
+	Created    bool       `json:"created"`
+	Deleted    bool       `json:"deleted"`
+	Forced     bool       `json:"forced"`
+	Compare    string     `json:"compare"`
+	Commits    []Commit   `json:"commits"`
+	HeadCommit *Commit    `json:"head_commit"`
+	Repository Repository `json:"repository"`
+	Sender     User       `json:"sender"`
+}
+
+// Branch is one side of a pull request.
+type Branch struct {
+	Label string     `json:"label"`
+	Ref   string     `json:"ref"`
+	SHA   string     `json:"sha"`
+	Repo  Repository `json:"repo"`
+}
+
+type PullRequest struct {
+	Number  int     `json:"number"`
+	Title   string  `json:"title"`
+	Body    string  `json:"body"`
+	State   string  `json:"state"`
+	Draft   bool    `json:"draft"`
+	Merged  bool    `json:"merged"`
+	HTMLURL string  `json:"html_url"`
+	User    User    `json:"user"`
+	Labels  []Label `json:"labels"`
+	Head    Branch  `json:"head"`
+	Base    Branch  `json:"base"`
+}
+
+// LabelNames returns the names of the labels applied to the pull request.
+func (p *PullRequest) LabelNames() []string {
+	res := make([]string, len(p.Labels))
+	for i, l := range p.Labels {
+		res[i] = l.Name
+	}
+	return res
+}
+
+// PullRequestEvent is sent for pull_request and pull_request_target events.
+type PullRequestEvent struct {
+	Action      string      `json:"action"`
+	Number      int         `json:"number"`
+	PullRequest PullRequest `json:"pull_request"`
+	// Label is the label that was added or removed.
+	Label      *Label     `json:"label"`
+	Repository Repository `json:"repository"`
+	Sender     User       `json:"sender"`
+}
+
+type Release struct {
+	ID              int64     `json:"id"`
+	TagName         string    `json:"tag_name"`
+	TargetCommitish string    `json:"target_commitish"`
+	Name            string    `json:"name"`
+	Body            string    `json:"body"`
+	Draft           bool      `json:"draft"`
+	Prerelease      bool      `json:"prerelease"`
+	HTMLURL         string    `json:"html_url"`
+	CreatedAt       time.Time `json:"created_at"`
+	PublishedAt     time.Time `json:"published_at"`
+	Author          User      `json:"author"`
+}
+
+// ReleaseEvent is sent for activity on a release.
+type ReleaseEvent struct {
+	Action     string     `json:"action"`
+	Release    Release    `json:"release"`
+	Repository Repository `json:"repository"`
+	Sender     User       `json:"sender"`
+}
+
+// WorkflowInputs holds the inputs of a manually dispatched workflow as strings.
+type WorkflowInputs map[string]string
+
+func (w *WorkflowInputs) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*w = make(WorkflowInputs, len(raw))
+	for k, v := range raw {
+		var s string
+		switch {
+		case string(v) == "null":
+		case json.Unmarshal(v, &s) == nil:
+			(*w)[k] = s
+		default:
+			(*w)[k] = string(v)
+		}
+	}
+	return nil
+}
+
+// WorkflowDispatchEvent is sent when a workflow is run manually.
+type WorkflowDispatchEvent struct {
+	Ref        string         `json:"ref"`
+	Workflow   string         `json:"workflow"`
+	Inputs     WorkflowInputs `json:"inputs"`
+	Repository Repository     `json:"repository"`
+	Sender     User           `json:"sender"`
+}
+
+// ScheduleEvent is sent when a workflow runs on a schedule.
+type ScheduleEvent struct {
+	// Schedule is the cron expression that triggered the run.
+	Schedule   string     `json:"schedule"`
+	Repository Repository `json:"repository"`
+}
+
+// CreateEvent is sent when a branch or tag is created.
+type CreateEvent struct {
+	Ref string `json:"ref"`
+	// RefType is either "branch" or "tag".
+	RefType      string     `json:"ref_type"`
+	MasterBranch string     `json:"master_branch"`
+	Repository   Repository `json:"repository"`
+	Sender       User       `json:"sender"`
+}
+
+// CreatedTag returns the tag whose creation triggered the event, if any.
+func (e *Event) CreatedTag() (string, bool) {
+	switch {
+	case e.Push != nil && e.Push.Created:
+		return strings.CutPrefix(e.Push.Ref, "refs/tags/")
+	case e.Create != nil && e.Create.RefType == "tag":
+		return e.Create.Ref, true
+	}
+	return "", false
+}
+
+// parseEvent reads the payload of the named event from path.
+func parseEvent(name, actor, path string) (*Event, error) {
+	event := &Event{Name: name, Actor: actor}
+	if path == "" {
+		return event, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return event, fmt.Errorf("failed to read event file: %w", err)
+	}
+	event.Raw = data
+
+	var target any
+	switch name {
+	case "push":
+		event.Push = &PushEvent{}
+		target = event.Push
+	case "pull_request", "pull_request_target":
+		event.PullRequest = &PullRequestEvent{}
+		target = event.PullRequest
+	case "release":
+		event.Release = &ReleaseEvent{}
+		target = event.Release
+	case "workflow_dispatch":
+		event.WorkflowDispatch = &WorkflowDispatchEvent{}
+		target = event.WorkflowDispatch
+	case "schedule":
+		event.Schedule = &ScheduleEvent{}
+		target = event.Schedule
+	case "create":
+		event.Create = &CreateEvent{}
+		target = event.Create
+	default:
+		return event, nil
+	}
+
+	if err := json.Unmarshal(data, target); err != nil {
+		return &Event{Name: name, Actor: actor, Raw: data}, fmt.Errorf("failed to parse %s event JSON: %w", name, err)
+	}
+
+	if event.Actor == "" {
+		event.Actor = event.sender()
+	}
+	return event, nil
+}
+
+// sender returns the login of the user that sent the event, if recorded.
+func (e *Event) sender() string {
+	switch {
+	case e.Push != nil:
+		return e.Push.Sender.Login
+	case e.PullRequest != nil:
+		return e.PullRequest.Sender.Login
+	case e.Release != nil:
+		return e.Release.Sender.Login
+	case e.WorkflowDispatch != nil:
+		return e.WorkflowDispatch.Sender.Login
+	case e.Create != nil:
+		return e.Create.Sender.Login
+	}
+	return ""
+}
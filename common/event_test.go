@@ -0,0 +1,219 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeEvent(t *testing.T, payload string) string {
+	path := filepath.Join(t.TempDir(), "event.json")
+	require.NoError(t, os.WriteFile(path, []byte(payload), 0644))
+	return path
+}
+
+func TestParseEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   string
+		payload string
+		check   func(t *testing.T, e *Event)
+	}{
+		{
+			name:  "tag push",
+			event: "push",
+			payload: `{
+				"ref": "refs/tags/v1.2.0",
+				"before": "0000000000000000000000000000000000000000",
+				"after": "abc123",
+				"created": true,
+				"head_commit": {"id": "abc123", "message": "Release 1.2.0", "timestamp": "2026-01-02T03:04:05Z", "author": {"name": "Dev", "email": "dev@example.com"}},
+				"repository": {"full_name": "owner/repo", "default_branch": "main"},
+				"sender": {"login": "dev"}
+			}`,
+			check: func(t *testing.T, e *Event) {
+				require.NotNil(t, e.Push)
+				assert.Equal(t, "abc123", e.Push.After)
+				assert.Equal(t, "0000000000000000000000000000000000000000", e.Push.Before)
+				assert.Equal(t, "Release 1.2.0", e.Push.HeadCommit.Message)
+				assert.Equal(t, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), e.Push.HeadCommit.Timestamp)
+				assert.Equal(t, "main", e.Push.Repository.DefaultBranch)
+				assert.Equal(t, "dev", e.Actor)
+
+				tag, ok := e.CreatedTag()
+				assert.True(t, ok)
+				assert.Equal(t, "v1.2.0", tag)
+			},
+		},
+		{
+			name:    "branch creation push",
+			event:   "push",
+			payload: `{"ref": "refs/heads/feature", "created": true}`,
+			check: func(t *testing.T, e *Event) {
+				_, ok := e.CreatedTag()
+				assert.False(t, ok)
+			},
+		},
+		{
+			name:  "pull request",
+			event: "pull_request_target",
+			payload: `{
+				"action": "labeled",
+				"number": 7,
+				"label": {"name": "release"},
+				"pull_request": {
+					"number": 7,
+					"title": "Add feature",
+					"labels": [{"name": "enhancement"}, {"name": "release"}],
+					"head": {"ref": "feature", "sha": "def456", "repo": {"full_name": "fork/repo"}},
+					"base": {"ref": "main", "sha": "abc123", "repo": {"full_name": "owner/repo"}}
+				}
+			}`,
+			check: func(t *testing.T, e *Event) {
+				require.NotNil(t, e.PullRequest)
+				assert.Equal(t, "labeled", e.PullRequest.Action)
+				assert.Equal(t, "release", e.PullRequest.Label.Name)
+				assert.Equal(t, []string{"enhancement", "release"}, e.PullRequest.PullRequest.LabelNames())
+				assert.Equal(t, "abc123", e.PullRequest.PullRequest.Base.SHA)
+				assert.Equal(t, "fork/repo", e.PullRequest.PullRequest.Head.Repo.FullName)
+			},
+		},
+		{
+			name:  "release",
+			event: "release",
+			payload: `{
+				"action": "published",
+				"release": {"id": 42, "tag_name": "v2.0.0", "name": "2.0.0", "prerelease": true, "html_url": "https://example.com/r/42", "published_at": "2026-03-04T05:06:07Z", "author": {"login": "maintainer"}}
+			}`,
+			check: func(t *testing.T, e *Event) {
+				require.NotNil(t, e.Release)
+				assert.Equal(t, "published", e.Release.Action)
+				assert.Equal(t, int64(42), e.Release.Release.ID)
+				assert.Equal(t, "v2.0.0", e.Release.Release.TagName)
+				assert.True(t, e.Release.Release.Prerelease)
+				assert.Equal(t, "maintainer", e.Release.Release.Author.Login)
+			},
+		},
+		{
+			name:    "workflow dispatch",
+			event:   "workflow_dispatch",
+			payload: `{"ref": "refs/heads/main", "inputs": {"version": "1.0.0", "dry-run": true, "count": 3, "unset": null}}`,
+			check: func(t *testing.T, e *Event) {
+				require.NotNil(t, e.WorkflowDispatch)
+				assert.Equal(t, WorkflowInputs{"version": "1.0.0", "dry-run": "true", "count": "3"}, e.WorkflowDispatch.Inputs)
+			},
+		},
+		{
+			name:    "schedule",
+			event:   "schedule",
+			payload: `{"schedule": "0 4 * * 1"}`,
+			check: func(t *testing.T, e *Event) {
+				require.NotNil(t, e.Schedule)
+				assert.Equal(t, "0 4 * * 1", e.Schedule.Schedule)
+			},
+		},
+		{
+			name:    "tag creation",
+			event:   "create",
+			payload: `{"ref": "v3.0.0", "ref_type": "tag", "sender": {"login": "dev"}}`,
+			check: func(t *testing.T, e *Event) {
+				tag, ok := e.CreatedTag()
+				assert.True(t, ok)
+				assert.Equal(t, "v3.0.0", tag)
+			},
+		},
+		{
+			name:    "untyped event",
+			event:   "issues",
+			payload: `{"action": "opened"}`,
+			check: func(t *testing.T, e *Event) {
+				assert.JSONEq(t, `{"action": "opened"}`, string(e.Raw))
+				assert.Nil(t, e.Push)
+				assert.Nil(t, e.PullRequest)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := parseEvent(tt.event, "", writeEvent(t, tt.payload))
+			require.NoError(t, err)
+			assert.Equal(t, tt.event, event.Name)
+			tt.check(t, event)
+		})
+	}
+}
+
+func TestParseEvent_Invalid(t *testing.T) {
+	event, err := parseEvent("push", "dev", writeEvent(t, `{"ref": 1}`))
+	assert.ErrorContains(t, err, "failed to parse push event JSON")
+	assert.Equal(t, "push", event.Name)
+	assert.Equal(t, "dev", event.Actor)
+	assert.Nil(t, event.Push)
+}
+
+func TestContextFromEnv_PullRequest(t *testing.T) {
+	payload := `{
+		"number": 7,
+		"pull_request": {
+			"number": 7,
+			"head": {"ref": "feature", "sha": "def456", "repo": {"full_name": "fork/repo"}},
+			"base": {"ref": "main", "sha": "abc123", "repo": {"full_name": "owner/repo"}}
+		},
+		"sender": {"login": "contributor"}
+	}`
+
+	tests := []struct {
+		name     string
+		event    string
+		expected *Context
+	}{
+		{
+			name:  "pull_request",
+			event: "pull_request",
+			expected: &Context{
+				Actor:          "someone",
+				HeadRepository: "fork/repo",
+				HeadRef:        "feature",
+				HeadSHA:        "def456",
+				BaseRef:        "main",
+				BaseSHA:        "abc123",
+				PullRequest:    7,
+			},
+		},
+		{
+			name:     "pull_request_target",
+			event:    "pull_request_target",
+			expected: &Context{Actor: "someone"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"FORGEJO_JOB", "GITEA_ACTIONS"} {
+				unsetEnv(t, key)
+			}
+			t.Setenv("GITHUB_JOB", "build")
+			t.Setenv("GITHUB_ACTOR", "someone")
+			t.Setenv("GITHUB_EVENT_NAME", tt.event)
+			t.Setenv("GITHUB_EVENT_PATH", writeEvent(t, payload))
+
+			ctx, err := ContextFromEnv()
+			require.NoError(t, err)
+			require.NotNil(t, ctx.Event.PullRequest)
+			assert.Equal(t, 7, ctx.Event.PullRequest.Number)
+
+			assert.Equal(t, tt.expected.Actor, ctx.Actor)
+			assert.Equal(t, tt.expected.HeadRepository, ctx.HeadRepository)
+			assert.Equal(t, tt.expected.HeadRef, ctx.HeadRef)
+			assert.Equal(t, tt.expected.HeadSHA, ctx.HeadSHA)
+			assert.Equal(t, tt.expected.BaseRef, ctx.BaseRef)
+			assert.Equal(t, tt.expected.BaseSHA, ctx.BaseSHA)
+			assert.Equal(t, tt.expected.PullRequest, ctx.PullRequest)
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package common
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const defaultUserName = "actions[bot]"
+
+// BotSignature returns the signature to use for commits made by the bot.
+// Missing values default to a noreply address on the forge.
+func (c *Context) BotSignature(name, email string) object.Signature {
+	if name == "" {
+		name = defaultUserName
+	}
+	if email == "" {
+		host := "localhost"
+		if u, err := url.Parse(c.ServerURL); err == nil && u.Hostname() != "" {
+			host = u.Hostname()
+		}
+		local := strings.Map(func(r rune) rune {
+			switch {
+			case r == ' ':
+				return '-'
+			case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.', r == '_':
+				return r
+			default:
+				return -1
+			}
+		}, strings.ToLower(name))
+		email = fmt.Sprintf("%s@noreply.%s", local, host)
+	}
+	return object.Signature{Name: name, Email: email}
+}
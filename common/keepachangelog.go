@@ -0,0 +1,640 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+// ChangeType is the type of a subsection of a release.
+type ChangeType string
+
+const (
+	ChangeAdded      ChangeType = "Added"
+	ChangeChanged    ChangeType = "Changed"
+	ChangeDeprecated ChangeType = "Deprecated"
+	ChangeRemoved    ChangeType = "Removed"
+	ChangeFixed      ChangeType = "Fixed"
+	ChangeSecurity   ChangeType = "Security"
+)
+
+// ChangeTypes lists the standard change types in their recommended order.
+var ChangeTypes = []ChangeType{ChangeAdded, ChangeChanged, ChangeDeprecated, ChangeRemoved, ChangeFixed, ChangeSecurity}
+
+// unreleased is the version used for the section of upcoming changes.
+const unreleased = "Unreleased"
+
+var (
+	releaseHeadingRe = regexp.MustCompile(`^##\s+(?:\[([^\]]+)\]|(\S+))(?:\s+-\s+(\S+))?(\s+\[YANKED\])?\s*$`)
+	linkReferenceRe  = regexp.MustCompile(`^\[([^\]]+)\]:\s*(\S+)\s*$`)
+	listItemRe       = regexp.MustCompile(`^[-*+]\s+`)
+	compareLinkRe    = regexp.MustCompile(`^(.+/compare/)(.+)\.\.\.(.+)$`)
+)
+
+// Changelog is a CHANGELOG.md following the Keep a Changelog format.
+type Changelog struct {
+	// Preamble is the text before the first release, such as the title.
+	Preamble string
+	// Releases are in the order they appear, normally newest first.
+	Releases []*ChangelogRelease
+	// Links are the link reference definitions.
+	Links []ChangelogLink
+	// Pattern matches the version headings.
+	Pattern *regexp.Regexp
+}
+
+// ChangelogRelease is a "## version" section of a changelog.
+type ChangelogRelease struct {
+	// Version is the version as written, without brackets.
+	Version string
+	// Date is the release date as written, normally YYYY-MM-DD.
+	Date string
+	// Yanked is set if the release was pulled, marked with [YANKED].
+	Yanked bool
+	// Bracketed is set if the version links to a reference.
+	Bracketed bool
+	// Heading is the heading as written, including any setext underline.
+	Heading string
+	Level   int
+	// Line is the line number of the heading, starting at 1.
+	Line int
+	// Text is any content before the first subsection.
+	Text string
+	// Sections are the "### type" subsections, in order.
+	Sections []*ChangelogSection
+
+	// source is the release as written, for String to keep it unchanged.
+	source string
+}
+
+// ChangelogSection is a "### type" subsection of a release.
+type ChangelogSection struct {
+	Type ChangeType
+	// Heading is the heading as written, including any setext underline.
+	Heading string
+	// Line is the line number of the heading, starting at 1.
+	Line int
+	// Blocks are the list items and other text in the subsection.
+	Blocks []ChangelogBlock
+}
+
+// ChangelogBlock is a list item, or other text between them, in a subsection.
+type ChangelogBlock struct {
+	// Entry is set for list items.
+	Entry bool
+	// Text is the content of the block, without any list marker.
+	Text string
+}
+
+// ChangelogLink is a link reference definition such as
+// "[1.0.0]: https://example.com/compare/v0.9.0...v1.0.0".
+type ChangelogLink struct {
+	Label string
+	URL   string
+}
+
+// ReadChangelog reads and parses the changelog at path.
+func ReadChangelog(path string) (*Changelog, error) {
+	return ReadChangelogMatching(path, nil)
+}
+
+// ReadChangelogMatching reads and parses the changelog at path with the pattern.
+func ReadChangelogMatching(path string, pattern *regexp.Regexp) (*Changelog, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read changelog: %w", err)
+	}
+	return ParseChangelogMatching(string(content), pattern), nil
+}
+
+// ParseChangelog parses a changelog with Keep a Changelog headings.
+func ParseChangelog(content string) *Changelog {
+	return ParseChangelogMatching(content, nil)
+}
+
+// ParseChangelogMatching parses a changelog, starting the releases at the
+// first heading the pattern matches or an Unreleased heading.
+func ParseChangelogMatching(content string, pattern *regexp.Regexp) *Changelog {
+	if pattern == nil {
+		pattern = versionHeadingRe
+	}
+	p := &changelogParser{
+		changelog: &Changelog{Pattern: pattern},
+		lines:     strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n"),
+	}
+	for i := 0; i < len(p.lines); i++ {
+		if p.line(i) {
+			// Skip the underline of a setext heading.
+			i++
+		}
+	}
+	p.finish()
+	return p.changelog
+}
+
+type changelogParser struct {
+	changelog *Changelog
+	lines     []string
+	// level is the level of release headings, once the first is found.
+	level    int
+	preamble []string
+	release  *ChangelogRelease
+	section  *ChangelogSection
+	text     []string
+	entry    []string
+	blanks   int
+	// source are the lines of the current release.
+	source []string
+	// fence is the marker of the open fenced code block, if any.
+	fence string
+	// fenceInEntry is set if the open fenced code block is part of an entry.
+	fenceInEntry bool
+}
+
+// line parses the line with the given index, reporting whether it was a
+// setext heading whose underline has been consumed too.
+func (p *changelogParser) line(i int) bool {
+	line, number := p.lines[i], i+1
+	if p.fence != "" {
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, p.fence) && strings.Trim(trimmed, p.fence[:1]) == "" {
+			p.fence = ""
+		}
+		if p.release != nil {
+			p.source = append(p.source, line)
+		}
+		switch {
+		case p.release == nil:
+			p.preamble = append(p.preamble, line)
+		case strings.TrimSpace(line) == "":
+			p.blanks++
+		case p.fenceInEntry && p.entry != nil:
+			p.continueEntry(line)
+		default:
+			p.addText(line)
+		}
+		return false
+	}
+
+	if matches := fenceRe.FindStringSubmatch(line); matches != nil {
+		p.fence = matches[1]
+	}
+
+	if matches := linkReferenceRe.FindStringSubmatch(line); matches != nil {
+		p.changelog.Links = append(p.changelog.Links, ChangelogLink{Label: matches[1], URL: matches[2]})
+		return false
+	}
+
+	if level, text := changelogHeading(p.lines, i); level > 0 && p.fence == "" && !strings.HasPrefix(line, " ") {
+		heading, setext := line, !atxHeadingRe.MatchString(line)
+		if setext {
+			heading += "\n" + p.lines[i+1]
+		}
+		if release := p.releaseHeading(heading, level, text); release != nil {
+			p.finishRelease()
+			p.release = release
+			p.release.Line = number
+			p.changelog.Releases = append(p.changelog.Releases, p.release)
+			p.source = []string{heading}
+			return setext
+		}
+		if p.release != nil && level == p.level+1 {
+			p.source = append(p.source, heading)
+			p.finishSection()
+			p.section = &ChangelogSection{Type: ChangeType(text), Heading: heading, Line: number}
+			p.release.Sections = append(p.release.Sections, p.section)
+			return setext
+		}
+	}
+
+	if p.release == nil {
+		p.preamble = append(p.preamble, line)
+		return false
+	}
+
+	p.source = append(p.source, line)
+	p.fenceInEntry = false
+	switch {
+	case strings.TrimSpace(line) == "":
+		p.blanks++
+	case p.section != nil && p.fence == "" && listItemRe.MatchString(line):
+		p.finishText()
+		p.finishEntry()
+		p.entry = []string{listItemRe.ReplaceAllString(line, "")}
+	case p.entry != nil && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") || p.blanks == 0):
+		p.fenceInEntry = p.fence != ""
+		p.continueEntry(line)
+	default:
+		p.addText(line)
+	}
+	return false
+}
+
+// continueEntry adds a line, and any blank lines before it, to the entry.
+func (p *changelogParser) continueEntry(line string) {
+	for range p.blanks {
+		p.entry = append(p.entry, "")
+	}
+	p.entry = append(p.entry, line)
+	p.blanks = 0
+}
+
+// addText adds a line, and any blank lines before it, to the current text.
+func (p *changelogParser) addText(line string) {
+	blanks := p.blanks
+	p.finishEntry()
+	if len(p.text) > 0 {
+		for range blanks {
+			p.text = append(p.text, "")
+		}
+	}
+	p.text = append(p.text, line)
+}
+
+func (p *changelogParser) finishEntry() {
+	if p.entry != nil {
+		p.section.Blocks = append(p.section.Blocks, ChangelogBlock{Entry: true, Text: strings.Join(p.entry, "\n")})
+		p.entry = nil
+	}
+	p.blanks = 0
+}
+
+// finishText ends the current text block of a subsection.
+func (p *changelogParser) finishText() {
+	if p.section != nil && len(p.text) > 0 {
+		p.section.Blocks = append(p.section.Blocks, ChangelogBlock{Text: strings.Join(p.text, "\n")})
+		p.text = nil
+	}
+}
+
+func (p *changelogParser) finishSection() {
+	p.finishEntry()
+	if p.section != nil {
+		p.finishText()
+	} else if p.release != nil {
+		p.release.Text = strings.Join(p.text, "\n")
+	}
+	p.text = nil
+	p.section = nil
+}
+
+func (p *changelogParser) finishRelease() {
+	p.finishSection()
+	if p.release != nil {
+		end := len(p.source)
+		for end > 0 && strings.TrimSpace(p.source[end-1]) == "" {
+			end--
+		}
+		p.release.source = strings.Join(p.source[:end], "\n")
+	}
+	p.release = nil
+	p.source = nil
+}
+
+func (p *changelogParser) finish() {
+	p.finishRelease()
+	p.changelog.Preamble = strings.Trim(strings.Join(p.preamble, "\n"), "\n")
+}
+
+// releaseHeading parses a heading as a release, or returns nil if it isn't one.
+func (p *changelogParser) releaseHeading(heading string, level int, text string) *ChangelogRelease {
+	if p.level > 0 && level != p.level {
+		return nil
+	}
+
+	release := &ChangelogRelease{Heading: heading, Level: level}
+	version := headingVersion(p.changelog.Pattern, level, text)
+	if matches := releaseHeadingRe.FindStringSubmatch("## " + text); matches != nil && (version == "" || normaliseVersion(matches[1]+matches[2]) == normaliseVersion(version)) {
+		release.Version = matches[1] + matches[2]
+		release.Bracketed = matches[1] != ""
+		release.Date = matches[3]
+		release.Yanked = matches[4] != ""
+	} else if version != "" && p.changelog.Pattern != versionHeadingRe {
+		// The default pattern is looser than the Keep a Changelog format,
+		// so only a custom one is trusted with other headings.
+		release.Version = version
+		release.Date = headingDate(p.changelog.Pattern, level, text)
+	} else {
+		release.Version = text
+	}
+
+	if p.level == 0 && version == "" && !release.Unreleased() {
+		return nil
+	}
+	p.level = level
+	return release
+}
+
+// Unreleased reports whether the release holds upcoming changes.
+func (r *ChangelogRelease) Unreleased() bool {
+	return strings.EqualFold(r.Version, unreleased)
+}
+
+// Section returns the subsection of the given type, if any.
+func (r *ChangelogRelease) Section(t ChangeType) *ChangelogSection {
+	for _, s := range r.Sections {
+		if strings.EqualFold(string(s.Type), string(t)) {
+			return s
+		}
+	}
+	return nil
+}
+
+// Empty reports whether the release has no content.
+func (r *ChangelogRelease) Empty() bool {
+	if r.Text != "" {
+		return false
+	}
+	for _, s := range r.Sections {
+		if !s.Empty() {
+			return false
+		}
+	}
+	return true
+}
+
+// Empty reports whether the subsection has no content.
+func (s *ChangelogSection) Empty() bool {
+	return len(s.Blocks) == 0
+}
+
+// Entries returns the text of the list items, without their markers.
+func (s *ChangelogSection) Entries() []string {
+	var res []string
+	for _, b := range s.Blocks {
+		if b.Entry {
+			res = append(res, b.Text)
+		}
+	}
+	return res
+}
+
+// Text returns the content that isn't part of a list item.
+func (s *ChangelogSection) Text() string {
+	var res []string
+	for _, b := range s.Blocks {
+		if !b.Entry {
+			res = append(res, b.Text)
+		}
+	}
+	return strings.Join(res, "\n\n")
+}
+
+// Release returns the release with the given version, ignoring any "v" prefix.
+func (c *Changelog) Release(v string) *ChangelogRelease {
+	for _, r := range c.Releases {
+		if normaliseVersion(r.Version) == normaliseVersion(v) {
+			return r
+		}
+	}
+	return nil
+}
+
+// Dated reports whether release headings are expected to have a date.
+func (c *Changelog) Dated() bool {
+	return c.Pattern == nil || c.Pattern == versionHeadingRe || c.Pattern.SubexpIndex("date") >= 0
+}
+
+// Unreleased returns the section of upcoming changes, if any.
+func (c *Changelog) Unreleased() *ChangelogRelease {
+	return c.Release(unreleased)
+}
+
+// Link returns the URL of the link reference with the given label.
+func (c *Changelog) Link(label string) string {
+	for _, l := range c.Links {
+		if strings.EqualFold(l.Label, label) {
+			return l.URL
+		}
+	}
+	return ""
+}
+
+// Range returns the releases after from, up to and including to. Either may
+// be empty to leave that end open.
+func (c *Changelog) Range(from, to string) ([]*ChangelogRelease, error) {
+	lower, err := rangeBound(from)
+	if err != nil {
+		return nil, err
+	}
+	upper, err := rangeBound(to)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*ChangelogRelease
+	for _, r := range c.Releases {
+		v, err := version.NewVersion(r.Version)
+		if err != nil {
+			continue
+		}
+		if (lower == nil || v.GreaterThan(lower)) && (upper == nil || v.LessThanOrEqual(upper)) {
+			res = append(res, r)
+		}
+	}
+	return res, nil
+}
+
+// Since returns every release after the given version.
+func (c *Changelog) Since(v string) ([]*ChangelogRelease, error) {
+	return c.Range(v, "")
+}
+
+// Promote moves the unreleased changes into a new release, updating the
+// comparison links if there are any.
+func (c *Changelog) Promote(version, date, tag string) (*ChangelogRelease, error) {
+	current := c.Unreleased()
+	if current == nil {
+		return nil, errors.New("changelog has no Unreleased section")
+	}
+	if c.Release(version) != nil {
+		return nil, fmt.Errorf("changelog already has a section for %s", version)
+	}
+	if current.Empty() {
+		return nil, errors.New("the Unreleased section is empty")
+	}
+
+	link := -1
+	var compare []string
+	for i, l := range c.Links {
+		if strings.EqualFold(l.Label, unreleased) {
+			link, compare = i, compareLinkRe.FindStringSubmatch(l.URL)
+			break
+		}
+	}
+
+	level := max(current.Level, 1)
+	release := &ChangelogRelease{
+		Version:   version,
+		Date:      date,
+		Bracketed: current.Bracketed && (compare != nil || c.Link(version) != ""),
+		Level:     level,
+		Text:      current.Text,
+		Sections:  current.Sections,
+	}
+	release.Heading = c.Heading(release)
+	if c.Pattern != nil && normaliseVersion(headingVersion(c.Pattern, level, c.headingText(release))) != normaliseVersion(version) {
+		return nil, fmt.Errorf("the heading %q would not match the changelog's heading pattern", release.Heading)
+	}
+
+	if compare != nil {
+		c.Links[link].URL = compare[1] + tag + "..." + compare[3]
+		c.Links = slices.Insert(c.Links, link+1, ChangelogLink{
+			Label: version,
+			URL:   compare[1] + compare[2] + "..." + tag,
+		})
+	}
+
+	// Keep the body of the unreleased changes as written.
+	if body, ok := strings.CutPrefix(current.source, current.Heading); ok {
+		release.source = release.Heading + body
+	}
+	current.Text, current.Sections, current.source = "", nil, ""
+	index := slices.Index(c.Releases, current)
+	c.Releases = slices.Insert(c.Releases, index+1, release)
+	return release, nil
+}
+
+func rangeBound(v string) (*version.Version, error) {
+	if v == "" {
+		return nil, nil
+	}
+	res, err := version.NewVersion(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version %q: %w", v, err)
+	}
+	return res, nil
+}
+
+func normaliseVersion(v string) string {
+	return strings.ToLower(strings.TrimPrefix(v, "v"))
+}
+
+// String renders the changelog, keeping releases that Promote didn't change as written.
+func (c *Changelog) String() string {
+	var blocks []string
+	if c.Preamble != "" {
+		blocks = append(blocks, c.Preamble)
+	}
+	for _, r := range c.Releases {
+		if r.source != "" {
+			blocks = append(blocks, r.source)
+		} else {
+			blocks = append(blocks, r.Markdown())
+		}
+	}
+	if len(c.Links) > 0 {
+		links := make([]string, len(c.Links))
+		for i, l := range c.Links {
+			links[i] = fmt.Sprintf("[%s]: %s", l.Label, l.URL)
+		}
+		blocks = append(blocks, strings.Join(links, "\n"))
+	}
+	return strings.Join(blocks, "\n\n") + "\n"
+}
+
+// HeadingText renders the release's heading without the leading "##".
+func (r *ChangelogRelease) HeadingText() string {
+	var b strings.Builder
+	if r.Bracketed {
+		fmt.Fprintf(&b, "[%s]", r.Version)
+	} else {
+		b.WriteString(r.Version)
+	}
+	if r.Date != "" {
+		fmt.Fprintf(&b, " - %s", r.Date)
+	}
+	if r.Yanked {
+		b.WriteString(" [YANKED]")
+	}
+	return b.String()
+}
+
+// Heading renders a heading for the release in the style of the changelog's
+// pattern, falling back to the Keep a Changelog format.
+func (c *Changelog) Heading(r *ChangelogRelease) string {
+	return strings.Repeat("#", max(r.Level, 1)) + " " + c.headingText(r)
+}
+
+func (c *Changelog) headingText(r *ChangelogRelease) string {
+	if format, ok := headingFormats[c.Pattern]; ok {
+		return format(r)
+	}
+	return r.HeadingText()
+}
+
+// versionHeadingText renders the text of a heading for the version preset.
+func versionHeadingText(r *ChangelogRelease) string {
+	var b strings.Builder
+	b.WriteString("Version ")
+	if r.Bracketed {
+		fmt.Fprintf(&b, "[%s]", r.Version)
+	} else {
+		b.WriteString(r.Version)
+	}
+	if r.Date != "" {
+		fmt.Fprintf(&b, " (%s)", r.Date)
+	}
+	if r.Yanked {
+		b.WriteString(" [YANKED]")
+	}
+	return b.String()
+}
+
+// Markdown renders the release, including its heading as written.
+func (r *ChangelogRelease) Markdown() string {
+	heading := r.Heading
+	if heading == "" {
+		heading = "## " + r.HeadingText()
+	}
+	if body := r.Body(); body != "" {
+		return heading + "\n\n" + body
+	}
+	return heading
+}
+
+// Body renders the content of the release, without its heading.
+func (r *ChangelogRelease) Body() string {
+	var blocks []string
+	if r.Text != "" {
+		blocks = append(blocks, r.Text)
+	}
+	for _, s := range r.Sections {
+		blocks = append(blocks, s.Markdown())
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// Markdown renders the subsection, including its heading as written.
+func (s *ChangelogSection) Markdown() string {
+	var b strings.Builder
+	if s.Heading != "" {
+		b.WriteString(s.Heading)
+	} else {
+		fmt.Fprintf(&b, "### %s", s.Type)
+	}
+	for i, block := range s.Blocks {
+		if !block.Entry {
+			fmt.Fprintf(&b, "\n\n%s", block.Text)
+			continue
+		}
+		if i > 0 && !s.Blocks[i-1].Entry {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "\n- %s", block.Text)
+	}
+	return b.String()
+}
+
+// RenderReleases renders several releases, each with its heading.
+func RenderReleases(releases []*ChangelogRelease) string {
+	blocks := make([]string, len(releases))
+	for i, r := range releases {
+		blocks[i] = r.Markdown()
+	}
+	return strings.Join(blocks, "\n\n")
+}
@@ -0,0 +1,482 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testKeepAChangelog = `# Changelog
+
+All notable changes to this project will be documented in this file.
+
+## [Unreleased]
+
+### Added
+- Support for widgets
+
+## [1.2.0] - 2024-03-01
+
+### Added
+- New feature X
+- New feature Y, which needs
+  a longer explanation
+
+      with an example
+
+### Fixed
+- Bug fix Z
+
+## [1.1.1] - 2024-02-15 [YANKED]
+
+### Security
+- Patched a hole
+
+## 1.1.0 - 2024-02-01
+
+### Removed
+* Old feature
+
+## [1.0.0] - 2024-01-01
+
+Initial release.
+
+[Unreleased]: https://example.com/compare/v1.2.0...HEAD
+[1.2.0]: https://example.com/compare/v1.1.1...v1.2.0
+[1.1.1]: https://example.com/compare/v1.1.0...v1.1.1
+[1.0.0]: https://example.com/releases/tag/v1.0.0
+`
+
+func TestParseChangelog(t *testing.T) {
+	c := ParseChangelog(testKeepAChangelog)
+	// The source of each release is covered by TestChangelog_String.
+	for _, r := range c.Releases {
+		r.source = ""
+	}
+
+	assert.Equal(t, "# Changelog\n\nAll notable changes to this project will be documented in this file.", c.Preamble)
+	require.Len(t, c.Releases, 5)
+
+	assert.Equal(t, &ChangelogRelease{
+		Version:   "Unreleased",
+		Bracketed: true,
+		Heading:   "## [Unreleased]",
+		Level:     2,
+		Line:      5,
+		Sections: []*ChangelogSection{
+			{Type: ChangeAdded, Heading: "### Added", Line: 7, Blocks: []ChangelogBlock{{Entry: true, Text: "Support for widgets"}}},
+		},
+	}, c.Releases[0])
+	assert.True(t, c.Releases[0].Unreleased())
+
+	assert.Equal(t, &ChangelogRelease{
+		Version:   "1.2.0",
+		Date:      "2024-03-01",
+		Bracketed: true,
+		Heading:   "## [1.2.0] - 2024-03-01",
+		Level:     2,
+		Line:      10,
+		Sections: []*ChangelogSection{
+			{Type: ChangeAdded, Heading: "### Added", Line: 12, Blocks: []ChangelogBlock{
+				{Entry: true, Text: "New feature X"},
+				{Entry: true, Text: "New feature Y, which needs\n  a longer explanation\n\n      with an example"},
+			}},
+			{Type: ChangeFixed, Heading: "### Fixed", Line: 19, Blocks: []ChangelogBlock{{Entry: true, Text: "Bug fix Z"}}},
+		},
+	}, c.Releases[1])
+
+	assert.Equal(t, "1.1.1", c.Releases[2].Version)
+	assert.True(t, c.Releases[2].Yanked)
+	assert.Equal(t, []string{"Patched a hole"}, c.Releases[2].Section(ChangeSecurity).Entries())
+
+	assert.Equal(t, "1.1.0", c.Releases[3].Version)
+	assert.False(t, c.Releases[3].Bracketed)
+	assert.Equal(t, []string{"Old feature"}, c.Releases[3].Section(ChangeRemoved).Entries())
+	assert.Nil(t, c.Releases[3].Section(ChangeAdded))
+
+	assert.Equal(t, "Initial release.", c.Releases[4].Text)
+	assert.Empty(t, c.Releases[4].Sections)
+	assert.False(t, c.Releases[4].Empty())
+
+	assert.Len(t, c.Links, 4)
+	assert.Equal(t, "https://example.com/compare/v1.1.1...v1.2.0", c.Link("1.2.0"))
+	assert.Equal(t, "https://example.com/compare/v1.2.0...HEAD", c.Link("unreleased"))
+	assert.Equal(t, "", c.Link("1.1.0"))
+}
+
+func TestParseChangelog_Lenient(t *testing.T) {
+	c := ParseChangelog("## Version two!\n\nSome text\n\n### Notes\nA paragraph\n- item\n\nmore\n")
+	require.Len(t, c.Releases, 1)
+	assert.Equal(t, "Version two!", c.Releases[0].Version)
+	assert.Equal(t, "Some text", c.Releases[0].Text)
+	assert.Equal(t, &ChangelogSection{Type: "Notes", Heading: "### Notes", Line: 5, Blocks: []ChangelogBlock{
+		{Text: "A paragraph"},
+		{Entry: true, Text: "item"},
+		{Text: "more"},
+	}}, c.Releases[0].Sections[0])
+	assert.Equal(t, []string{"item"}, c.Releases[0].Sections[0].Entries())
+	assert.Equal(t, "A paragraph\n\nmore", c.Releases[0].Sections[0].Text())
+
+	assert.Empty(t, ParseChangelog("").Releases)
+	assert.True(t, ParseChangelog("## 1.0.0\n\n### Added\n").Releases[0].Empty())
+}
+
+func TestParseChangelogMatching(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		content  string
+		versions []string
+		dates    []string
+		sections []string
+	}{
+		{
+			name:     "plain",
+			pattern:  "plain",
+			content:  "# My addon\n\n## Unreleased\n\n## 1.2.0 - 2024-03-01\n\n### Added\n- Thing\n\n#### Detail\n\n## v1.1.0\n\n- Other\n",
+			versions: []string{"Unreleased", "1.2.0", "v1.1.0"},
+			dates:    []string{"", "2024-03-01", ""},
+			sections: []string{"Added"},
+		},
+		{
+			name:     "plain setext",
+			pattern:  "plain",
+			content:  "Changelog\n=========\n\n1.2.0\n-----\n\n### Added\n- Thing\n\n1.1.0\n-----\n\n- Other\n",
+			versions: []string{"1.2.0", "1.1.0"},
+			dates:    []string{"", ""},
+			sections: []string{"Added"},
+		},
+		{
+			name:     "plain top level",
+			pattern:  "plain",
+			content:  "1.2.0\n=====\n\nFixes\n-----\n- Thing\n\n# 1.1.0\n\n- Other\n",
+			versions: []string{"1.2.0", "1.1.0"},
+			dates:    []string{"", ""},
+			sections: []string{"Fixes"},
+		},
+		{
+			name:     "version",
+			pattern:  "version",
+			content:  "# Changelog\n\n### Version 1.2.0 (2024-03-01)\n\n#### Added\n- Thing\n\n### Version 1.1.0\n\n- Other\n",
+			versions: []string{"1.2.0", "1.1.0"},
+			dates:    []string{"2024-03-01", ""},
+			sections: []string{"Added"},
+		},
+		{
+			name:     "custom",
+			pattern:  `^## Release (?P<version>\S+) \((?P<date>[^)]+)\)`,
+			content:  "## Overview\n\nText\n\n## Release 1.2.0 (2024-03-01)\n\n### Added\n- Thing\n\n## Release 1.1.0 (2024-02-01)\n",
+			versions: []string{"1.2.0", "1.1.0"},
+			dates:    []string{"2024-03-01", "2024-02-01"},
+			sections: []string{"Added"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, err := ParseHeadingPattern(tt.pattern)
+			require.NoError(t, err)
+
+			c := ParseChangelogMatching(tt.content, pattern)
+			var versions, dates, sections []string
+			for _, r := range c.Releases {
+				versions = append(versions, r.Version)
+				dates = append(dates, r.Date)
+				for _, s := range r.Sections {
+					sections = append(sections, string(s.Type))
+				}
+			}
+			assert.Equal(t, tt.versions, versions)
+			assert.Equal(t, tt.dates, dates)
+			assert.Equal(t, tt.sections, sections)
+			assert.Equal(t, tt.content, c.String())
+		})
+	}
+}
+
+func TestChangelog_String(t *testing.T) {
+	c := ParseChangelog(testKeepAChangelog)
+	assert.Equal(t, testKeepAChangelog, c.String())
+
+	// Rendering the model normalises list markers.
+	assert.Equal(t, "## 1.1.0 - 2024-02-01\n\n### Removed\n- Old feature", c.Releases[3].Markdown())
+}
+
+// canonicalChangelog follows the layout of the keepachangelog.com example.
+const canonicalChangelog = `# Changelog
+
+All notable changes to this project will be documented in this file.
+
+The format is based on [Keep a Changelog](https://keepachangelog.com/en/1.1.0/),
+and this project adheres to [Semantic Versioning](https://semver.org/spec/v2.0.0.html).
+
+## [Unreleased]
+
+### Added
+
+* New visual identity.
+* Version navigation.
+
+## [1.1.1] - 2023-03-05
+
+### Added
+
+- Arabic translation (#444).
+- v1.1 French translation.
+
+### Fixed
+
+- Improve French translation (#377).
+
+## [1.0.0] - 2017-06-20
+
+### Added
+
+- New visual identity by [@tylerfortune8](https://github.com/tylerfortune8).
+
+[unreleased]: https://github.com/olivierlacan/keep-a-changelog/compare/v1.1.1...HEAD
+[1.1.1]: https://github.com/olivierlacan/keep-a-changelog/compare/v1.0.0...v1.1.1
+[1.0.0]: https://github.com/olivierlacan/keep-a-changelog/releases/tag/v1.0.0
+`
+
+func TestChangelog_StringCanonical(t *testing.T) {
+	c := ParseChangelog(canonicalChangelog)
+	assert.Equal(t, canonicalChangelog, c.String())
+
+	// Promoting only changes the unreleased changes and the links.
+	_, err := c.Promote("1.2.0", "2024-01-01", "v1.2.0")
+	require.NoError(t, err)
+	expected := strings.Replace(canonicalChangelog, "## [Unreleased]\n", "## [Unreleased]\n\n## [1.2.0] - 2024-01-01\n", 1)
+	expected = strings.Replace(expected,
+		"[unreleased]: https://github.com/olivierlacan/keep-a-changelog/compare/v1.1.1...HEAD\n",
+		"[unreleased]: https://github.com/olivierlacan/keep-a-changelog/compare/v1.2.0...HEAD\n"+
+			"[1.2.0]: https://github.com/olivierlacan/keep-a-changelog/compare/v1.1.1...v1.2.0\n", 1)
+	assert.Equal(t, expected, c.String())
+}
+
+func TestChangelog_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		check   func(t *testing.T, c *Changelog)
+	}{
+		{
+			name:    "fenced code",
+			content: "# Changelog\n\n```md\n## Not a release\n```\n\n## 1.0.0\n\n### Added\n- Config such as\n\n  ```md\n  ## Heading\n### Sub\n\n- item\n  ```\n- Another\n\n~~~\n### Not a section\n[1.0.0]: not-a-link\n~~~\n",
+			check: func(t *testing.T, c *Changelog) {
+				assert.Equal(t, "# Changelog\n\n```md\n## Not a release\n```", c.Preamble)
+				require.Len(t, c.Releases, 1)
+				require.Len(t, c.Releases[0].Sections, 1)
+				assert.Empty(t, c.Links)
+				assert.Equal(t, []ChangelogBlock{
+					{Entry: true, Text: "Config such as\n\n  ```md\n  ## Heading\n### Sub\n\n- item\n  ```"},
+					{Entry: true, Text: "Another"},
+					{Text: "~~~\n### Not a section\n[1.0.0]: not-a-link\n~~~"},
+				}, c.Releases[0].Sections[0].Blocks)
+			},
+		},
+		{
+			name:    "text after entries",
+			content: "## 1.0.0\n\n### Changed\nIntroduction\n\n- First\n- Second\n\nA note about the second.\n\nAnd another.\n- Third\n\n### Fixed\n- Bug\n",
+			check: func(t *testing.T, c *Changelog) {
+				assert.Equal(t, []ChangelogBlock{
+					{Text: "Introduction"},
+					{Entry: true, Text: "First"},
+					{Entry: true, Text: "Second"},
+					{Text: "A note about the second.\n\nAnd another."},
+					{Entry: true, Text: "Third"},
+				}, c.Releases[0].Sections[0].Blocks)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := ParseChangelog(tt.content)
+			tt.check(t, c)
+			// Rendering normalises blank lines but keeps every block in place.
+			reparsed := ParseChangelog(c.String())
+			tt.check(t, reparsed)
+			assert.Equal(t, c.String(), reparsed.String())
+		})
+	}
+
+	// Canonical changelogs are reproduced exactly.
+	canonical := "## 1.0.0\n\n### Changed\n\nIntroduction\n\n- First\n- Second\n\nA note about the second.\n\n- Third\n"
+	assert.Equal(t, canonical, ParseChangelog(canonical).String())
+}
+
+func TestChangelog_Release(t *testing.T) {
+	c := ParseChangelog(testKeepAChangelog)
+	assert.Equal(t, "1.2.0", c.Release("v1.2.0").Version)
+	assert.Equal(t, "1.1.0", c.Release("1.1.0").Version)
+	assert.Nil(t, c.Release("2.0.0"))
+	assert.Equal(t, c.Releases[0], c.Unreleased())
+	assert.Equal(t, "### Added\n- New feature X\n- New feature Y, which needs\n  a longer explanation\n\n      with an example\n\n### Fixed\n- Bug fix Z", c.Release("1.2.0").Body())
+}
+
+func TestChangelog_Range(t *testing.T) {
+	c := ParseChangelog(testKeepAChangelog)
+
+	versions := func(releases []*ChangelogRelease) []string {
+		var res []string
+		for _, r := range releases {
+			res = append(res, r.Version)
+		}
+		return res
+	}
+
+	tests := []struct {
+		name     string
+		from, to string
+		expected []string
+	}{
+		{name: "everything", expected: []string{"1.2.0", "1.1.1", "1.1.0", "1.0.0"}},
+		{name: "since", from: "1.1.0", expected: []string{"1.2.0", "1.1.1"}},
+		{name: "since with prefix", from: "v1.1.0", expected: []string{"1.2.0", "1.1.1"}},
+		{name: "up to", to: "1.1.0", expected: []string{"1.1.0", "1.0.0"}},
+		{name: "between", from: "1.0.0", to: "1.1.1", expected: []string{"1.1.1", "1.1.0"}},
+		{name: "unknown versions", from: "1.0.5", to: "1.1.5", expected: []string{"1.1.1", "1.1.0"}},
+		{name: "nothing newer", from: "1.2.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			releases, err := c.Range(tt.from, tt.to)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, versions(releases))
+		})
+	}
+
+	_, err := c.Range("banana", "")
+	assert.ErrorContains(t, err, `invalid version "banana"`)
+
+	releases, err := c.Since("1.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.2.0"}, versions(releases))
+
+	releases, err = c.Range("1.0.0", "1.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, "## [1.1.1] - 2024-02-15 [YANKED]\n\n### Security\n- Patched a hole\n\n## 1.1.0 - 2024-02-01\n\n### Removed\n- Old feature", RenderReleases(releases))
+}
+
+func TestReadChangelog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "CHANGELOG.md")
+	require.NoError(t, os.WriteFile(path, []byte(testKeepAChangelog), 0644))
+
+	c, err := ReadChangelog(path)
+	require.NoError(t, err)
+	assert.Len(t, c.Releases, 5)
+
+	_, err = ReadChangelog(filepath.Join(t.TempDir(), "missing.md"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestChangelog_Promote(t *testing.T) {
+	c := ParseChangelog(testKeepAChangelog)
+
+	release, err := c.Promote("1.3.0", "2024-04-01", "v1.3.0")
+	require.NoError(t, err)
+	assert.Equal(t, "## [1.3.0] - 2024-04-01", release.Heading)
+
+	expected := `# Changelog
+
+All notable changes to this project will be documented in this file.
+
+## [Unreleased]
+
+## [1.3.0] - 2024-04-01
+
+### Added
+- Support for widgets
+
+## [1.2.0] - 2024-03-01
+`
+	assert.Equal(t, expected, c.String()[:len(expected)])
+	assert.Equal(t, []ChangelogLink{
+		{Label: "Unreleased", URL: "https://example.com/compare/v1.3.0...HEAD"},
+		{Label: "1.3.0", URL: "https://example.com/compare/v1.2.0...v1.3.0"},
+		{Label: "1.2.0", URL: "https://example.com/compare/v1.1.1...v1.2.0"},
+		{Label: "1.1.1", URL: "https://example.com/compare/v1.1.0...v1.1.1"},
+		{Label: "1.0.0", URL: "https://example.com/releases/tag/v1.0.0"},
+	}, c.Links)
+	assert.True(t, c.Unreleased().Empty())
+
+	_, err = c.Promote("1.4.0", "2024-05-01", "v1.4.0")
+	assert.EqualError(t, err, "the Unreleased section is empty")
+}
+
+func TestChangelog_PromoteErrors(t *testing.T) {
+	_, err := ParseChangelog("## 1.0.0\n\n- Thing\n").Promote("1.1.0", "2024-01-01", "v1.1.0")
+	assert.EqualError(t, err, "changelog has no Unreleased section")
+
+	_, err = ParseChangelog("## Unreleased\n\n### Added\n- Thing\n\n## v1.0.0\n").Promote("1.0.0", "2024-01-01", "v1.0.0")
+	assert.EqualError(t, err, "changelog already has a section for 1.0.0")
+
+	c := ParseChangelog("## Unreleased\n\n### Fixed\n- Thing\n")
+	_, err = c.Promote("1.0.0", "2024-01-01", "v1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, "## Unreleased\n\n## 1.0.0 - 2024-01-01\n\n### Fixed\n- Thing\n", c.String())
+}
+
+func TestChangelog_PromoteMatching(t *testing.T) {
+	c := ParseChangelogMatching("Unreleased\n==========\n\n- Thing\n\n# 1.0.0\n", HeadingPresets["plain"])
+	_, err := c.Promote("1.1.0", "2024-02-01", "v1.1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "Unreleased\n==========\n\n# 1.1.0 - 2024-02-01\n\n- Thing\n\n# 1.0.0\n", c.String())
+	assert.Equal(t, "1.1.0", ParseChangelogMatching(c.String(), HeadingPresets["plain"]).Releases[1].Version)
+
+	c = ParseChangelogMatching("## Unreleased\n\n- Thing\n\n## Version 1.0.0\n", HeadingPresets["version"])
+	_, err = c.Promote("1.1.0", "2024-02-01", "v1.1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "## Unreleased\n\n## Version 1.1.0 (2024-02-01)\n\n- Thing\n\n## Version 1.0.0\n", c.String())
+
+	content := "## Unreleased\n\n- Thing\n\n## Release 1.0.0\n"
+	c = ParseChangelogMatching(content, regexp.MustCompile(`^## Release (\S+)`))
+	_, err = c.Promote("1.1.0", "2024-02-01", "v1.1.0")
+	assert.EqualError(t, err, `the heading "## 1.1.0 - 2024-02-01" would not match the changelog's heading pattern`)
+	assert.Equal(t, content, c.String())
+}
+
+func TestChangelog_PromoteBrackets(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{
+			name:     "compare link",
+			content:  "## [Unreleased]\n\n- Thing\n\n## [1.0.0]\n\n[Unreleased]: https://example.com/compare/v1.0.0...HEAD\n[1.0.0]: https://example.com/releases/tag/v1.0.0\n",
+			expected: "## [Unreleased]\n\n## [1.1.0] - 2024-02-01\n\n- Thing\n\n## [1.0.0]\n\n[Unreleased]: https://example.com/compare/v1.1.0...HEAD\n[1.1.0]: https://example.com/compare/v1.0.0...v1.1.0\n[1.0.0]: https://example.com/releases/tag/v1.0.0\n",
+		},
+		{
+			name:     "existing link",
+			content:  "## [Unreleased]\n\n- Thing\n\n[1.1.0]: https://example.com/releases/tag/v1.1.0\n",
+			expected: "## [Unreleased]\n\n## [1.1.0] - 2024-02-01\n\n- Thing\n\n[1.1.0]: https://example.com/releases/tag/v1.1.0\n",
+		},
+		{
+			name:     "no links",
+			content:  "## [Unreleased]\n\n- Thing\n\n## [1.0.0]\n",
+			expected: "## [Unreleased]\n\n## 1.1.0 - 2024-02-01\n\n- Thing\n\n## [1.0.0]\n",
+		},
+		{
+			name:     "unrecognised link",
+			content:  "## [Unreleased]\n\n- Thing\n\n[Unreleased]: https://example.com/commits/main\n",
+			expected: "## [Unreleased]\n\n## 1.1.0 - 2024-02-01\n\n- Thing\n\n[Unreleased]: https://example.com/commits/main\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := ParseChangelog(tt.content)
+			_, err := c.Promote("1.1.0", "2024-02-01", "v1.1.0")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, c.String())
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package common
+
+import (
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Local mode runs an action outside of a forge, reading what the forge would
+// provide from a config file and flags.
+var (
+	localMode       = flag.Bool("local", false, "Run outside a forge, using the local-* flags for repository details")
+	localConfig     = flag.String("local-config", "", "JSON file with repository details for local mode (implies -local)")
+	localWorkspace  = flag.String("local-workspace", "", "Workspace directory in local mode (defaults to the working directory)")
+	localServerURL  = flag.String("local-server-url", "", "Forge URL in local mode (defaults to https://github.com)")
+	localRepository = flag.String("local-repository", "", "Repository, as owner/name, in local mode")
+	localRef        = flag.String("local-ref", "", "Ref being built in local mode, such as refs/tags/v1.0.0")
+	localSHA        = flag.String("local-sha", "", "Commit being built in local mode")
+	localEvent      = flag.String("local-event", "", "Name of the event to simulate in local mode (defaults to workflow_dispatch)")
+	localEventPath  = flag.String("local-event-path", "", "JSON file with the event payload to simulate in local mode")
+	localDir        = flag.String("local-dir", "", "Directory to write outputs, env, path, summary and state to in local mode (defaults to .actions in the workspace)")
+)
+
+// LocalConfig describes the repository an action operates on in local mode.
+// Paths are relative to the working directory.
+type LocalConfig struct {
+	Workspace  string `json:"workspace"`
+	ServerURL  string `json:"server_url"`
+	Repository string `json:"repository"`
+	Ref        string `json:"ref"`
+	SHA        string `json:"sha"`
+	// EventName and EventPath describe the event to simulate. The payload
+	// is optional.
+	EventName string `json:"event_name"`
+	EventPath string `json:"event_path"`
+	// Dir receives the files a forge would normally provide for outputs,
+	// env, path, the step summary and state.
+	Dir string `json:"dir"`
+}
+
+// LoadLocalConfig reads a LocalConfig from a JSON file.
+func LoadLocalConfig(path string) (LocalConfig, error) {
+	var config LocalConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read local config: %w", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse local config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Context creates a context for running locally.
+func (l LocalConfig) Context() (*Context, error) {
+	workspace, err := filepath.Abs(cmp.Or(l.Workspace, "."))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve workspace: %w", err)
+	}
+
+	dir, err := filepath.Abs(cmp.Or(l.Dir, filepath.Join(workspace, ".actions")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve local directory: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create local directory: %w", err)
+	}
+
+	event, err := parseEvent(cmp.Or(l.EventName, "workflow_dispatch"), os.Getenv("USER"), l.EventPath)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := &Context{
+		Forge:       ForgeLocal,
+		Workspace:   workspace,
+		Token:       os.Getenv("ACTIONS_TOKEN"),
+		ServerURL:   cmp.Or(l.ServerURL, "https://github.com"),
+		Repository:  l.Repository,
+		Ref:         l.Ref,
+		SHA:         l.SHA,
+		OutputFile:  filepath.Join(dir, "output"),
+		PathFile:    filepath.Join(dir, "path"),
+		EnvFile:     filepath.Join(dir, "env"),
+		SummaryFile: filepath.Join(dir, "summary.md"),
+		StateFile:   filepath.Join(dir, "state"),
+	}
+	ctx.setEvent(event)
+	ctx.registerSecrets()
+	return ctx, nil
+}
+
+// localContext builds a context from the local-* flags, layered over the
+// config file if one was given. It returns nil if local mode is not enabled.
+func localContext() (*Context, error) {
+	if !*localMode && *localConfig == "" {
+		return nil, nil
+	}
+
+	var config LocalConfig
+	if *localConfig != "" {
+		var err error
+		if config, err = LoadLocalConfig(*localConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	return LocalConfig{
+		Workspace:  cmp.Or(*localWorkspace, config.Workspace),
+		ServerURL:  cmp.Or(*localServerURL, config.ServerURL),
+		Repository: cmp.Or(*localRepository, config.Repository),
+		Ref:        cmp.Or(*localRef, config.Ref),
+		SHA:        cmp.Or(*localSHA, config.SHA),
+		EventName:  cmp.Or(*localEvent, config.EventName),
+		EventPath:  cmp.Or(*localEventPath, config.EventPath),
+		Dir:        cmp.Or(*localDir, config.Dir),
+	}.Context()
+}
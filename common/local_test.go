@@ -0,0 +1,122 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unsetEnv removes an environment variable for the duration of the test.
+func unsetEnv(t *testing.T, key string) {
+	t.Setenv(key, "")
+	require.NoError(t, os.Unsetenv(key))
+}
+
+func TestContextFromEnv_Forge(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		expected Forge
+		err      string
+	}{
+		{
+			name:     "github",
+			env:      map[string]string{"GITHUB_JOB": "build", "GITHUB_REPOSITORY": "owner/repo"},
+			expected: ForgeGitHub,
+		},
+		{
+			name:     "forgejo",
+			env:      map[string]string{"GITHUB_JOB": "build", "FORGEJO_JOB": "build", "FORGEJO_REPOSITORY": "owner/repo"},
+			expected: ForgeForgejo,
+		},
+		{
+			name:     "gitea",
+			env:      map[string]string{"GITHUB_JOB": "build", "GITEA_ACTIONS": "true", "GITHUB_REPOSITORY": "owner/repo"},
+			expected: ForgeGitea,
+		},
+		{
+			name: "unknown",
+			err:  "unable to determine forge: none of FORGEJO_JOB, GITEA_ACTIONS or GITHUB_JOB set (use -local to run outside a forge)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"FORGEJO_JOB", "GITEA_ACTIONS", "GITHUB_JOB", "GITHUB_EVENT_NAME", "FORGEJO_EVENT_NAME"} {
+				unsetEnv(t, key)
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			ctx, err := ContextFromEnv()
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, ctx.Forge)
+			assert.Equal(t, "owner/repo", ctx.Repository)
+		})
+	}
+}
+
+func TestLocalConfig_Context(t *testing.T) {
+	workspace := t.TempDir()
+	configPath := filepath.Join(t.TempDir(), "local.json")
+	require.NoError(t, os.WriteFile(configPath, []byte(`{
+		"workspace": "`+workspace+`",
+		"repository": "owner/repo",
+		"ref": "refs/tags/v1.2.3",
+		"sha": "abc123"
+	}`), 0644))
+	t.Setenv("ACTIONS_TOKEN", "s3cret")
+	t.Setenv("USER", "dev")
+
+	config, err := LoadLocalConfig(configPath)
+	require.NoError(t, err)
+	ctx, err := config.Context()
+	require.NoError(t, err)
+
+	dir := filepath.Join(workspace, ".actions")
+	assert.Equal(t, &Context{
+		Forge:       ForgeLocal,
+		Workspace:   workspace,
+		Token:       "s3cret",
+		Actor:       "dev",
+		ServerURL:   "https://github.com",
+		Repository:  "owner/repo",
+		Ref:         "refs/tags/v1.2.3",
+		SHA:         "abc123",
+		OutputFile:  filepath.Join(dir, "output"),
+		PathFile:    filepath.Join(dir, "path"),
+		EnvFile:     filepath.Join(dir, "env"),
+		SummaryFile: filepath.Join(dir, "summary.md"),
+		StateFile:   filepath.Join(dir, "state"),
+		Event:       &Event{Name: "workflow_dispatch", Actor: "dev"},
+	}, ctx)
+	assert.DirExists(t, dir)
+	assert.Equal(t, "v1.2.3", ctx.Tag())
+
+	require.NoError(t, ctx.WriteOutput(map[string]string{"version": "1.2.3"}))
+	require.NoError(t, ctx.SaveState("authfile", "/tmp/auth.json"))
+	require.NoError(t, ctx.SaveState("notes", "one\ntwo"))
+	assert.FileExists(t, filepath.Join(dir, "output"))
+	assert.Equal(t, "/tmp/auth.json", ctx.GetState("authfile"))
+	assert.Equal(t, "one\ntwo", ctx.GetState("notes"))
+	assert.Equal(t, "", ctx.GetState("missing"))
+}
+
+func TestLoadLocalConfig_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "local.json")
+	require.NoError(t, os.WriteFile(path, []byte("not json"), 0644))
+
+	_, err := LoadLocalConfig(path)
+	assert.ErrorContains(t, err, "failed to parse local config")
+
+	_, err = LoadLocalConfig(filepath.Join(t.TempDir(), "missing.json"))
+	assert.ErrorContains(t, err, "failed to read local config")
+}
@@ -1,18 +1,214 @@
 package common
 
 import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"slices"
+	"strings"
+	"sync"
 )
 
+var (
+	logFormat = flag.String("log-format", "text", "Log format: text or json")
+	logLevel  = flag.String("log-level", "info", "Minimum level to log: debug, info, warn or error")
+)
+
+// redacted replaces secrets in log output, matching the forge's own masking.
+const redacted = "***"
+
+// sensitiveKeys are attribute keys whose values are always redacted, whether
+// or not they have been registered as secrets.
+var sensitiveKeys = []string{"token", "password", "passwd", "secret", "api_key", "apikey", "api-key", "authorization"}
+
+var secrets struct {
+	sync.RWMutex
+	values   []string
+	replacer *strings.Replacer
+}
+
+// RegisterSecret ensures the value is redacted from all log output. Values
+// passed to Context.AddMask are registered automatically.
+func RegisterSecret(value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+
+	secrets.Lock()
+	defer secrets.Unlock()
+	if slices.Contains(secrets.values, value) {
+		return
+	}
+	secrets.values = append(secrets.values, value)
+
+	// Replace longer secrets first, in case one contains another.
+	sorted := slices.SortedFunc(slices.Values(secrets.values), func(a, b string) int {
+		return cmp.Compare(len(b), len(a))
+	})
+	var pairs []string
+	for _, s := range sorted {
+		pairs = append(pairs, s, redacted)
+	}
+	secrets.replacer = strings.NewReplacer(pairs...)
+}
+
+// Redact replaces any registered secrets in s.
+func Redact(s string) string {
+	secrets.RLock()
+	defer secrets.RUnlock()
+	if secrets.replacer == nil {
+		return s
+	}
+	return secrets.replacer.Replace(s)
+}
+
+// LoggingOptions configures the handler built by NewLogHandler.
+type LoggingOptions struct {
+	// Format is either "text" (the default) or "json".
+	Format string
+	// Level is the minimum level to log: debug, info (the default), warn or
+	// error.
+	Level string
+}
+
+// ParseLevel converts a level name, such as "warn", to a slog.Level.
+func ParseLevel(name string) (slog.Level, error) {
+	if strings.EqualFold(name, "warning") {
+		return slog.LevelWarn, nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cmp.Or(name, "info"))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q", name)
+	}
+	return level, nil
+}
+
+// NewLogHandler creates a handler writing to w that redacts secrets.
+func NewLogHandler(w io.Writer, opts LoggingOptions) (slog.Handler, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(cmp.Or(opts.Format, "text")) {
+	case "text":
+		handler = slog.NewTextHandler(w, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q", opts.Format)
+	}
+
+	return &redactingHandler{next: handler}, nil
+}
+
+// ConfigureLogging sets the default logger according to the -log-format and
+// -log-level flags. If debug is set, debug messages are always logged.
 func ConfigureLogging(debug bool) {
-	level := slog.LevelInfo
+	opts := LoggingOptions{Format: *logFormat, Level: *logLevel}
 	if debug {
-		level = slog.LevelDebug
+		opts.Level = "debug"
+	}
+
+	handler, err := NewLogHandler(os.Stderr, opts)
+	if err != nil {
+		handler, _ = NewLogHandler(os.Stderr, LoggingOptions{})
+	}
+	slog.SetDefault(slog.New(handler))
+
+	if err != nil {
+		slog.Warn("Invalid logging configuration, using defaults", "error", err)
+	}
+}
+
+// redactingHandler removes secrets from records. Attributes are held back
+// until a record is handled, so later secrets are still redacted.
+type redactingHandler struct {
+	next    slog.Handler
+	applied []func(slog.Handler) slog.Handler
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	next := h.next
+	for _, apply := range h.applied {
+		next = apply(next)
 	}
-	handler := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
-		Level: level,
+
+	res := slog.NewRecord(r.Time, r.Level, Redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		res.AddAttrs(redactAttr(a))
+		return true
+	})
+	return next.Handle(ctx, res)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler {
+		redactedAttrs := make([]slog.Attr, len(attrs))
+		for i, a := range attrs {
+			redactedAttrs[i] = redactAttr(a)
+		}
+		return next.WithAttrs(redactedAttrs)
 	})
-	logger := slog.New(handler)
-	slog.SetDefault(logger)
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler {
+		return next.WithGroup(name)
+	})
+}
+
+func (h *redactingHandler) with(apply func(slog.Handler) slog.Handler) slog.Handler {
+	return &redactingHandler{next: h.next, applied: append(slices.Clip(h.applied), apply)}
+}
+
+func redactAttr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		group := a.Value.Group()
+		res := make([]slog.Attr, len(group))
+		for i, g := range group {
+			res[i] = redactAttr(g)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(res...)}
+	case slog.KindString:
+		if isSensitiveKey(a.Key) && a.Value.String() != "" {
+			return slog.String(a.Key, redacted)
+		}
+		return slog.String(a.Key, Redact(a.Value.String()))
+	case slog.KindAny:
+		if isSensitiveKey(a.Key) && a.Value.Any() != nil {
+			return slog.String(a.Key, redacted)
+		}
+		// Values such as argument slices and errors are checked via their
+		// string form, and only replaced if they contain a secret.
+		s := fmt.Sprint(a.Value.Any())
+		if r := Redact(s); r != s {
+			return slog.String(a.Key, r)
+		}
+	}
+	return a
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, k := range sensitiveKeys {
+		if key == k || strings.HasSuffix(key, "_"+k) || strings.HasSuffix(key, "-"+k) {
+			return true
+		}
+	}
+	return false
 }
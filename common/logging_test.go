@@ -0,0 +1,147 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withSecrets replaces the registered secrets for the duration of the test.
+func withSecrets(t *testing.T, values ...string) {
+	secrets.Lock()
+	original, originalReplacer := secrets.values, secrets.replacer
+	secrets.values, secrets.replacer = nil, nil
+	secrets.Unlock()
+	t.Cleanup(func() {
+		secrets.Lock()
+		secrets.values, secrets.replacer = original, originalReplacer
+		secrets.Unlock()
+	})
+
+	for _, v := range values {
+		RegisterSecret(v)
+	}
+}
+
+func TestRedactingHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		log      func(l *slog.Logger)
+		expected string
+	}{
+		{
+			name:     "message",
+			log:      func(l *slog.Logger) { l.Info("using ghs_abc123 to push") },
+			expected: `level=INFO msg="using *** to push"`,
+		},
+		{
+			name:     "string attribute",
+			log:      func(l *slog.Logger) { l.Info("auth", "header", "Basic ghs_abc123") },
+			expected: `level=INFO msg=auth header="Basic ***"`,
+		},
+		{
+			name:     "argument slice",
+			log:      func(l *slog.Logger) { l.Debug("exec", "args", []string{"login", "-p", "hunter2"}) },
+			expected: `level=DEBUG msg=exec args="[login -p ***]"`,
+		},
+		{
+			name:     "unaffected slice",
+			log:      func(l *slog.Logger) { l.Debug("exec", "args", []string{"build", "."}) },
+			expected: `level=DEBUG msg=exec args="[build .]"`,
+		},
+		{
+			name:     "error",
+			log:      func(l *slog.Logger) { l.Error("failed", "error", errors.New("bad password hunter2")) },
+			expected: `level=ERROR msg=failed error="bad password ***"`,
+		},
+		{
+			name:     "sensitive keys",
+			log:      func(l *slog.Logger) { l.Info("config", "api_token", "unregistered", "password", "", "tokens", 3) },
+			expected: `level=INFO msg=config api_token=*** password="" tokens=3`,
+		},
+		{
+			name: "groups and attributes",
+			log: func(l *slog.Logger) {
+				l.With("user", "hunter2").WithGroup("req").Info("sent", slog.Group("auth", "value", "ghs_abc123"))
+			},
+			expected: `level=INFO msg=sent user=*** req.auth.value=***`,
+		},
+		{
+			name: "secrets registered after attributes",
+			log: func(l *slog.Logger) {
+				l = l.With("late", "s3cret-later")
+				RegisterSecret("s3cret-later")
+				l.Info("late")
+			},
+			expected: `level=INFO msg=late late=***`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withSecrets(t, "ghs_abc123", "hunter2")
+
+			var buf bytes.Buffer
+			handler, err := NewLogHandler(&buf, LoggingOptions{Level: "debug"})
+			require.NoError(t, err)
+			tt.log(slog.New(handler))
+
+			line := bytes.TrimSpace(buf.Bytes())
+			_, line, _ = bytes.Cut(line, []byte(" "))
+			assert.Equal(t, tt.expected, string(line))
+		})
+	}
+}
+
+func TestNewLogHandler_JSON(t *testing.T) {
+	withSecrets(t, "hunter2")
+
+	var buf bytes.Buffer
+	handler, err := NewLogHandler(&buf, LoggingOptions{Format: "json", Level: "warn"})
+	require.NoError(t, err)
+
+	logger := slog.New(handler)
+	logger.Info("hidden")
+	logger.Warn("login failed", "password", "hunter2", "registry", "ghcr.io")
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "WARN", entry["level"])
+	assert.Equal(t, "login failed", entry["msg"])
+	assert.Equal(t, "***", entry["password"])
+	assert.Equal(t, "ghcr.io", entry["registry"])
+}
+
+func TestNewLogHandler_Invalid(t *testing.T) {
+	_, err := NewLogHandler(&bytes.Buffer{}, LoggingOptions{Format: "xml"})
+	assert.EqualError(t, err, `invalid log format "xml"`)
+
+	_, err = NewLogHandler(&bytes.Buffer{}, LoggingOptions{Level: "loud"})
+	assert.EqualError(t, err, `invalid log level "loud"`)
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, expected := range map[string]slog.Level{
+		"":        slog.LevelInfo,
+		"debug":   slog.LevelDebug,
+		"INFO":    slog.LevelInfo,
+		"warn":    slog.LevelWarn,
+		"warning": slog.LevelWarn,
+		"error":   slog.LevelError,
+	} {
+		level, err := ParseLevel(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, expected, level, name)
+	}
+}
+
+func TestContext_AddMaskRedactsLogs(t *testing.T) {
+	withSecrets(t)
+	(&Context{Stdout: &bytes.Buffer{}}).AddMask("first\nsecond")
+	assert.Equal(t, "*** and ***", Redact("first and second"))
+}
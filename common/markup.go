@@ -0,0 +1,641 @@
+package common
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MarkupFormat is a format release notes can be rendered in for sites that
+// don't accept markdown.
+type MarkupFormat string
+
+const (
+	FormatMarkdown MarkupFormat = "markdown"
+	FormatHTML     MarkupFormat = "html"
+	FormatBBCode   MarkupFormat = "bbcode"
+	FormatText     MarkupFormat = "text"
+)
+
+// RenderMarkdown converts the subset of markdown found in changelogs to the
+// given format, keeping only http, https and mailto links.
+func RenderMarkdown(markdown string, format MarkupFormat) (string, error) {
+	var r renderer
+	switch format {
+	case FormatMarkdown:
+		return markdown, nil
+	case FormatHTML:
+		r = htmlRenderer{}
+	case FormatBBCode:
+		r = bbcodeRenderer{}
+	case FormatText:
+		r = textRenderer{}
+	default:
+		return "", fmt.Errorf("unknown format %q", format)
+	}
+
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+	return r.blocks(parseBlocks(lines)), nil
+}
+
+type blockKind int
+
+const (
+	blockParagraph blockKind = iota
+	blockHeading
+	blockList
+	blockCode
+	blockQuote
+	blockRule
+)
+
+// block is a block-level element of a markdown document.
+type block struct {
+	kind blockKind
+	// level is the level of a heading.
+	level int
+	// text is the inline content of a heading or paragraph, or the content
+	// of a code block.
+	text string
+	// lang is the info string of a fenced code block.
+	lang string
+	// ordered is set for numbered lists, starting at start.
+	ordered bool
+	start   int
+	// items are the contents of each item of a list.
+	items [][]*block
+	// children are the contents of a quote.
+	children []*block
+}
+
+var (
+	atxHeadingRe = regexp.MustCompile(`^ {0,3}(#{1,6})(?:\s+(.*?))?(?:\s+#+)?\s*$`)
+	fenceRe      = regexp.MustCompile("^ {0,3}(```+|~~~+)\\s*(\\S*)")
+	ruleRe       = regexp.MustCompile(`^ {0,3}(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	quoteRe      = regexp.MustCompile(`^ {0,3}> ?`)
+	itemRe       = regexp.MustCompile(`^( {0,3})(?:([-*+])|(\d{1,9})([.)]))(?:\s+|$)`)
+)
+
+func parseBlocks(lines []string) []*block {
+	var blocks []*block
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+		case fenceRe.MatchString(line):
+			b, n := parseFence(lines[i:])
+			blocks = append(blocks, b)
+			i += n
+		case atxHeadingRe.MatchString(line):
+			matches := atxHeadingRe.FindStringSubmatch(line)
+			blocks = append(blocks, &block{kind: blockHeading, level: len(matches[1]), text: matches[2]})
+			i++
+		case ruleRe.MatchString(line):
+			blocks = append(blocks, &block{kind: blockRule})
+			i++
+		case quoteRe.MatchString(line):
+			var quoted []string
+			for ; i < len(lines) && quoteRe.MatchString(lines[i]); i++ {
+				quoted = append(quoted, quoteRe.ReplaceAllString(lines[i], ""))
+			}
+			blocks = append(blocks, &block{kind: blockQuote, children: parseBlocks(quoted)})
+		case itemRe.MatchString(line):
+			b, n := parseList(lines[i:])
+			blocks = append(blocks, b)
+			i += n
+		default:
+			var text []string
+			for ; i < len(lines) && strings.TrimSpace(lines[i]) != "" && (len(text) == 0 || !interruptsParagraph(lines[i])); i++ {
+				text = append(text, strings.TrimSpace(lines[i]))
+			}
+			blocks = append(blocks, &block{kind: blockParagraph, text: strings.Join(text, " ")})
+		}
+	}
+	return blocks
+}
+
+// interruptsParagraph reports whether the line starts a new block rather
+// than continuing a paragraph.
+func interruptsParagraph(line string) bool {
+	return fenceRe.MatchString(line) || atxHeadingRe.MatchString(line) || ruleRe.MatchString(line) ||
+		quoteRe.MatchString(line) || itemRe.MatchString(line)
+}
+
+// parseFence parses a fenced code block, returning it and the number of
+// lines it spans. An unclosed fence runs to the end of the document.
+func parseFence(lines []string) (*block, int) {
+	matches := fenceRe.FindStringSubmatch(lines[0])
+	fence := matches[1]
+	var code []string
+	n := 1
+	for ; n < len(lines); n++ {
+		if trimmed := strings.TrimSpace(lines[n]); strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			n++
+			break
+		}
+		code = append(code, lines[n])
+	}
+	return &block{kind: blockCode, lang: matches[2], text: strings.Join(code, "\n")}, n
+}
+
+// parseList parses a list, returning it and the number of lines it spans.
+func parseList(lines []string) (*block, int) {
+	first := itemRe.FindStringSubmatch(lines[0])
+	list := &block{kind: blockList, ordered: first[3] != ""}
+	if list.ordered {
+		list.start, _ = strconv.Atoi(first[3])
+	}
+	marker := first[2] + first[4]
+
+	n := 0
+	for n < len(lines) {
+		matches := itemRe.FindStringSubmatch(lines[n])
+		if matches == nil || matches[2]+matches[4] != marker {
+			break
+		}
+		indent := len(matches[1]) + len(marker) + 1
+
+		item := []string{strings.TrimLeftFunc(lines[n][len(matches[0]):], unicode.IsSpace)}
+		blank := false
+	item:
+		for n++; n < len(lines); n++ {
+			line := lines[n]
+			leading := len(line) - len(strings.TrimLeft(line, " "))
+			switch {
+			case strings.TrimSpace(line) == "":
+				blank = true
+				item = append(item, "")
+				continue
+			case leading > len(matches[1]):
+				item = append(item, line[min(leading, indent):])
+			case !blank && !interruptsParagraph(line):
+				item = append(item, line)
+			default:
+				break item
+			}
+			blank = false
+		}
+		list.items = append(list.items, parseBlocks(item))
+	}
+
+	// Trailing blank lines belong after the list, not in it.
+	for n > 1 && strings.TrimSpace(lines[n-1]) == "" {
+		n--
+	}
+	return list, n
+}
+
+type inlineKind int
+
+const (
+	inlineText inlineKind = iota
+	inlineCode
+	inlineStrong
+	inlineEmphasis
+	inlineLink
+)
+
+// inline is a span of text within a heading or paragraph.
+type inline struct {
+	kind     inlineKind
+	text     string
+	url      string
+	children []inline
+}
+
+// escapable lists the characters a backslash escapes.
+const escapable = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+
+// parseInlines parses emphasis, code spans, links and autolinks. Delimiters
+// without a match are kept as text.
+func parseInlines(s string) []inline {
+	var res []inline
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			res = append(res, inline{kind: inlineText, text: text.String()})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(escapable, s[i+1]) >= 0:
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+		case c == '`':
+			run := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+			delim := s[i : i+run]
+			if end := strings.Index(s[i+run:], delim); end >= 0 {
+				flush()
+				code := s[i+run : i+run+end]
+				if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' {
+					code = code[1 : len(code)-1]
+				}
+				res = append(res, inline{kind: inlineCode, text: code})
+				i += run + end + run
+				continue
+			}
+			text.WriteString(delim)
+			i += run
+			continue
+		case c == '*' || c == '_':
+			if span, n, ok := parseEmphasis(s, i); ok {
+				flush()
+				res = append(res, span)
+				i += n
+				continue
+			}
+		case c == '[':
+			if span, n, ok := parseLink(s[i:]); ok {
+				flush()
+				if safeURL(span.url) {
+					res = append(res, span)
+				} else {
+					// Keep the text of links that could run scripts or
+					// wouldn't resolve where the notes are published.
+					res = append(res, span.children...)
+				}
+				i += n
+				continue
+			}
+		case c == '<':
+			if end := strings.IndexByte(s[i:], '>'); end > 0 {
+				url := s[i+1 : i+end]
+				if (strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")) && !strings.ContainsAny(url, " <") {
+					flush()
+					res = append(res, inline{kind: inlineLink, url: url, children: []inline{{kind: inlineText, text: url}}})
+					i += end + 1
+					continue
+				}
+			}
+		}
+		text.WriteByte(c)
+		i++
+	}
+	flush()
+	return res
+}
+
+// parseEmphasis parses emphasis at s[i]. Underscores only count at word
+// boundaries, so snake_case is left alone.
+func parseEmphasis(s string, i int) (inline, int, bool) {
+	c := s[i]
+	if c == '_' && i > 0 && isWordByte(s[i-1]) {
+		return inline{}, 0, false
+	}
+
+	delim, kind := string(c), inlineEmphasis
+	if strings.HasPrefix(s[i:], strings.Repeat(string(c), 2)) {
+		delim, kind = strings.Repeat(string(c), 2), inlineStrong
+	}
+
+	start := i + len(delim)
+	if start >= len(s) || s[start] == ' ' {
+		return inline{}, 0, false
+	}
+	for j := start + 1; j+len(delim) <= len(s); j++ {
+		if s[j:j+len(delim)] != delim || s[j-1] == ' ' {
+			continue
+		}
+		if kind == inlineEmphasis && j+1 < len(s) && s[j+1] == c {
+			// Part of a nested strong delimiter.
+			j++
+			continue
+		}
+		if c == '_' && j+len(delim) < len(s) && isWordByte(s[j+len(delim)]) {
+			continue
+		}
+		return inline{kind: kind, children: parseInlines(s[start:j])}, j + len(delim) - i, true
+	}
+	return inline{}, 0, false
+}
+
+// parseLink parses an inline link such as "[text](url)" at the start of s,
+// returning it and the number of bytes it spans.
+func parseLink(s string) (inline, int, bool) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			if i+1 >= len(s) || s[i+1] != '(' {
+				return inline{}, 0, false
+			}
+			end := strings.IndexByte(s[i+2:], ')')
+			if end < 0 {
+				return inline{}, 0, false
+			}
+			target := strings.TrimSpace(s[i+2 : i+2+end])
+			if url, _, ok := strings.Cut(target, " "); ok {
+				// Drop any title.
+				target = url
+			}
+			target = strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">")
+			return inline{kind: inlineLink, url: target, children: parseInlines(s[1:i])}, i + 2 + end + 1, true
+		}
+	}
+	return inline{}, 0, false
+}
+
+// safeSchemes are the URL schemes links may use.
+var safeSchemes = []string{"http", "https", "mailto"}
+
+// safeURL reports whether the URL is absolute and uses one of safeSchemes.
+func safeURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && slices.Contains(safeSchemes, strings.ToLower(u.Scheme))
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b >= utf8.RuneSelf
+}
+
+// plainText returns the text of the spans without any formatting.
+func plainText(spans []inline) string {
+	var b strings.Builder
+	for _, s := range spans {
+		if s.children != nil {
+			b.WriteString(plainText(s.children))
+		} else {
+			b.WriteString(s.text)
+		}
+	}
+	return b.String()
+}
+
+type renderer interface {
+	blocks(blocks []*block) string
+}
+
+type htmlRenderer struct{}
+
+func (r htmlRenderer) blocks(blocks []*block) string {
+	res := make([]string, len(blocks))
+	for i, b := range blocks {
+		res[i] = r.block(b)
+	}
+	return strings.Join(res, "\n")
+}
+
+func (r htmlRenderer) block(b *block) string {
+	switch b.kind {
+	case blockHeading:
+		return fmt.Sprintf("<h%d>%s</h%d>", b.level, r.inlines(parseInlines(b.text)), b.level)
+	case blockList:
+		tag, attrs := "ul", ""
+		if b.ordered {
+			tag = "ol"
+			if b.start != 1 {
+				attrs = fmt.Sprintf(` start="%d"`, b.start)
+			}
+		}
+		var s strings.Builder
+		fmt.Fprintf(&s, "<%s%s>\n", tag, attrs)
+		for _, item := range b.items {
+			s.WriteString("<li>")
+			rest := item
+			if len(item) > 0 && item[0].kind == blockParagraph {
+				s.WriteString(r.inlines(parseInlines(item[0].text)))
+				rest = item[1:]
+			}
+			if len(rest) > 0 {
+				s.WriteString("\n" + r.blocks(rest) + "\n")
+			}
+			s.WriteString("</li>\n")
+		}
+		fmt.Fprintf(&s, "</%s>", tag)
+		return s.String()
+	case blockCode:
+		class := ""
+		if b.lang != "" {
+			class = fmt.Sprintf(` class="language-%s"`, html.EscapeString(b.lang))
+		}
+		return fmt.Sprintf("<pre><code%s>%s</code></pre>", class, html.EscapeString(b.text))
+	case blockQuote:
+		return "<blockquote>\n" + r.blocks(b.children) + "\n</blockquote>"
+	case blockRule:
+		return "<hr>"
+	default:
+		return "<p>" + r.inlines(parseInlines(b.text)) + "</p>"
+	}
+}
+
+func (r htmlRenderer) inlines(spans []inline) string {
+	var b strings.Builder
+	for _, s := range spans {
+		switch s.kind {
+		case inlineCode:
+			fmt.Fprintf(&b, "<code>%s</code>", html.EscapeString(s.text))
+		case inlineStrong:
+			fmt.Fprintf(&b, "<strong>%s</strong>", r.inlines(s.children))
+		case inlineEmphasis:
+			fmt.Fprintf(&b, "<em>%s</em>", r.inlines(s.children))
+		case inlineLink:
+			fmt.Fprintf(&b, `<a href="%s">%s</a>`, html.EscapeString(s.url), r.inlines(s.children))
+		default:
+			b.WriteString(html.EscapeString(s.text))
+		}
+	}
+	return b.String()
+}
+
+// BBCode can't escape tags, so brackets are encoded in URLs and removed from
+// text where they could be read as one.
+var (
+	bbcodeTagRe       = regexp.MustCompile(`\[(/?[A-Za-z*][^\[\]]*)\]`)
+	bbcodeURLReplacer = strings.NewReplacer("[", "%5B", "]", "%5D")
+	bbcodeCodeEndRe   = regexp.MustCompile(`(?i)\[/code\]`)
+)
+
+// bbcodeText removes the brackets from anything in the text that looks like
+// a tag, leaving others such as "[1.0.0]" alone.
+func bbcodeText(s string) string {
+	for bbcodeTagRe.MatchString(s) {
+		// Repeat, as removing "[b]" from "[[b]]" forms another tag.
+		s = bbcodeTagRe.ReplaceAllString(s, "$1")
+	}
+	return s
+}
+
+type bbcodeRenderer struct{}
+
+func (r bbcodeRenderer) blocks(blocks []*block) string {
+	res := make([]string, len(blocks))
+	for i, b := range blocks {
+		res[i] = r.block(b)
+	}
+	return strings.Join(res, "\n\n")
+}
+
+func (r bbcodeRenderer) block(b *block) string {
+	switch b.kind {
+	case blockHeading:
+		text := "[b]" + r.inlines(parseInlines(b.text)) + "[/b]"
+		if b.level <= 3 {
+			text = fmt.Sprintf("[size=%d]%s[/size]", 7-b.level, text)
+		}
+		return text
+	case blockList:
+		var s strings.Builder
+		if b.ordered {
+			fmt.Fprintf(&s, "[list=%d]\n", b.start)
+		} else {
+			s.WriteString("[list]\n")
+		}
+		for _, item := range b.items {
+			s.WriteString("[*]")
+			s.WriteString(r.item(item))
+			s.WriteString("\n")
+		}
+		s.WriteString("[/list]")
+		return s.String()
+	case blockCode:
+		return "[code]" + bbcodeCodeEndRe.ReplaceAllString(b.text, "/code") + "[/code]"
+	case blockQuote:
+		return "[quote]" + r.blocks(b.children) + "[/quote]"
+	case blockRule:
+		return "----"
+	default:
+		return r.inlines(parseInlines(b.text))
+	}
+}
+
+// item renders the contents of a list item, keeping nested lists on their
+// own lines without blank lines between them.
+func (r bbcodeRenderer) item(blocks []*block) string {
+	res := make([]string, len(blocks))
+	for i, b := range blocks {
+		res[i] = r.block(b)
+	}
+	return strings.Join(res, "\n")
+}
+
+func (r bbcodeRenderer) inlines(spans []inline) string {
+	var b strings.Builder
+	for _, s := range spans {
+		switch s.kind {
+		case inlineCode:
+			fmt.Fprintf(&b, "[font=Courier New]%s[/font]", bbcodeText(s.text))
+		case inlineStrong:
+			fmt.Fprintf(&b, "[b]%s[/b]", r.inlines(s.children))
+		case inlineEmphasis:
+			fmt.Fprintf(&b, "[i]%s[/i]", r.inlines(s.children))
+		case inlineLink:
+			url := bbcodeURLReplacer.Replace(s.url)
+			if text := plainText(s.children); text == s.url {
+				fmt.Fprintf(&b, "[url]%s[/url]", url)
+			} else {
+				fmt.Fprintf(&b, "[url=%s]%s[/url]", url, r.inlines(s.children))
+			}
+		default:
+			b.WriteString(bbcodeText(s.text))
+		}
+	}
+	return b.String()
+}
+
+type textRenderer struct{}
+
+func (r textRenderer) blocks(blocks []*block) string {
+	res := make([]string, len(blocks))
+	for i, b := range blocks {
+		res[i] = r.block(b)
+	}
+	return strings.Join(res, "\n\n")
+}
+
+func (r textRenderer) block(b *block) string {
+	switch b.kind {
+	case blockHeading:
+		text := r.inlines(parseInlines(b.text))
+		underline := "-"
+		if b.level == 1 {
+			underline = "="
+		}
+		return text + "\n" + strings.Repeat(underline, utf8.RuneCountInString(text))
+	case blockList:
+		items := make([]string, len(b.items))
+		for i, item := range b.items {
+			marker := "- "
+			if b.ordered {
+				marker = fmt.Sprintf("%d. ", b.start+i)
+			}
+			items[i] = marker + indent(r.item(item), strings.Repeat(" ", len(marker)))
+		}
+		return strings.Join(items, "\n")
+	case blockCode:
+		return "    " + indent(b.text, "    ")
+	case blockQuote:
+		return "> " + strings.ReplaceAll(r.blocks(b.children), "\n", "\n> ")
+	case blockRule:
+		return "----"
+	default:
+		return r.inlines(parseInlines(b.text))
+	}
+}
+
+// item renders the contents of a list item, keeping nested lists directly
+// below the item's text.
+func (r textRenderer) item(blocks []*block) string {
+	var s strings.Builder
+	for i, b := range blocks {
+		if i > 0 {
+			if b.kind == blockList && blocks[i-1].kind == blockParagraph {
+				s.WriteString("\n")
+			} else {
+				s.WriteString("\n\n")
+			}
+		}
+		s.WriteString(r.block(b))
+	}
+	return s.String()
+}
+
+func (r textRenderer) inlines(spans []inline) string {
+	var b strings.Builder
+	for _, s := range spans {
+		switch s.kind {
+		case inlineStrong, inlineEmphasis:
+			b.WriteString(r.inlines(s.children))
+		case inlineLink:
+			text := r.inlines(s.children)
+			if text == s.url {
+				b.WriteString(s.url)
+			} else {
+				fmt.Fprintf(&b, "%s (%s)", text, s.url)
+			}
+		default:
+			b.WriteString(s.text)
+		}
+	}
+	return b.String()
+}
+
+// indent prefixes every line but the first with the given indent, leaving
+// blank lines empty.
+func indent(text, prefix string) string {
+	lines := strings.Split(text, "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = prefix + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
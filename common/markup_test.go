@@ -0,0 +1,55 @@
+package common
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+func TestRenderMarkdown(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "markup", "*.md"))
+	require.NoError(t, err)
+	require.NotEmpty(t, inputs)
+
+	extensions := map[MarkupFormat]string{
+		FormatHTML:   ".html",
+		FormatBBCode: ".bbcode",
+		FormatText:   ".txt",
+	}
+
+	for _, input := range inputs {
+		markdown, err := os.ReadFile(input)
+		require.NoError(t, err)
+
+		for format, ext := range extensions {
+			golden := strings.TrimSuffix(input, ".md") + ext
+			t.Run(filepath.Base(golden), func(t *testing.T) {
+				actual, err := RenderMarkdown(string(markdown), format)
+				require.NoError(t, err)
+
+				if *updateGolden {
+					require.NoError(t, os.WriteFile(golden, []byte(actual+"\n"), 0644))
+				}
+				expected, err := os.ReadFile(golden)
+				require.NoError(t, err)
+				assert.Equal(t, string(expected), actual+"\n")
+			})
+		}
+	}
+}
+
+func TestRenderMarkdown_Formats(t *testing.T) {
+	actual, err := RenderMarkdown("- *as is*", FormatMarkdown)
+	require.NoError(t, err)
+	assert.Equal(t, "- *as is*", actual)
+
+	_, err = RenderMarkdown("text", "rtf")
+	assert.EqualError(t, err, `unknown format "rtf"`)
+}
@@ -0,0 +1,321 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how many times, and how often, a failed operation is
+// retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times to try the operation,
+	// including the first attempt.
+	MaxAttempts int
+	// InitialDelay is the delay before the first retry. It doubles for each
+	// subsequent retry, up to MaxDelay.
+	InitialDelay time.Duration
+	// MaxDelay caps the delay between attempts.
+	MaxDelay time.Duration
+	// Deadline is the total time allowed for all attempts. Zero for no limit.
+	Deadline time.Duration
+}
+
+// DefaultRetryPolicy is used for all network operations.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:  5,
+	InitialDelay: time.Second,
+	MaxDelay:     30 * time.Second,
+	Deadline:     5 * time.Minute,
+}
+
+// HTTPClient is an HTTP client that retries transient failures according to
+// DefaultRetryPolicy.
+var HTTPClient = &http.Client{Transport: &RetryTransport{}}
+
+// sleep is replaced in tests to avoid waiting.
+var sleep = time.Sleep
+
+// TransientError marks an error as being worth retrying, optionally after a
+// delay requested by the server.
+type TransientError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *TransientError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+// Transient marks err as worth retrying.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &TransientError{Err: err}
+}
+
+// PermanentError marks an error as not worth retrying, even if it wraps a
+// network error that otherwise would be.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent marks err as not worth retrying.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// Retry calls fn until it succeeds, fails with an error that isn't
+// retryable, or the policy is exhausted.
+func Retry(policy RetryPolicy, operation string, fn func() error) error {
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		retry, after := IsRetryable(err)
+		if !retry {
+			return err
+		}
+
+		delay, ok := policy.next(attempt, start, after)
+		if !ok {
+			return fmt.Errorf("%s failed after %d attempts: %w", operation, attempt, err)
+		}
+
+		slog.Warn("Retrying after transient failure", "operation", operation, "attempt", attempt, "delay", delay, "error", err)
+		sleep(delay)
+	}
+}
+
+// IsRetryable determines whether an error is likely to be transient, and
+// returns any delay requested before retrying.
+func IsRetryable(err error) (bool, time.Duration) {
+	var permanent *PermanentError
+	if errors.As(err, &permanent) {
+		return false, 0
+	}
+
+	var transient *TransientError
+	if errors.As(err, &transient) {
+		return true, transient.RetryAfter
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) {
+		return true, 0
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true, 0
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && (dnsErr.IsTemporary || dnsErr.IsTimeout) {
+		return true, 0
+	}
+
+	return false, 0
+}
+
+// IsRetryableResponse reports whether a response is a 5xx or 429, and any
+// delay its Retry-After header asks for.
+func IsRetryableResponse(resp *http.Response) (bool, time.Duration) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		return false, 0
+	}
+	if resp.StatusCode == http.StatusNotImplemented || resp.StatusCode == http.StatusHTTPVersionNotSupported {
+		return false, 0
+	}
+	return true, parseRetryAfter(resp.Header.Get("Retry-After"))
+}
+
+// IsRetryableMessage determines whether the output of an external command
+// describes a transient network failure.
+func IsRetryableMessage(message string) bool {
+	message = strings.ToLower(message)
+	for _, marker := range []string{
+		"connection reset",
+		"connection refused",
+		"broken pipe",
+		"unexpected eof",
+		"i/o timeout",
+		"tls handshake timeout",
+		"too many requests",
+		"bad gateway",
+		"service unavailable",
+		"gateway timeout",
+		"internal server error",
+	} {
+		if strings.Contains(message, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
+
+// next returns the delay before the next attempt, or false to give up.
+func (p RetryPolicy) next(attempt int, start time.Time, after time.Duration) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+
+	delay := after
+	if delay == 0 {
+		backoff := p.InitialDelay << (attempt - 1)
+		if backoff <= 0 || backoff > p.MaxDelay {
+			backoff = p.MaxDelay
+		}
+		// Equal jitter: half the backoff, plus up to half again at random.
+		delay = backoff/2 + rand.N(backoff/2+1)
+	}
+
+	if p.Deadline > 0 && time.Since(start)+delay > p.Deadline {
+		return 0, false
+	}
+	return delay, true
+}
+
+// RetryTransport retries requests that fail transiently. Requests that aren't
+// SafeToRepeat, such as uploads, are only retried if they're Unprocessed.
+type RetryTransport struct {
+	// Base performs the requests. Defaults to http.DefaultTransport.
+	Base http.RoundTripper
+	// Policy controls retries. Defaults to DefaultRetryPolicy.
+	Policy *RetryPolicy
+}
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	policy := DefaultRetryPolicy
+	if t.Policy != nil {
+		policy = *t.Policy
+	}
+
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		resp, err := base.RoundTrip(req)
+
+		var retry bool
+		var after time.Duration
+		if err != nil {
+			retry, after = IsRetryable(err)
+		} else {
+			retry, after = IsRetryableResponse(resp)
+		}
+
+		if retry && !SafeToRepeat(req) && !Unprocessed(resp, err) {
+			retry = false
+		}
+
+		if !retry || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+			return resp, err
+		}
+
+		delay, ok := policy.next(attempt, start, after)
+		if !ok {
+			return resp, err
+		}
+
+		if err == nil {
+			slog.Warn("Retrying HTTP request", "method", req.Method, "url", req.URL.Redacted(), "status", resp.StatusCode, "attempt", attempt, "delay", delay)
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		} else {
+			slog.Warn("Retrying HTTP request", "method", req.Method, "url", req.URL.Redacted(), "error", err, "attempt", attempt, "delay", delay)
+		}
+
+		sleep(delay)
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewind request body: %w", err)
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+type repeatableKey struct{}
+
+// Repeatable marks the request as safe to repeat although its method isn't
+// idempotent, such as a POST that only reads.
+func Repeatable(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), repeatableKey{}, true))
+}
+
+// SafeToRepeat reports whether the request is idempotent, marked Repeatable,
+// or a git fetch.
+func SafeToRepeat(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	if repeatable, _ := req.Context().Value(repeatableKey{}).(bool); repeatable {
+		return true
+	}
+	return strings.HasSuffix(req.URL.Path, "/git-upload-pack")
+}
+
+// Unprocessed reports whether a failed request can't have taken effect: it
+// was never sent, or was rejected with a 429.
+func Unprocessed(resp *http.Response, err error) bool {
+	if err == nil {
+		return resp != nil && resp.StatusCode == http.StatusTooManyRequests
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
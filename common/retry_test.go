@@ -0,0 +1,323 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts:  4,
+	InitialDelay: 10 * time.Millisecond,
+	MaxDelay:     100 * time.Millisecond,
+}
+
+// recordSleeps replaces sleep for the duration of the test, returning the
+// delays that were requested.
+func recordSleeps(t *testing.T) *[]time.Duration {
+	var delays []time.Duration
+	original := sleep
+	sleep = func(d time.Duration) { delays = append(delays, d) }
+	t.Cleanup(func() { sleep = original })
+	return &delays
+}
+
+// flakyServer responds to the first failures requests using fail, and then
+// with 200 OK echoing the request body.
+func flakyServer(t *testing.T, failures int, fail func(w http.ResponseWriter)) (*httptest.Server, *atomic.Int32) {
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if int(count.Add(1)) <= failures {
+			fail(w)
+			return
+		}
+		_, _ = fmt.Fprintf(w, "ok:%s", body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &count
+}
+
+func resetConnection(w http.ResponseWriter) {
+	conn, _, _ := w.(http.Hijacker).Hijack()
+	_ = conn.Close()
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int
+		fail       func(w http.ResponseWriter)
+		status     int
+		attempts   int32
+		retryAfter time.Duration
+	}{
+		{
+			name:     "recovers from server errors",
+			failures: 2,
+			fail:     func(w http.ResponseWriter) { w.WriteHeader(http.StatusBadGateway) },
+			status:   http.StatusOK,
+			attempts: 3,
+		},
+		{
+			name:     "recovers from connection resets",
+			failures: 2,
+			fail:     resetConnection,
+			status:   http.StatusOK,
+			attempts: 3,
+		},
+		{
+			name:     "honours retry-after",
+			failures: 1,
+			fail: func(w http.ResponseWriter) {
+				w.Header().Set("Retry-After", "7")
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+			status:     http.StatusOK,
+			attempts:   2,
+			retryAfter: 7 * time.Second,
+		},
+		{
+			name:     "does not retry client errors",
+			failures: 1,
+			fail:     func(w http.ResponseWriter) { w.WriteHeader(http.StatusNotFound) },
+			status:   http.StatusNotFound,
+			attempts: 1,
+		},
+		{
+			name:     "gives up after max attempts",
+			failures: 10,
+			fail:     func(w http.ResponseWriter) { w.WriteHeader(http.StatusServiceUnavailable) },
+			status:   http.StatusServiceUnavailable,
+			attempts: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delays := recordSleeps(t)
+			server, count := flakyServer(t, tt.failures, tt.fail)
+
+			policy := testRetryPolicy
+			client := &http.Client{Transport: &RetryTransport{Policy: &policy}}
+			req, err := http.NewRequest(http.MethodPut, server.URL, strings.NewReader("payload"))
+			require.NoError(t, err)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.status, resp.StatusCode)
+			assert.Equal(t, tt.attempts, count.Load())
+			assert.Len(t, *delays, int(tt.attempts)-1)
+			if tt.status == http.StatusOK {
+				body, _ := io.ReadAll(resp.Body)
+				assert.Equal(t, "ok:payload", string(body))
+			}
+			if tt.retryAfter > 0 {
+				assert.Equal(t, []time.Duration{tt.retryAfter}, *delays)
+			}
+		})
+	}
+}
+
+func TestRetryTransport_UnreplayableBody(t *testing.T) {
+	recordSleeps(t)
+	server, count := flakyServer(t, 1, func(w http.ResponseWriter) { w.WriteHeader(http.StatusBadGateway) })
+
+	policy := testRetryPolicy
+	client := &http.Client{Transport: &RetryTransport{Policy: &policy}}
+	req, err := http.NewRequest(http.MethodPut, server.URL, io.MultiReader(strings.NewReader("payload")))
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, int32(1), count.Load())
+}
+
+func TestRetryTransport_Post(t *testing.T) {
+	tests := []struct {
+		name string
+		fail func(w http.ResponseWriter)
+	}{
+		{name: "server error", fail: func(w http.ResponseWriter) { w.WriteHeader(http.StatusBadGateway) }},
+		{name: "connection reset", fail: resetConnection},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delays := recordSleeps(t)
+			server, count := flakyServer(t, 1, tt.fail)
+
+			policy := testRetryPolicy
+			client := &http.Client{Transport: &RetryTransport{Policy: &policy}}
+			resp, err := client.Post(server.URL, "text/plain", strings.NewReader("payload"))
+			if err == nil {
+				resp.Body.Close()
+				assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+			}
+
+			assert.Equal(t, int32(1), count.Load())
+			assert.Empty(t, *delays)
+		})
+	}
+}
+
+func TestRetryTransport_SafePost(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		status  int
+		prepare func(req *http.Request) *http.Request
+	}{
+		{name: "upload-pack", path: "/owner/repo.git/git-upload-pack", status: http.StatusBadGateway},
+		{name: "repeatable", path: "/objects/batch", status: http.StatusServiceUnavailable, prepare: Repeatable},
+		{name: "too many requests", path: "/upload", status: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delays := recordSleeps(t)
+			server, count := flakyServer(t, 1, func(w http.ResponseWriter) { w.WriteHeader(tt.status) })
+
+			policy := testRetryPolicy
+			client := &http.Client{Transport: &RetryTransport{Policy: &policy}}
+			req, err := http.NewRequest(http.MethodPost, server.URL+tt.path, strings.NewReader("payload"))
+			require.NoError(t, err)
+			if tt.prepare != nil {
+				req = tt.prepare(req)
+			}
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, "ok:payload", string(body))
+			assert.Equal(t, int32(2), count.Load())
+			assert.Len(t, *delays, 1)
+		})
+	}
+}
+
+func TestRetryTransport_PostNotSent(t *testing.T) {
+	delays := recordSleeps(t)
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	policy := testRetryPolicy
+	client := &http.Client{Transport: &RetryTransport{Policy: &policy}}
+	_, err := client.Post(server.URL, "text/plain", strings.NewReader("payload"))
+	require.Error(t, err)
+
+	// The connection was refused, so the request can safely be repeated.
+	assert.Len(t, *delays, testRetryPolicy.MaxAttempts-1)
+}
+
+func TestRetry(t *testing.T) {
+	permanent := errors.New("permanent")
+
+	tests := []struct {
+		name     string
+		errs     []error
+		policy   RetryPolicy
+		calls    int
+		expected error
+	}{
+		{
+			name:   "succeeds first time",
+			errs:   []error{nil},
+			policy: testRetryPolicy,
+			calls:  1,
+		},
+		{
+			name:   "retries transient errors",
+			errs:   []error{Transient(errors.New("flaky")), io.ErrUnexpectedEOF, nil},
+			policy: testRetryPolicy,
+			calls:  3,
+		},
+		{
+			name:     "stops on permanent errors",
+			errs:     []error{Transient(errors.New("flaky")), permanent},
+			policy:   testRetryPolicy,
+			calls:    2,
+			expected: permanent,
+		},
+		{
+			name:     "stops on errors marked permanent",
+			errs:     []error{Permanent(io.ErrUnexpectedEOF)},
+			policy:   testRetryPolicy,
+			calls:    1,
+			expected: io.ErrUnexpectedEOF,
+		},
+		{
+			name:     "gives up after max attempts",
+			errs:     []error{Transient(permanent), Transient(permanent), Transient(permanent), Transient(permanent)},
+			policy:   testRetryPolicy,
+			calls:    4,
+			expected: permanent,
+		},
+		{
+			name:     "gives up at deadline",
+			errs:     []error{Transient(permanent), nil},
+			policy:   RetryPolicy{MaxAttempts: 5, InitialDelay: time.Hour, MaxDelay: time.Hour, Deadline: time.Minute},
+			calls:    1,
+			expected: permanent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recordSleeps(t)
+			calls := 0
+			err := Retry(tt.policy, "test", func() error {
+				err := tt.errs[calls]
+				calls++
+				return err
+			})
+
+			assert.Equal(t, tt.calls, calls)
+			if tt.expected == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, expected := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		expected *= time.Millisecond
+		delay, ok := policy.next(attempt+1, time.Now(), 0)
+		assert.True(t, ok)
+		assert.GreaterOrEqual(t, delay, expected/2)
+		assert.LessOrEqual(t, delay, expected)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 5*time.Second, parseRetryAfter("5"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon"))
+
+	future := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	assert.InDelta(t, time.Minute, parseRetryAfter(future), float64(2*time.Second))
+}
+
+func TestIsRetryableMessage(t *testing.T) {
+	assert.True(t, IsRetryableMessage("Error: writing blob: read tcp: connection reset by peer"))
+	assert.True(t, IsRetryableMessage("received unexpected HTTP status: 503 Service Unavailable"))
+	assert.False(t, IsRetryableMessage("Error: unauthorized: authentication required"))
+}
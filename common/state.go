@@ -0,0 +1,50 @@
+package common
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// postSuffix is appended to an action's binary to run it as a post-job hook.
+const postSuffix = "-post"
+
+// IsPost reports whether the action is running as a post-job hook.
+func IsPost() bool {
+	return strings.HasSuffix(filepath.Base(os.Args[0]), postSuffix)
+}
+
+// SaveState records a value that will be available to the post-job hook of
+// the same step via GetState.
+func (c *Context) SaveState(key, value string) error {
+	if !envKeyRe.MatchString(key) {
+		return fmt.Errorf("invalid state name %q", key)
+	}
+
+	var b strings.Builder
+	if err := writeKeyValue(&b, key, value); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+
+	return appendFile(c.StateFile, b.String(), "state")
+}
+
+// GetState returns a value recorded by SaveState in the main run of the step.
+func (c *Context) GetState(key string) string {
+	if c.Forge != ForgeLocal {
+		return os.Getenv("STATE_" + key)
+	}
+
+	content, err := os.ReadFile(c.StateFile)
+	if err != nil {
+		return ""
+	}
+	state, err := readKeyValues(string(content))
+	if err != nil {
+		slog.Warn("Failed to read local state", "path", c.StateFile, "error", err)
+		return ""
+	}
+	return state[key]
+}
@@ -0,0 +1,38 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext_SaveState(t *testing.T) {
+	ctx := &Context{StateFile: filepath.Join(t.TempDir(), "state")}
+	require.NoError(t, ctx.SaveState("authfile", "/tmp/auth.json"))
+	require.NoError(t, ctx.SaveState("notes", "one\ntwo"))
+	assert.EqualError(t, ctx.SaveState("not-valid", "value"), `invalid state name "not-valid"`)
+
+	content, err := os.ReadFile(ctx.StateFile)
+	require.NoError(t, err)
+	assert.Equal(t, "authfile=/tmp/auth.json\nnotes<<DELIM\none\ntwo\nDELIM\n", delimiterRe.ReplaceAllString(string(content), "DELIM"))
+}
+
+func TestContext_GetState(t *testing.T) {
+	t.Setenv("STATE_authfile", "/tmp/auth.json")
+	ctx := &Context{}
+	assert.Equal(t, "/tmp/auth.json", ctx.GetState("authfile"))
+	assert.Equal(t, "", ctx.GetState("missing"))
+}
+
+func TestIsPost(t *testing.T) {
+	original := os.Args
+	t.Cleanup(func() { os.Args = original })
+
+	os.Args = []string{"/action"}
+	assert.False(t, IsPost())
+	os.Args = []string{"/action-post"}
+	assert.True(t, IsPost())
+}
@@ -0,0 +1,154 @@
+package common
+
+import (
+	"fmt"
+	"html"
+	"log/slog"
+	"strings"
+)
+
+// Summary builds a Markdown job summary, published by Write.
+type Summary struct {
+	ctx *Context
+	b   strings.Builder
+}
+
+// NewSummary starts a job summary for the current step.
+func (c *Context) NewSummary() *Summary {
+	return &Summary{ctx: c}
+}
+
+// Heading adds a heading at the given level, from 1 to 6.
+func (s *Summary) Heading(level int, text string) *Summary {
+	level = min(max(level, 1), 6)
+	s.block(strings.Repeat("#", level) + " " + singleLine(text))
+	return s
+}
+
+// Paragraph adds a paragraph of Markdown text.
+func (s *Summary) Paragraph(text string) *Summary {
+	s.block(text)
+	return s
+}
+
+// List adds a bulleted list with one entry per item.
+func (s *Summary) List(items ...string) *Summary {
+	if len(items) == 0 {
+		return s
+	}
+	var b strings.Builder
+	for i, item := range items {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString("- ")
+		b.WriteString(singleLine(item))
+	}
+	s.block(b.String())
+	return s
+}
+
+// Table adds a table with the given header row. Cells may contain inline
+// Markdown; pipes and line breaks are escaped.
+func (s *Summary) Table(headers []string, rows [][]string) *Summary {
+	if len(headers) == 0 {
+		return s
+	}
+	var b strings.Builder
+	writeRow := func(cells []string) {
+		b.WriteByte('|')
+		for i := range headers {
+			var cell string
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			b.WriteByte(' ')
+			b.WriteString(tableCell(cell))
+			b.WriteString(" |")
+		}
+		b.WriteByte('\n')
+	}
+
+	writeRow(headers)
+	b.WriteByte('|')
+	for range headers {
+		b.WriteString(" --- |")
+	}
+	b.WriteByte('\n')
+	for _, row := range rows {
+		writeRow(row)
+	}
+	s.block(strings.TrimSuffix(b.String(), "\n"))
+	return s
+}
+
+// CodeBlock adds a fenced code block, optionally highlighted as lang. The
+// fence is made longer than any run of backticks in the code.
+func (s *Summary) CodeBlock(lang, code string) *Summary {
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	s.block(fence + lang + "\n" + strings.TrimRight(code, "\n") + "\n" + fence)
+	return s
+}
+
+// Details adds a collapsed section with the given title. The body may
+// contain Markdown.
+func (s *Summary) Details(title, body string) *Summary {
+	s.block("<details>\n<summary>" + html.EscapeString(singleLine(title)) + "</summary>\n\n" + strings.TrimRight(body, "\n") + "\n\n</details>")
+	return s
+}
+
+// String returns the Markdown built so far.
+func (s *Summary) String() string {
+	return s.b.String()
+}
+
+// Write appends the summary to the step summary file. It does nothing if the
+// summary is empty or the forge does not support summaries.
+func (s *Summary) Write() error {
+	if s.b.Len() == 0 {
+		return nil
+	}
+	if s.ctx.SummaryFile == "" {
+		slog.Debug("No step summary file available, skipping summary")
+		return nil
+	}
+	return appendFile(s.ctx.SummaryFile, s.b.String(), "summary")
+}
+
+func (s *Summary) block(text string) {
+	s.b.WriteString(text)
+	s.b.WriteString("\n\n")
+}
+
+// Link formats an inline Markdown link.
+func Link(text, url string) string {
+	text = strings.NewReplacer("[", `\[`, "]", `\]`).Replace(singleLine(text))
+	url = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29").Replace(url)
+	return fmt.Sprintf("[%s](%s)", text, url)
+}
+
+// Code formats text as inline code.
+func Code(text string) string {
+	text = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(text)
+	fence := "`"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+		text = " " + text + " "
+	}
+	return fence + text + fence
+}
+
+func singleLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func tableCell(text string) string {
+	text = strings.ReplaceAll(strings.TrimSpace(text), "|", `\|`)
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.ReplaceAll(text, "\n", "<br>")
+}
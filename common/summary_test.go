@@ -0,0 +1,98 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummary(t *testing.T) {
+	tests := []struct {
+		name     string
+		build    func(s *Summary)
+		expected string
+	}{
+		{
+			name:     "heading",
+			build:    func(s *Summary) { s.Heading(2, "Pushed\nimage") },
+			expected: "## Pushed image\n\n",
+		},
+		{
+			name:     "heading level is clamped",
+			build:    func(s *Summary) { s.Heading(9, "Deep").Heading(0, "Shallow") },
+			expected: "###### Deep\n\n# Shallow\n\n",
+		},
+		{
+			name:     "list",
+			build:    func(s *Summary) { s.List("one", "two") },
+			expected: "- one\n- two\n\n",
+		},
+		{
+			name:     "empty list",
+			build:    func(s *Summary) { s.List() },
+			expected: "",
+		},
+		{
+			name: "table",
+			build: func(s *Summary) {
+				s.Table([]string{"Tag", "Digest"}, [][]string{{"latest", "sha256:abc"}, {"a|b", "x\ny"}, {"short"}})
+			},
+			expected: "| Tag | Digest |\n| --- | --- |\n| latest | sha256:abc |\n| a\\|b | x<br>y |\n| short |  |\n\n",
+		},
+		{
+			name:     "code block",
+			build:    func(s *Summary) { s.CodeBlock("go", "package main\n") },
+			expected: "```go\npackage main\n```\n\n",
+		},
+		{
+			name:     "code block containing a fence",
+			build:    func(s *Summary) { s.CodeBlock("", "```\nnested\n```") },
+			expected: "````\n```\nnested\n```\n````\n\n",
+		},
+		{
+			name:     "details",
+			build:    func(s *Summary) { s.Details("Changes <v1>", "- Fixed\n") },
+			expected: "<details>\n<summary>Changes &lt;v1&gt;</summary>\n\n- Fixed\n\n</details>\n\n",
+		},
+		{
+			name: "paragraph with link and code",
+			build: func(s *Summary) {
+				s.Paragraph("Released " + Link("v1 [beta]", "https://example.com/a b") + " from " + Code("main"))
+			},
+			expected: "Released [v1 \\[beta\\]](https://example.com/a%20b) from `main`\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := (&Context{}).NewSummary()
+			tt.build(s)
+			assert.Equal(t, tt.expected, s.String())
+		})
+	}
+}
+
+func TestCode(t *testing.T) {
+	assert.Equal(t, "`plain`", Code("plain"))
+	assert.Equal(t, "``a`b``", Code("a`b"))
+	assert.Equal(t, "`` `tick ``", Code("`tick"))
+	assert.Equal(t, "`two lines`", Code("two\nlines"))
+}
+
+func TestSummary_Write(t *testing.T) {
+	ctx := &Context{SummaryFile: filepath.Join(t.TempDir(), "summary")}
+	require.NoError(t, ctx.NewSummary().Write())
+	assert.NoFileExists(t, ctx.SummaryFile)
+
+	require.NoError(t, ctx.NewSummary().Heading(1, "First").Write())
+	require.NoError(t, ctx.NewSummary().Paragraph("Second").Write())
+
+	content, err := os.ReadFile(ctx.SummaryFile)
+	require.NoError(t, err)
+	assert.Equal(t, "# First\n\nSecond\n\n", string(content))
+
+	assert.NoError(t, (&Context{}).NewSummary().Heading(1, "Nowhere").Write())
+}
@@ -0,0 +1,18 @@
+package curseforge
+
+import "chameth.com/actions/common"
+
+func Command() *common.Command {
+	c := common.NewCommand("curseforge", "Upload an addon zip file to CurseForge")
+	apiToken := c.Secret("api-token", "API_TOKEN", "CurseForge API token").Required()
+	projectID := c.String("project-id", "", "CurseForge project ID").Required()
+	path := c.String("path", "", "Path to the zip file to upload (supports glob patterns)").Required()
+	changelog := c.Path("changelog", "src/CHANGELOG.md", "Path to a changelog file to include with the upload (generated from Conventional Commits if it has no entry for the version)")
+	heading := c.HeadingPattern("changelog-heading", "keepachangelog", "Format of the changelog's version headings: keepachangelog, plain, version, or a regular expression capturing the version")
+	changelogFormat := c.String("changelog-format", "markdown", "Format to send the changelog to CurseForge in: markdown, html or text")
+
+	c.Run = func(ctx *common.Context) error {
+		return Run(ctx, apiToken.Value(), projectID.Value(), path.Value(), changelog.Value(), heading.Value(), changelogFormat.Value())
+	}
+	return c
+}
@@ -5,13 +5,17 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"chameth.com/actions/common"
@@ -35,7 +39,14 @@ type metadata struct {
 	IsMarkedForManualRelease bool     `json:"isMarkedForManualRelease"`
 }
 
-func Run(ctx *common.Context, apiToken, projectID, path, changelogFile string) error {
+func Run(ctx *common.Context, apiToken, projectID, path, changelogFile string, heading *regexp.Regexp, changelogFormat string) error {
+	ctx.AddMask(apiToken)
+
+	format := common.MarkupFormat(changelogFormat)
+	if format != common.FormatMarkdown && format != common.FormatHTML && format != common.FormatText {
+		return fmt.Errorf("invalid changelog format %q: must be markdown, html or text", changelogFormat)
+	}
+
 	resolved := ctx.ResolvePath(path)
 	matches, err := filepath.Glob(resolved)
 	if err != nil {
@@ -56,15 +67,17 @@ func Run(ctx *common.Context, apiToken, projectID, path, changelogFile string) e
 
 	interfaceVersions, err := extractInterfaceFromZip(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to read interface version from zip: %w", err)
+		return fmt.Errorf("failed to read interface version from zip: %w", sourceError(ctx, err))
 	}
 
 	slog.Info("Found interface versions in TOC", "interface", interfaceVersions)
 
 	var changelogStr string
-	changelogSection, err := ctx.Changelog(changelogFile, version, ctx.Tag())
+	changelogSection, err := ctx.ReleaseNotes(changelogFile, heading, version, ctx.Tag())
 	if err == nil {
 		changelogStr = changelogSection
+	} else {
+		slog.Warn("Uploading without a changelog", "error", err)
 	}
 
 	slog.Info("Uploading to CurseForge", "file", filePath, "project", projectID, "version", version)
@@ -89,12 +102,30 @@ func Run(ctx *common.Context, apiToken, projectID, path, changelogFile string) e
 
 	displayName := filepath.Base(filePath)
 
-	if err := upload(apiToken, projectID, displayName, changelogStr, versionIDs, versionNames, filePath); err != nil {
+	rendered, err := common.RenderMarkdown(changelogStr, format)
+	if err != nil {
+		return err
+	}
+
+	if err := upload(apiToken, projectID, displayName, rendered, format, versionIDs, versionNames, filePath); err != nil {
 		return fmt.Errorf("failed to upload: %w", err)
 	}
 
 	slog.Info("Upload complete")
-	return nil
+
+	rows := make([][]string, len(matchedVersions))
+	for i, v := range matchedVersions {
+		rows[i] = []string{v.Name, common.Code(v.APIVersion), fmt.Sprint(v.ID)}
+	}
+	s := ctx.NewSummary().
+		Heading(2, "Uploaded "+displayName+" to CurseForge").
+		Paragraph(fmt.Sprintf("Project %s, version %s.", common.Code(projectID), common.Code(version))).
+		Heading(3, "Game versions").
+		Table([]string{"Name", "Interface", "ID"}, rows)
+	if changelogStr != "" {
+		s.Details("Changelog", changelogStr)
+	}
+	return s.Write()
 }
 
 func extractVersion(path string) (string, error) {
@@ -147,7 +178,9 @@ func extractInterfaceFromZip(zipPath string) ([]string, error) {
 		defer rc.Close()
 
 		scanner := bufio.NewScanner(rc)
+		lineNumber := 0
 		for scanner.Scan() {
+			lineNumber++
 			line := strings.TrimSpace(scanner.Text())
 			if after, ok := strings.CutPrefix(line, "## Interface:"); ok {
 				raw := strings.TrimSpace(after)
@@ -159,21 +192,49 @@ func extractInterfaceFromZip(zipPath string) ([]string, error) {
 					}
 				}
 				if len(versions) == 0 {
-					return nil, fmt.Errorf("## Interface: found in %s but no valid versions", f.Name)
+					return nil, common.FileError(fmt.Errorf("## Interface: found in %s but no valid versions", f.Name), f.Name, lineNumber)
 				}
 				return versions, nil
 			}
 		}
 		if err := scanner.Err(); err != nil {
-			return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+			return nil, common.FileError(fmt.Errorf("failed to read %s: %w", f.Name, err), f.Name, 0)
 		}
 
-		return nil, fmt.Errorf("## Interface: not found in %s", f.Name)
+		return nil, common.FileError(fmt.Errorf("## Interface: not found in %s", f.Name), f.Name, 0)
 	}
 
 	return nil, fmt.Errorf("expected toc file %s not found in zip", tocName)
 }
 
+// sourceError anchors an error about a file in the zip to the file in the
+// workspace it was packaged from, as the path inside the zip means nothing
+// to annotations. If there isn't exactly one such file, the error isn't
+// anchored at all.
+func sourceError(ctx *common.Context, err error) error {
+	var annotated *common.AnnotatedError
+	if !errors.As(err, &annotated) {
+		return err
+	}
+
+	var sources []string
+	_ = filepath.WalkDir(ctx.Workspace, func(p string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return nil
+		case d.IsDir() && d.Name() == ".git":
+			return filepath.SkipDir
+		case !d.IsDir() && d.Name() == path.Base(annotated.Annotation.File):
+			sources = append(sources, p)
+		}
+		return nil
+	})
+	if len(sources) != 1 {
+		return annotated.Err
+	}
+	return common.FileError(annotated.Err, ctx.WorkspacePath(sources[0]), annotated.Annotation.Line)
+}
+
 func fetchGameVersions(apiToken string) ([]gameVersion, error) {
 	req, err := http.NewRequest("GET", "https://wow.curseforge.com/api/game/versions", nil)
 	if err != nil {
@@ -181,7 +242,7 @@ func fetchGameVersions(apiToken string) ([]gameVersion, error) {
 	}
 	req.Header.Set("X-Api-Token", apiToken)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := common.HTTPClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
@@ -218,10 +279,10 @@ func matchVersions(versions []gameVersion, interfaceVersions []string) []gameVer
 	return matched
 }
 
-func upload(apiToken, projectID, displayName, changelog string, gameVersionIDs []int, gameVersionNames []string, filePath string) error {
+func upload(apiToken, projectID, displayName, changelog string, changelogFormat common.MarkupFormat, gameVersionIDs []int, gameVersionNames []string, filePath string) error {
 	meta := metadata{
 		Changelog:                changelog,
-		ChangelogType:            "markdown",
+		ChangelogType:            string(changelogFormat),
 		DisplayName:              displayName,
 		GameVersions:             gameVersionIDs,
 		GameVersionNames:         gameVersionNames,
@@ -269,7 +330,8 @@ func upload(apiToken, projectID, displayName, changelog string, gameVersionIDs [
 	req.Header.Set("Content-Type", w.FormDataContentType())
 	req.Header.Set("X-Api-Token", apiToken)
 
-	resp, err := http.DefaultClient.Do(req)
+	// Like every upload, this is only retried if it can't have taken effect.
+	resp, err := common.HTTPClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
 	}
@@ -0,0 +1,18 @@
+package dockerbuild
+
+import "chameth.com/actions/common"
+
+func Command() *common.Command {
+	c := common.NewCommand("dockerbuild", "Build Docker images using buildah")
+	dockerfile := c.String("dockerfile", "", "Path to Dockerfile (relative to the build context)")
+	context := c.Path("context", "src", "Build context path")
+	target := c.String("target", "image.tar", "Output tar file for the image")
+	authfile := c.Path("authfile", ".registry-auth.json", "Path to authentication file")
+
+	c.Output("image", "Path to the exported image tar file")
+
+	c.Run = func(ctx *common.Context) error {
+		return Run(ctx, dockerfile.Value(), context.Value(), target.Value(), authfile.Value())
+	}
+	return c
+}
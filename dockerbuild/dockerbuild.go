@@ -1,6 +1,7 @@
 package dockerbuild
 
 import (
+	"cmp"
 	"fmt"
 	"log/slog"
 	"os"
@@ -21,10 +22,6 @@ func Run(ctx *common.Context, dockerfile, context, target, authfile string) erro
 		"source_label", sourceLabel,
 		"authfile", authfile != "")
 
-	if err := os.Chdir(contextPath); err != nil {
-		return fmt.Errorf("failed to change to context directory %s: %w", contextPath, err)
-	}
-
 	args := []string{
 		"bud",
 		"--timestamp=0",
@@ -37,11 +34,13 @@ func Run(ctx *common.Context, dockerfile, context, target, authfile string) erro
 		args = append(args, "-f", dockerfile)
 	}
 
-	// Use "." as the build context since we're in the context directory
+	// Build from the context directory, so the Dockerfile resolves against it
+	// without changing the working directory of the whole process.
 	args = append(args, ".")
 
 	slog.Debug("Executing buildah build", "args", args, "cwd", contextPath)
 	cmd := exec.Command("buildah", args...)
+	cmd.Dir = contextPath
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
@@ -50,5 +49,17 @@ func Run(ctx *common.Context, dockerfile, context, target, authfile string) erro
 	}
 
 	slog.Info("Docker image built", "image", target)
-	return ctx.WriteOutput(map[string]string{"image": target})
+	if err := ctx.WriteOutput(map[string]string{"image": target}); err != nil {
+		return err
+	}
+
+	return ctx.NewSummary().
+		Heading(3, "Built image").
+		Table([]string{"Property", "Value"}, [][]string{
+			{"Archive", common.Code(target)},
+			{"Dockerfile", common.Code(cmp.Or(dockerfile, "Dockerfile"))},
+			{"Context", common.Code(context)},
+			{"Source", sourceLabel},
+		}).
+		Write()
 }
@@ -0,0 +1,19 @@
+package dockerlogin
+
+import "chameth.com/actions/common"
+
+func Command() *common.Command {
+	c := common.NewCommand("dockerlogin", "Login to a container registry using buildah")
+	registry := c.String("registry", "", "Registry URL").Required()
+	username := c.String("username", "", "Username for authentication").Required()
+	password := c.Secret("password", "PASSWORD", "Password for authentication").Required()
+	authfile := c.Path("authfile", ".registry-auth.json", "Path to authentication file")
+
+	c.Output("authfile", "Absolute path to the authentication file")
+
+	c.Run = func(ctx *common.Context) error {
+		return Run(ctx, registry.Value(), username.Value(), password.Value(), authfile.Value())
+	}
+	c.Post = Post
+	return c
+}
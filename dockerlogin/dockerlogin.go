@@ -1,7 +1,9 @@
 package dockerlogin
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"os"
 	"os/exec"
@@ -10,6 +12,8 @@ import (
 )
 
 func Run(ctx *common.Context, registry, username, password, authfile string) error {
+	ctx.AddMask(password)
+
 	slog.Info("Logging into container registry",
 		"registry", registry,
 		"username", username,
@@ -48,5 +52,52 @@ func Run(ctx *common.Context, registry, username, password, authfile string) err
 	}
 
 	slog.Info("Registry login successful", "registry", registry, "authfile", ctx.ResolvePath(authfile))
-	return ctx.WriteOutput(map[string]string{"authfile": ctx.ResolvePath(authfile)})
+	if err := ctx.WriteOutput(map[string]string{"authfile": ctx.ResolvePath(authfile)}); err != nil {
+		return err
+	}
+
+	if err := ctx.SaveState("registry", registry); err != nil {
+		return err
+	}
+	if err := ctx.SaveState("authfile", ctx.ResolvePath(authfile)); err != nil {
+		return err
+	}
+
+	return ctx.NewSummary().
+		Paragraph(fmt.Sprintf("Logged in to %s as %s.", common.Code(registry), common.Code(username))).
+		Write()
+}
+
+// Post logs out of the registry and deletes the authfile written by Run in
+// the main step. It runs as a post-job hook, so that credentials do not
+// outlive the job.
+func Post(ctx *common.Context) error {
+	registry := ctx.GetState("registry")
+	authfile := ctx.GetState("authfile")
+	if registry == "" || authfile == "" {
+		slog.Debug("No registry login to clean up")
+		return nil
+	}
+
+	if _, err := os.Stat(authfile); errors.Is(err, fs.ErrNotExist) {
+		slog.Info("Authfile already removed", "authfile", authfile)
+		return nil
+	}
+
+	slog.Info("Logging out of container registry", "registry", registry, "authfile", authfile)
+
+	var logoutErr error
+	cmd := exec.Command("buildah", "logout", "--authfile", authfile, registry)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		logoutErr = fmt.Errorf("buildah logout failed: %w", err)
+	}
+
+	if err := os.Remove(authfile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return errors.Join(logoutErr, fmt.Errorf("failed to remove authfile: %w", err))
+	}
+
+	slog.Info("Removed registry credentials", "authfile", authfile)
+	return logoutErr
 }
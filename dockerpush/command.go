@@ -0,0 +1,16 @@
+package dockerpush
+
+import "chameth.com/actions/common"
+
+func Command() *common.Command {
+	c := common.NewCommand("dockerpush", "Push Docker images from a tar file to a container registry")
+	archive := c.Path("archive", "image.tar", "Path to the image tar file to push")
+	name := c.String("name", "", "Base image name").Required()
+	tags := c.List("tags", "", "Comma-separated list of tags to push").Required()
+	authfile := c.Path("authfile", ".registry-auth.json", "Path to authentication file")
+
+	c.Run = func(ctx *common.Context) error {
+		return Run(ctx, archive.Value(), name.Value(), tags.Value(), authfile.Value())
+	}
+	return c
+}
@@ -1,7 +1,9 @@
 package dockerpush
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/exec"
@@ -10,16 +12,11 @@ import (
 	"chameth.com/actions/common"
 )
 
-func Run(ctx *common.Context, archive, name, tags, authfile string) error {
-	if tags == "" {
+func Run(ctx *common.Context, archive, name string, tagList []string, authfile string) error {
+	if len(tagList) == 0 {
 		return fmt.Errorf("tags cannot be empty")
 	}
 
-	tagList := strings.Split(tags, ",")
-	for i, tag := range tagList {
-		tagList[i] = strings.TrimSpace(tag)
-	}
-
 	slog.Info("Pushing image",
 		"archive", archive,
 		"image_name", name,
@@ -29,12 +26,21 @@ func Run(ctx *common.Context, archive, name, tags, authfile string) error {
 
 	resolvedArchive := ctx.ResolvePath(archive)
 
+	digestFile, err := os.CreateTemp("", "digest")
+	if err != nil {
+		return fmt.Errorf("failed to create digest file: %w", err)
+	}
+	digestFile.Close()
+	defer os.Remove(digestFile.Name())
+
+	var pushed [][]string
 	for _, tag := range tagList {
 		target := fmt.Sprintf("%s:%s", name, tag)
 		slog.Debug("Pushing tag", "target", target)
 
 		args := []string{
 			"copy",
+			"--digestfile", digestFile.Name(),
 		}
 
 		if authfile != "" {
@@ -43,17 +49,36 @@ func Run(ctx *common.Context, archive, name, tags, authfile string) error {
 
 		args = append(args, fmt.Sprintf("oci-archive:%s", resolvedArchive), fmt.Sprintf("docker://%s", target))
 
-		cmd := exec.Command("skopeo", args...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		err := common.Retry(common.DefaultRetryPolicy, "skopeo copy", func() error {
+			var stderr bytes.Buffer
+			cmd := exec.Command("skopeo", args...)
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
 
-		if err := cmd.Run(); err != nil {
+			if err := cmd.Run(); err != nil {
+				if common.IsRetryableMessage(stderr.String()) {
+					return common.Transient(err)
+				}
+				return err
+			}
+			return nil
+		})
+		if err != nil {
 			return fmt.Errorf("skopeo copy failed for tag %s: %w", tag, err)
 		}
 
-		slog.Info("Tag pushed successfully", "target", target)
+		digest, err := os.ReadFile(digestFile.Name())
+		if err != nil {
+			return fmt.Errorf("failed to read digest for tag %s: %w", tag, err)
+		}
+
+		slog.Info("Tag pushed successfully", "target", target, "digest", strings.TrimSpace(string(digest)))
+		pushed = append(pushed, []string{common.Code(target), common.Code(strings.TrimSpace(string(digest)))})
 	}
 
 	slog.Info("All tags pushed successfully")
-	return nil
+	return ctx.NewSummary().
+		Heading(2, "Pushed "+name).
+		Table([]string{"Image", "Digest"}, pushed).
+		Write()
 }
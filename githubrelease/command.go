@@ -0,0 +1,18 @@
+package githubrelease
+
+import "chameth.com/actions/common"
+
+func Command() *common.Command {
+	c := common.NewCommand("githubrelease", "Create a new release on GitHub for the current ref")
+	repo := c.String("repo", "", "Repository to create release in").Required()
+	token := c.Secret("token", "TOKEN", "Token to use to authenticate to GitHub").Required()
+	changelog := c.Path("changelog", "src/CHANGELOG.md", "Path to the CHANGELOG to use for release notes (generated from Conventional Commits if it has no entry for the version)")
+	heading := c.HeadingPattern("changelog-heading", "keepachangelog", "Format of the changelog's version headings: keepachangelog, plain, version, or a regular expression capturing the version")
+	strict := c.Bool("strict-changelog", false, "Fail the release if its notes can't be read from the changelog, instead of releasing without them")
+	assets := c.List("assets", "", "Comma-separated list of file paths or glob patterns to attach to the release")
+
+	c.Run = func(ctx *common.Context) error {
+		return Run(ctx, repo.Value(), changelog.Value(), heading.Value(), strict.Value(), token.Value(), assets.Value())
+	}
+	return c
+}
@@ -7,29 +7,34 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"chameth.com/actions/common"
 	"github.com/google/go-github/v89/github"
 )
 
-func Run(ctx *common.Context, repo, filename, token, assets string) error {
+func Run(ctx *common.Context, repo, filename string, heading *regexp.Regexp, strict bool, token string, assets []string) error {
+	ctx.AddMask(token)
+
 	tag := ctx.Tag()
 	if tag == "" {
 		return fmt.Errorf("unable to determine tag for ref %s", ctx.Ref)
 	}
 
-	body, err := ctx.Changelog(filename, tag)
+	body, err := ctx.ReleaseNotes(filename, heading, tag)
 	if err != nil {
-		return err
-	}
-	if body == "" {
+		if strict {
+			return err
+		}
+		slog.Warn("Releasing without release notes", "error", err)
+	} else if body == "" {
 		slog.Warn("No changelog entry found for version", "tag", tag)
 	}
 
 	owner, name, _ := strings.Cut(repo, "/")
 
-	client, err := github.NewClient(github.WithHTTPClient(http.DefaultClient), github.WithAuthToken(token))
+	client, err := github.NewClient(github.WithHTTPClient(common.HTTPClient), github.WithAuthToken(token))
 	if err != nil {
 		return fmt.Errorf("failed to create GitHub client: %w", err)
 	}
@@ -46,27 +51,60 @@ func Run(ctx *common.Context, repo, filename, token, assets string) error {
 
 	slog.Info("Created GitHub release", "url", rel.HTMLURL, "version", tag)
 
-	if assets != "" {
-		if err := uploadAssets(ctx, client, owner, name, rel.GetID(), assets); err != nil {
+	var uploaded []*github.ReleaseAsset
+	if len(assets) > 0 {
+		uploaded, err = uploadAssets(ctx, client, owner, name, rel.GetID(), assets)
+		if err != nil {
 			return fmt.Errorf("failed to upload assets: %w", err)
 		}
 	}
 
-	return nil
+	return summarise(ctx, rel, uploaded, body)
 }
 
-func uploadAssets(ctx *common.Context, client *github.Client, owner, repo string, releaseID int64, assets string) error {
-	patterns := strings.SplitSeq(assets, ",")
-	for pattern := range patterns {
-		pattern = strings.TrimSpace(pattern)
-		if pattern == "" {
-			continue
+func summarise(ctx *common.Context, rel *github.RepositoryRelease, assets []*github.ReleaseAsset, changelog string) error {
+	s := ctx.NewSummary().
+		Heading(2, "Released "+rel.GetName()).
+		Paragraph(common.Link(rel.GetHTMLURL(), rel.GetHTMLURL()))
+
+	if len(assets) > 0 {
+		var rows [][]string
+		for _, asset := range assets {
+			rows = append(rows, []string{
+				common.Link(asset.GetName(), asset.GetBrowserDownloadURL()),
+				humanSize(asset.GetSize()),
+			})
 		}
+		s.Heading(3, "Assets").Table([]string{"Name", "Size"}, rows)
+	}
+
+	if changelog != "" {
+		s.Details("Release notes", changelog)
+	}
+
+	return s.Write()
+}
+
+func humanSize(bytes int) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := unit, 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
 
+func uploadAssets(ctx *common.Context, client *github.Client, owner, repo string, releaseID int64, patterns []string) ([]*github.ReleaseAsset, error) {
+	var uploaded []*github.ReleaseAsset
+	for _, pattern := range patterns {
 		resolved := ctx.ResolvePath(pattern)
 		matches, err := filepath.Glob(resolved)
 		if err != nil {
-			return fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+			return nil, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
 		}
 		if len(matches) == 0 {
 			slog.Warn("No files matched glob pattern", "pattern", pattern)
@@ -74,36 +112,64 @@ func uploadAssets(ctx *common.Context, client *github.Client, owner, repo string
 		}
 
 		for _, match := range matches {
-			if err := uploadAsset(client, owner, repo, releaseID, match); err != nil {
-				return err
+			asset, err := uploadAsset(client, owner, repo, releaseID, match)
+			if err != nil {
+				return nil, err
 			}
+			uploaded = append(uploaded, asset)
 		}
 	}
-	return nil
+	return uploaded, nil
 }
 
-func uploadAsset(client *github.Client, owner, repo string, releaseID int64, path string) error {
-	f, err := os.Open(path)
-	if err != nil {
-		return fmt.Errorf("failed to open asset %q: %w", path, err)
-	}
-	defer f.Close()
-
+func uploadAsset(client *github.Client, owner, repo string, releaseID int64, path string) (*github.ReleaseAsset, error) {
 	name := filepath.Base(path)
 	slog.Info("Uploading release asset", "name", name, "path", path)
 
-	_, _, err = client.Repositories.UploadReleaseAsset(
-		context.Background(),
-		owner,
-		repo,
-		releaseID,
-		&github.UploadOptions{Name: name},
-		f,
-	)
+	var asset *github.ReleaseAsset
+	err := common.Retry(common.DefaultRetryPolicy, "upload asset", func() error {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open asset %q: %w", path, err)
+		}
+		defer f.Close()
+
+		var resp *github.Response
+		asset, resp, err = client.Repositories.UploadReleaseAsset(
+			context.Background(),
+			owner,
+			repo,
+			releaseID,
+			&github.UploadOptions{Name: name},
+			f,
+		)
+		return retryable(resp, err)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to upload asset %q: %w", name, err)
+		return nil, fmt.Errorf("failed to upload asset %q: %w", name, err)
 	}
 
 	slog.Info("Uploaded release asset", "name", name)
-	return nil
+	return asset, nil
+}
+
+// retryable applies common.RetryTransport's rule for uploads, which it can't
+// apply itself as asset bodies can't be replayed: an upload is only retried
+// if it can't have taken effect.
+func retryable(resp *github.Response, err error) error {
+	if err == nil {
+		return nil
+	}
+	var httpResp *http.Response
+	if resp != nil {
+		httpResp = resp.Response
+	}
+	if !common.Unprocessed(httpResp, err) {
+		return common.Permanent(err)
+	}
+	if httpResp != nil {
+		_, after := common.IsRetryableResponse(httpResp)
+		return &common.TransientError{Err: err, RetryAfter: after}
+	}
+	return common.Transient(err)
 }
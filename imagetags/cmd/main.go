@@ -1,30 +1,7 @@
 package main
 
-import (
-	"flag"
-	"fmt"
-	"os"
-
-	"chameth.com/actions/common"
-	"chameth.com/actions/imagetags"
-)
-
-var (
-	debug = flag.Bool("debug", false, "Enable debug logging")
-)
+import "chameth.com/actions/imagetags"
 
 func main() {
-	ctx, err := common.ContextFromEnv()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
-	}
-
-	flag.Parse()
-	common.ConfigureLogging(*debug)
-
-	if err := imagetags.Run(ctx); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
-	}
+	imagetags.Command().Main()
 }
@@ -0,0 +1,10 @@
+package imagetags
+
+import "chameth.com/actions/common"
+
+func Command() *common.Command {
+	c := common.NewCommand("imagetags", "Generate docker image tags based on git ref")
+	c.Output("tags", "Comma-separated list of docker image tags")
+	c.Run = Run
+	return c
+}
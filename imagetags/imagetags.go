@@ -25,7 +25,18 @@ func Run(ctx *common.Context) error {
 	}
 
 	slog.Info("Generated tags", "tags", strings.Join(tags, ","))
-	return ctx.WriteOutput(map[string]string{"tags": strings.Join(tags, ",")})
+	if err := ctx.WriteOutput(map[string]string{"tags": strings.Join(tags, ",")}); err != nil {
+		return err
+	}
+
+	items := make([]string, len(tags))
+	for i, tag := range tags {
+		items[i] = common.Code(tag)
+	}
+	return ctx.NewSummary().
+		Heading(3, "Image tags").
+		List(items...).
+		Write()
 }
 
 func tags(ctx *common.Context) ([]string, error) {
@@ -39,7 +50,7 @@ func tags(ctx *common.Context) ([]string, error) {
 		slog.Debug("Processing version tag", "tag", tag)
 		targetVersion, err := version.NewVersion(tag)
 
-		tags, err := gitrefs.Fetch(ctx.RepoUrl(), gitrefs.WithAuth("x-access-token", ctx.Token), gitrefs.TagsOnly())
+		tags, err := gitrefs.Fetch(ctx.RepoUrl(), gitrefs.HttpClient(common.HTTPClient), gitrefs.WithAuth("x-access-token", ctx.Token), gitrefs.TagsOnly())
 		if err != nil {
 			return nil, fmt.Errorf("couldn't find tags for repository: %w", err)
 		}
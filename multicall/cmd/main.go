@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"chameth.com/actions/multicall"
+)
+
+func main() {
+	os.Exit(multicall.Run(os.Args, os.Stdout))
+}
@@ -0,0 +1,201 @@
+// Package multicall bundles every action into a single binary, which picks
+// the action to run from its first argument or the name it was invoked as.
+package multicall
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"chameth.com/actions/changeloglint"
+	"chameth.com/actions/changelogpromote"
+	"chameth.com/actions/checkout"
+	"chameth.com/actions/common"
+	"chameth.com/actions/curseforge"
+	"chameth.com/actions/dockerbuild"
+	"chameth.com/actions/dockerlogin"
+	"chameth.com/actions/dockerpush"
+	"chameth.com/actions/githubrelease"
+	"chameth.com/actions/imagetags"
+	"chameth.com/actions/pipeline"
+	"chameth.com/actions/setupgo"
+	"chameth.com/actions/wowaddon"
+	"chameth.com/actions/wowinterface"
+)
+
+// postSuffix marks a post-job hook, whether on the binary's name or on the
+// name of the action passed as an argument.
+const postSuffix = "-post"
+
+// Commands creates the command for every action, sorted by name.
+func Commands() []*common.Command {
+	commands := []*common.Command{
+		changeloglint.Command(),
+		changelogpromote.Command(),
+		checkout.Command(),
+		curseforge.Command(),
+		dockerbuild.Command(),
+		dockerlogin.Command(),
+		dockerpush.Command(),
+		githubrelease.Command(),
+		imagetags.Command(),
+		setupgo.Command(),
+		wowaddon.Command(),
+		wowinterface.Command(),
+	}
+	slices.SortFunc(commands, func(a, b *common.Command) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return commands
+}
+
+// Find returns the command for the named action, or nil if there isn't one.
+func Find(name string) *common.Command {
+	for _, c := range Commands() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// Run dispatches to an action based on args, which includes the program name
+// as its first element, and returns the exit code. If the binary is named
+// after an action (for example via a symlink) that action is run directly;
+// otherwise the first argument names the action, or is one of "list",
+// "help" or "run" (which runs a pipeline of actions). A "-post" suffix on
+// either name runs the action's post-job hook. Listings and help are
+// written to w.
+func Run(args []string, w io.Writer) int {
+	if len(args) > 0 {
+		if c, post := lookup(filepath.Base(args[0])); c != nil {
+			return execute(c, post, args[1:])
+		}
+	}
+
+	if len(args) < 2 {
+		usage(w, programName(args))
+		return 2
+	}
+
+	switch name := args[1]; name {
+	case "list":
+		list(w)
+		return 0
+	case "run":
+		return pipeline.Command(Find).Execute(args[2:])
+	case "help", "-h", "-help", "--help":
+		if len(args) < 3 {
+			usage(w, programName(args))
+			return 0
+		}
+		var c *common.Command
+		if args[2] == "run" {
+			c = pipeline.Command(Find)
+		} else {
+			c, _ = lookup(args[2])
+		}
+		if c == nil {
+			fmt.Fprintf(w, "Unknown action %q\n\n", args[2])
+			list(w)
+			return 2
+		}
+		describe(w, programName(args), c)
+		return 0
+	default:
+		c, post := lookup(name)
+		if c == nil {
+			fmt.Fprintf(w, "Unknown action %q\n\n", name)
+			usage(w, programName(args))
+			return 2
+		}
+		return execute(c, post, args[2:])
+	}
+}
+
+// lookup finds the command for name, which may have the post-job suffix.
+func lookup(name string) (*common.Command, bool) {
+	if c := Find(name); c != nil {
+		return c, false
+	}
+	if base, ok := strings.CutSuffix(name, postSuffix); ok {
+		return Find(base), true
+	}
+	return nil, false
+}
+
+func execute(c *common.Command, post bool, args []string) int {
+	if post {
+		return c.ExecutePost(args)
+	}
+	return c.Execute(args)
+}
+
+func programName(args []string) string {
+	if len(args) == 0 {
+		return "actions"
+	}
+	return filepath.Base(args[0])
+}
+
+func usage(w io.Writer, program string) {
+	fmt.Fprintf(w, "Usage: %s <action>[%s] [flags]\n", program, postSuffix)
+	fmt.Fprintf(w, "       %s run [-file pipeline.yml] [flags]\n", program)
+	fmt.Fprintf(w, "       %s list\n", program)
+	fmt.Fprintf(w, "       %s help <action>\n\n", program)
+	list(w)
+}
+
+func list(w io.Writer) {
+	fmt.Fprintln(w, "Actions:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range Commands() {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.Name, c.Description)
+	}
+	_ = tw.Flush()
+}
+
+func describe(w io.Writer, program string, c *common.Command) {
+	fmt.Fprintf(w, "%s: %s\n\n", c.Name, c.Description)
+	fmt.Fprintf(w, "Usage: %s %s [flags]\n", program, c.Name)
+	if c.Post != nil {
+		fmt.Fprintf(w, "       %s %s%s [flags]\n", program, c.Name, postSuffix)
+	}
+
+	fmt.Fprintln(w, "\nInputs:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, in := range c.Inputs() {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", in.Name, in.Kind, inputDetails(in))
+	}
+	_ = tw.Flush()
+
+	if outputs := c.Outputs(); len(outputs) > 0 {
+		fmt.Fprintln(w, "\nOutputs:")
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, out := range outputs {
+			fmt.Fprintf(tw, "  %s\t%s\n", out.Name, out.Description)
+		}
+		_ = tw.Flush()
+	}
+}
+
+func inputDetails(in common.InputSpec) string {
+	var notes []string
+	if in.Required {
+		notes = append(notes, "required")
+	}
+	if in.Env != "" {
+		notes = append(notes, "from $"+in.Env)
+	}
+	if in.Default != "" {
+		notes = append(notes, fmt.Sprintf("default %q", in.Default))
+	}
+	if len(notes) == 0 {
+		return in.Description
+	}
+	return fmt.Sprintf("%s (%s)", in.Description, strings.Join(notes, ", "))
+}
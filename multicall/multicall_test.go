@@ -0,0 +1,128 @@
+package multicall
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommands_Sorted(t *testing.T) {
+	var names []string
+	for _, c := range Commands() {
+		names = append(names, c.Name)
+	}
+	assert.IsIncreasing(t, names)
+	assert.Len(t, names, 12)
+}
+
+func TestRun_Dispatch(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "subcommand", args: []string{"/usr/bin/actions", "imagetags"}},
+		{name: "argv0", args: []string{"/usr/bin/imagetags"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspace := t.TempDir()
+			args := append(tt.args, "-local", "-local-workspace", workspace, "-local-ref", "refs/heads/main")
+
+			var out bytes.Buffer
+			require.Equal(t, 0, Run(args, &out))
+			assert.Empty(t, out.String())
+
+			output, err := os.ReadFile(filepath.Join(workspace, ".actions", "output"))
+			require.NoError(t, err)
+			assert.Equal(t, "tags=dev\n", string(output))
+		})
+	}
+}
+
+func TestRun_Post(t *testing.T) {
+	workspace := t.TempDir()
+
+	// Without saved state the checkout post hook has nothing to clean up, so
+	// this would fail if the main checkout ran instead.
+	var out bytes.Buffer
+	assert.Equal(t, 0, Run([]string{"actions", "checkout-post", "-local", "-local-workspace", workspace}, &out))
+	assert.Equal(t, 0, Run([]string{"/checkout-post", "-local", "-local-workspace", workspace}, &out))
+	assert.NoDirExists(t, filepath.Join(workspace, "src"))
+}
+
+func TestRun_List(t *testing.T) {
+	var out bytes.Buffer
+	require.Equal(t, 0, Run([]string{"actions", "list"}, &out))
+	assert.Contains(t, out.String(), "Actions:\n")
+	assert.Regexp(t, `(?m)^  imagetags +Generate docker image tags based on git ref$`, out.String())
+	assert.Regexp(t, `(?m)^  wowinterface +Upload an addon zip file to WowInterface$`, out.String())
+}
+
+func TestRun_Help(t *testing.T) {
+	var out bytes.Buffer
+	require.Equal(t, 0, Run([]string{"actions", "help", "dockerlogin"}, &out))
+
+	help := out.String()
+	assert.Contains(t, help, "dockerlogin: Login to a container registry using buildah\n")
+	assert.Contains(t, help, "Usage: actions dockerlogin [flags]\n")
+	assert.Contains(t, help, "       actions dockerlogin-post [flags]\n")
+	assert.Regexp(t, `(?m)^  registry +string +Registry URL \(required\)$`, help)
+	assert.Regexp(t, `(?m)^  password +secret +Password for authentication \(required, from \$PASSWORD\)$`, help)
+	assert.Regexp(t, `(?m)^  authfile +path +Path to authentication file \(default "\.registry-auth\.json"\)$`, help)
+	assert.Regexp(t, `(?m)^Outputs:\n  authfile +Absolute path to the authentication file$`, help)
+}
+
+func TestRun_Usage(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		code     int
+		contains string
+	}{
+		{name: "no arguments", args: []string{"actions"}, code: 2, contains: "Usage: actions <action>[-post] [flags]"},
+		{name: "help", args: []string{"actions", "help"}, code: 0, contains: "Usage: actions <action>[-post] [flags]"},
+		{name: "help flag", args: []string{"actions", "-h"}, code: 0, contains: "Usage: actions <action>[-post] [flags]"},
+		{name: "unknown action", args: []string{"actions", "deploy"}, code: 2, contains: `Unknown action "deploy"`},
+		{name: "unknown help", args: []string{"actions", "help", "deploy"}, code: 2, contains: `Unknown action "deploy"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			assert.Equal(t, tt.code, Run(tt.args, &out))
+			assert.Contains(t, out.String(), tt.contains)
+			assert.Contains(t, out.String(), "Actions:\n")
+		})
+	}
+}
+
+func TestRun_Pipeline(t *testing.T) {
+	workspace := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(workspace, "pipeline.yml"), []byte(`
+steps:
+  - id: tags
+    uses: imagetags
+  - id: again
+    uses: imagetags
+    with:
+      debug: ${{ env.PIPELINE_DEBUG }}
+`), 0644))
+	t.Setenv("PIPELINE_DEBUG", "false")
+
+	var out bytes.Buffer
+	require.Equal(t, 0, Run([]string{"actions", "run", "-local", "-local-workspace", workspace, "-local-ref", "refs/heads/main"}, &out))
+
+	summary, err := os.ReadFile(filepath.Join(workspace, ".actions", "summary.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(summary), "| `tags` | imagetags | success |")
+	assert.Contains(t, string(summary), "| `again` | imagetags | success |")
+
+	out.Reset()
+	require.Equal(t, 0, Run([]string{"actions", "help", "run"}, &out))
+	assert.Regexp(t, `(?m)^  file +path +Path to the pipeline definition \(relative to workspace\) \(default "pipeline\.yml"\)$`, out.String())
+}
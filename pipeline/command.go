@@ -0,0 +1,30 @@
+package pipeline
+
+import (
+	"log/slog"
+	"os"
+
+	"chameth.com/actions/common"
+)
+
+// Command runs the pipeline named by its file input, using lookup to find
+// the actions that steps use.
+func Command(lookup func(name string) *common.Command) *common.Command {
+	c := common.NewCommand("run", "Run a pipeline of actions in-process")
+	file := c.Path("file", "pipeline.yml", "Path to the pipeline definition (relative to workspace)")
+
+	c.Run = func(ctx *common.Context) error {
+		p, err := Load(file.Value())
+		if err != nil {
+			return err
+		}
+
+		res := Run(ctx, p, lookup)
+		res.Report(os.Stdout)
+		if err := res.Summarise(ctx); err != nil {
+			slog.Warn("Failed to write summary", "error", err)
+		}
+		return res.Err
+	}
+	return c
+}
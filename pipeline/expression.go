@@ -0,0 +1,76 @@
+package pipeline
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var expressionRe = regexp.MustCompile(`\$\{\{\s*(.*?)\s*}}`)
+
+// Expand replaces the expressions in value. Two forms are supported:
+// ${{ steps.<id>.outputs.<name> }} gives the output of an earlier step, or
+// an empty string if it didn't write that output, and ${{ env.<NAME> }}
+// gives an environment variable.
+func Expand(value string, outputs map[string]map[string]string) (string, error) {
+	var err error
+	res := expressionRe.ReplaceAllStringFunc(value, func(match string) string {
+		if err != nil {
+			return ""
+		}
+		var resolved string
+		resolved, err = evaluate(expressionRe.FindStringSubmatch(match)[1], outputs)
+		return resolved
+	})
+	return res, err
+}
+
+// check validates the expressions in value, ensuring that any steps they
+// refer to are in known.
+func check(value string, known map[string]bool) error {
+	for _, match := range expressionRe.FindAllStringSubmatch(value, -1) {
+		ref, err := parse(match[1])
+		if err != nil {
+			return err
+		}
+		if ref.step != "" && !known[ref.step] {
+			return fmt.Errorf("expression %q refers to step %q, which does not run before it", match[1], ref.step)
+		}
+	}
+	return nil
+}
+
+type reference struct {
+	step   string
+	output string
+	env    string
+}
+
+func parse(expression string) (reference, error) {
+	parts := strings.Split(expression, ".")
+	switch {
+	case len(parts) == 4 && parts[0] == "steps" && parts[2] == "outputs" && parts[1] != "" && parts[3] != "":
+		return reference{step: parts[1], output: parts[3]}, nil
+	case len(parts) == 2 && parts[0] == "env" && parts[1] != "":
+		return reference{env: parts[1]}, nil
+	default:
+		return reference{}, fmt.Errorf("unsupported expression %q (use steps.<id>.outputs.<name> or env.<NAME>)", expression)
+	}
+}
+
+func evaluate(expression string, outputs map[string]map[string]string) (string, error) {
+	ref, err := parse(expression)
+	if err != nil {
+		return "", err
+	}
+	if ref.env != "" {
+		return os.Getenv(ref.env), nil
+	}
+
+	stepOutputs, ok := outputs[ref.step]
+	if !ok {
+		return "", fmt.Errorf("expression %q refers to step %q, which has not run", expression, ref.step)
+	}
+	return stepOutputs[ref.output], nil
+}
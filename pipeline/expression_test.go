@@ -0,0 +1,52 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpand(t *testing.T) {
+	t.Setenv("PIPELINE_TEST_REGISTRY", "ghcr.io")
+	outputs := map[string]map[string]string{
+		"tags":     {"tags": "v1,latest"},
+		"checkout": {"path": "/workspace/src", "sha": "abc123"},
+	}
+
+	tests := []struct {
+		name     string
+		value    string
+		expected string
+		err      string
+	}{
+		{name: "plain", value: "image.tar", expected: "image.tar"},
+		{name: "output", value: "${{ steps.tags.outputs.tags }}", expected: "v1,latest"},
+		{name: "no spaces", value: "${{steps.checkout.outputs.sha}}", expected: "abc123"},
+		{name: "embedded", value: "${{ steps.checkout.outputs.path }}/Dockerfile", expected: "/workspace/src/Dockerfile"},
+		{name: "multiple", value: "${{ env.PIPELINE_TEST_REGISTRY }}/app:${{ steps.checkout.outputs.sha }}", expected: "ghcr.io/app:abc123"},
+		{name: "missing output", value: "${{ steps.tags.outputs.digest }}", expected: ""},
+		{name: "missing env", value: "${{ env.PIPELINE_TEST_MISSING }}", expected: ""},
+		{
+			name:  "step not run",
+			value: "${{ steps.push.outputs.digest }}",
+			err:   `expression "steps.push.outputs.digest" refers to step "push", which has not run`,
+		},
+		{
+			name:  "unsupported",
+			value: "${{ inputs.tags }}",
+			err:   `unsupported expression "inputs.tags" (use steps.<id>.outputs.<name> or env.<NAME>)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := Expand(tt.value, outputs)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
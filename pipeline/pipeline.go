@@ -0,0 +1,96 @@
+// Package pipeline runs a sequence of actions in-process, sharing a single
+// context and passing each step's outputs on to later steps.
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+var stepIDRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// Pipeline is a sequence of steps, read from YAML such as:
+//
+//	name: build
+//	steps:
+//	  - uses: checkout
+//	  - id: tags
+//	    uses: imagetags
+//	  - uses: dockerpush
+//	    with:
+//	      tags: ${{ steps.tags.outputs.tags }}
+type Pipeline struct {
+	Name  string `yaml:"name"`
+	Steps []Step `yaml:"steps"`
+}
+
+// Step runs a single action.
+type Step struct {
+	// ID identifies the step in expressions. Defaults to the action's name.
+	ID string `yaml:"id"`
+	// Uses is the name of the action to run.
+	Uses string `yaml:"uses"`
+	// With gives values for the action's inputs, which may contain
+	// expressions. See Expand.
+	With map[string]string `yaml:"with"`
+}
+
+// Load reads and validates the pipeline in the given file.
+func Load(path string) (*Pipeline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pipeline: %w", err)
+	}
+
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pipeline %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse decodes and validates a pipeline. Steps without an ID are given the
+// name of their action.
+func Parse(data []byte) (*Pipeline, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var p Pipeline
+	if err := decoder.Decode(&p); err != nil {
+		return nil, err
+	}
+
+	if len(p.Steps) == 0 {
+		return nil, errors.New("no steps defined")
+	}
+
+	seen := make(map[string]bool)
+	for i := range p.Steps {
+		step := &p.Steps[i]
+		if step.Uses == "" {
+			return nil, fmt.Errorf("step %d: uses is required", i+1)
+		}
+		if step.ID == "" {
+			step.ID = step.Uses
+		}
+		if !stepIDRe.MatchString(step.ID) {
+			return nil, fmt.Errorf("step %d: invalid id %q", i+1, step.ID)
+		}
+		if seen[step.ID] {
+			return nil, fmt.Errorf("step %d: duplicate id %q (set a unique id)", i+1, step.ID)
+		}
+
+		for name, value := range step.With {
+			if err := check(value, seen); err != nil {
+				return nil, fmt.Errorf("step %s: input %s: %w", step.ID, name, err)
+			}
+		}
+		seen[step.ID] = true
+	}
+	return &p, nil
+}
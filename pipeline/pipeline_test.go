@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte(`
+name: build
+steps:
+  - uses: checkout
+    with:
+      fetch-depth: 1
+  - id: tags
+    uses: imagetags
+  - uses: dockerpush
+    with:
+      tags: ${{ steps.tags.outputs.tags }}
+      lfs: true
+`))
+	require.NoError(t, err)
+	assert.Equal(t, &Pipeline{
+		Name: "build",
+		Steps: []Step{
+			{ID: "checkout", Uses: "checkout", With: map[string]string{"fetch-depth": "1"}},
+			{ID: "tags", Uses: "imagetags"},
+			{ID: "dockerpush", Uses: "dockerpush", With: map[string]string{"tags": "${{ steps.tags.outputs.tags }}", "lfs": "true"}},
+		},
+	}, p)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		err  string
+	}{
+		{
+			name: "no steps",
+			yaml: "name: build\n",
+			err:  "no steps defined",
+		},
+		{
+			name: "missing uses",
+			yaml: "steps:\n  - id: build\n",
+			err:  "step 1: uses is required",
+		},
+		{
+			name: "duplicate id",
+			yaml: "steps:\n  - uses: checkout\n  - uses: checkout\n",
+			err:  `step 2: duplicate id "checkout" (set a unique id)`,
+		},
+		{
+			name: "invalid id",
+			yaml: "steps:\n  - id: my.step\n    uses: checkout\n",
+			err:  `step 1: invalid id "my.step"`,
+		},
+		{
+			name: "unknown field",
+			yaml: "steps:\n  - uses: checkout\n    inputs:\n      path: src\n",
+			err:  "yaml: unmarshal errors:\n  line 3: field inputs not found in type pipeline.Step",
+		},
+		{
+			name: "later step",
+			yaml: "steps:\n  - uses: dockerpush\n    with:\n      tags: ${{ steps.imagetags.outputs.tags }}\n  - uses: imagetags\n",
+			err:  `step dockerpush: input tags: expression "steps.imagetags.outputs.tags" refers to step "imagetags", which does not run before it`,
+		},
+		{
+			name: "own step",
+			yaml: "steps:\n  - uses: imagetags\n    with:\n      x: ${{ steps.imagetags.outputs.tags }}\n",
+			err:  `step imagetags: input x: expression "steps.imagetags.outputs.tags" refers to step "imagetags", which does not run before it`,
+		},
+		{
+			name: "unsupported expression",
+			yaml: "steps:\n  - uses: checkout\n    with:\n      ref: ${{ github.ref }}\n",
+			err:  `step checkout: input ref: unsupported expression "github.ref" (use steps.<id>.outputs.<name> or env.<NAME>)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml))
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"chameth.com/actions/common"
+)
+
+// Status is the outcome of a step.
+type Status string
+
+const (
+	StatusSuccess Status = "success"
+	StatusFailure Status = "failure"
+	// StatusSkipped is given to steps after one that failed.
+	StatusSkipped Status = "skipped"
+)
+
+// StepResult describes how a step ran.
+type StepResult struct {
+	ID       string
+	Uses     string
+	Status   Status
+	Outputs  map[string]string
+	Duration time.Duration
+	Err      error
+}
+
+// Result describes how a pipeline ran.
+type Result struct {
+	Name     string
+	Steps    []StepResult
+	Duration time.Duration
+	// Err is set if any step or post-job hook failed.
+	Err error
+}
+
+// Run executes the pipeline's steps in order, sharing ctx between them.
+// lookup creates the command for the action a step uses, or returns nil if
+// there is no such action. Once a step fails the remaining steps are
+// skipped. Post-job hooks of the steps that ran are then run in reverse
+// order, as a forge would at the end of a job.
+//
+// Each step writes its outputs, environment, path and state to its own
+// files. Outputs are made available to later steps' expressions, while
+// environment and path changes are applied to this process and passed on
+// to the context's own files.
+func Run(ctx *common.Context, p *Pipeline, lookup func(name string) *common.Command) *Result {
+	start := time.Now()
+	res := &Result{Name: p.Name, Steps: make([]StepResult, len(p.Steps))}
+	for i, step := range p.Steps {
+		res.Steps[i] = StepResult{ID: step.ID, Uses: step.Uses, Status: StatusSkipped}
+	}
+
+	commands := make([]*common.Command, len(p.Steps))
+	for i, step := range p.Steps {
+		if commands[i] = lookup(step.Uses); commands[i] == nil {
+			res.Err = fmt.Errorf("step %s: unknown action %q", step.ID, step.Uses)
+			return res
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "pipeline-")
+	if err != nil {
+		res.Err = fmt.Errorf("failed to create step directory: %w", err)
+		return res
+	}
+	defer os.RemoveAll(dir)
+
+	outputs := make(map[string]map[string]string)
+	files := make([]stepFiles, len(p.Steps))
+	ran := 0
+	for i, step := range p.Steps {
+		files[i] = newStepFiles(dir, i, step.ID)
+		result := &res.Steps[i]
+
+		ctx.StartGroup(fmt.Sprintf("%s (%s)", step.ID, step.Uses))
+		slog.Info("Running step", "step", step.ID, "uses", step.Uses)
+		stepStart := time.Now()
+		result.Err = runStep(ctx, step, commands[i], files[i], outputs)
+		result.Duration = time.Since(stepStart)
+		result.Outputs = outputs[step.ID]
+		ctx.EndGroup()
+		ran++
+
+		if result.Err != nil {
+			result.Status = StatusFailure
+			slog.Error("Step failed", "step", step.ID, "duration", result.Duration, "error", result.Err)
+			res.Err = fmt.Errorf("step %s failed: %w", step.ID, result.Err)
+			break
+		}
+		result.Status = StatusSuccess
+		slog.Info("Step finished", "step", step.ID, "duration", result.Duration)
+	}
+
+	var postErrs []error
+	for i := ran - 1; i >= 0; i-- {
+		if commands[i].Post == nil {
+			continue
+		}
+		slog.Info("Running post-job hook", "step", p.Steps[i].ID)
+		if err := runPost(ctx, commands[i], files[i]); err != nil {
+			slog.Error("Post-job hook failed", "step", p.Steps[i].ID, "error", err)
+			postErrs = append(postErrs, fmt.Errorf("post-job hook for step %s failed: %w", p.Steps[i].ID, err))
+		}
+	}
+
+	res.Err = errors.Join(append([]error{res.Err}, postErrs...)...)
+	res.Duration = time.Since(start)
+	return res
+}
+
+func runStep(ctx *common.Context, step Step, cmd *common.Command, files stepFiles, outputs map[string]map[string]string) error {
+	inputs := make(map[string]string, len(step.With))
+	for name, value := range step.With {
+		expanded, err := Expand(value, outputs)
+		if err != nil {
+			return fmt.Errorf("input %s: %w", name, err)
+		}
+		inputs[name] = expanded
+	}
+
+	runErr := files.use(ctx, func() error {
+		return cmd.Invoke(ctx, inputs)
+	})
+
+	// Outputs and environment changes are kept even if the step failed, as
+	// they would be by a forge.
+	stepOutputs, err := common.ReadKeyValueFile(files.output)
+	if err != nil {
+		return errors.Join(runErr, fmt.Errorf("failed to read outputs: %w", err))
+	}
+	outputs[step.ID] = stepOutputs
+
+	return errors.Join(runErr, files.apply(ctx))
+}
+
+func runPost(ctx *common.Context, cmd *common.Command, files stepFiles) error {
+	state, err := common.ReadKeyValueFile(files.state)
+	if err != nil {
+		return fmt.Errorf("failed to read state: %w", err)
+	}
+
+	// Forges provide state to post-job hooks in the environment.
+	for key, value := range state {
+		if err := os.Setenv("STATE_"+key, value); err != nil {
+			return err
+		}
+		defer os.Unsetenv("STATE_" + key)
+	}
+
+	return files.use(ctx, func() error {
+		return cmd.Post(ctx)
+	})
+}
+
+// stepFiles are the files given to a single step in place of the context's
+// own.
+type stepFiles struct {
+	output string
+	env    string
+	path   string
+	state  string
+}
+
+func newStepFiles(dir string, index int, id string) stepFiles {
+	prefix := filepath.Join(dir, fmt.Sprintf("%02d-%s-", index+1, id))
+	return stepFiles{
+		output: prefix + "output",
+		env:    prefix + "env",
+		path:   prefix + "path",
+		state:  prefix + "state",
+	}
+}
+
+// use runs fn with the step's files swapped into the context.
+func (f stepFiles) use(ctx *common.Context, fn func() error) error {
+	output, env, path, state := ctx.OutputFile, ctx.EnvFile, ctx.PathFile, ctx.StateFile
+	ctx.OutputFile, ctx.EnvFile, ctx.PathFile, ctx.StateFile = f.output, f.env, f.path, f.state
+	defer func() {
+		ctx.OutputFile, ctx.EnvFile, ctx.PathFile, ctx.StateFile = output, env, path, state
+	}()
+	return fn()
+}
+
+// apply sets environment variables and path entries written by the step in
+// this process, and passes them on to the context's files.
+func (f stepFiles) apply(ctx *common.Context) error {
+	env, err := common.ReadKeyValueFile(f.env)
+	if err != nil {
+		return fmt.Errorf("failed to read environment: %w", err)
+	}
+	for _, key := range slices.Sorted(maps.Keys(env)) {
+		if err := os.Setenv(key, env[key]); err != nil {
+			return err
+		}
+		if ctx.EnvFile != "" {
+			if err := ctx.SetEnv(key, env[key]); err != nil {
+				return err
+			}
+		}
+	}
+
+	content, err := os.ReadFile(f.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read path: %w", err)
+	}
+	for entry := range strings.Lines(string(content)) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if err := os.Setenv("PATH", entry+string(os.PathListSeparator)+os.Getenv("PATH")); err != nil {
+			return err
+		}
+		if ctx.PathFile != "" {
+			if err := ctx.AddToPath(entry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Report writes the outcome and duration of each step, followed by the
+// overall result.
+func (r *Result) Report(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tACTION\tRESULT\tDURATION")
+	for _, step := range r.Steps {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", step.ID, step.Uses, step.Status, formatDuration(step))
+	}
+	_ = tw.Flush()
+
+	name := "Pipeline"
+	if r.Name != "" {
+		name = fmt.Sprintf("Pipeline %s", r.Name)
+	}
+	if r.Err != nil {
+		fmt.Fprintf(w, "\n%s failed after %s: %v\n", name, r.Duration.Round(time.Millisecond), r.Err)
+	} else {
+		fmt.Fprintf(w, "\n%s succeeded in %s\n", name, r.Duration.Round(time.Millisecond))
+	}
+}
+
+// Summarise adds a table of the steps to the job summary.
+func (r *Result) Summarise(ctx *common.Context) error {
+	rows := make([][]string, len(r.Steps))
+	for i, step := range r.Steps {
+		rows[i] = []string{common.Code(step.ID), step.Uses, string(step.Status), formatDuration(step)}
+	}
+
+	title := "Pipeline"
+	if r.Name != "" {
+		title = r.Name
+	}
+	return ctx.NewSummary().
+		Heading(3, title).
+		Table([]string{"Step", "Action", "Result", "Duration"}, rows).
+		Write()
+}
+
+func formatDuration(step StepResult) string {
+	if step.Status == StatusSkipped {
+		return "-"
+	}
+	return step.Duration.Round(time.Millisecond).String()
+}
@@ -0,0 +1,179 @@
+package pipeline
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"chameth.com/actions/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testActions records what the commands returned by lookup see when run.
+type testActions struct {
+	tags  []string
+	env   string
+	path  string
+	posts []string
+}
+
+func (a *testActions) lookup(name string) *common.Command {
+	c := common.NewCommand(name, "")
+	switch name {
+	case "producer":
+		c.Run = func(ctx *common.Context) error {
+			return errors.Join(
+				ctx.WriteOutput(map[string]string{"tags": "v1,latest"}),
+				ctx.SetEnv("PIPELINE_TEST_VAR", "set"),
+				ctx.AddToPath("/opt/tool/bin"),
+				ctx.SaveState("cleanup", name),
+			)
+		}
+		c.Post = func(ctx *common.Context) error {
+			a.posts = append(a.posts, ctx.GetState("cleanup"))
+			return nil
+		}
+	case "consumer":
+		tags := c.List("tags", "", "Tags").Required()
+		c.Run = func(ctx *common.Context) error {
+			a.tags = tags.Value()
+			a.env = os.Getenv("PIPELINE_TEST_VAR")
+			a.path = os.Getenv("PATH")
+			return nil
+		}
+	case "failing":
+		c.Run = func(ctx *common.Context) error {
+			return errors.New("it broke")
+		}
+		c.Post = func(ctx *common.Context) error {
+			a.posts = append(a.posts, name)
+			return nil
+		}
+	default:
+		return nil
+	}
+	return c
+}
+
+func testContext(t *testing.T) *common.Context {
+	t.Setenv("PATH", os.Getenv("PATH"))
+	t.Setenv("PIPELINE_TEST_VAR", "")
+
+	dir := t.TempDir()
+	return &common.Context{
+		Workspace:   dir,
+		OutputFile:  filepath.Join(dir, "output"),
+		EnvFile:     filepath.Join(dir, "env"),
+		PathFile:    filepath.Join(dir, "path"),
+		SummaryFile: filepath.Join(dir, "summary.md"),
+		StateFile:   filepath.Join(dir, "state"),
+		Stdout:      io.Discard,
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx := testContext(t)
+	p, err := Parse([]byte(`
+name: build
+steps:
+  - id: first
+    uses: producer
+  - uses: consumer
+    with:
+      tags: ${{ steps.first.outputs.tags }}
+`))
+	require.NoError(t, err)
+
+	actions := &testActions{}
+	res := Run(ctx, p, actions.lookup)
+	require.NoError(t, res.Err)
+
+	assert.Equal(t, []string{"v1", "latest"}, actions.tags)
+	assert.Equal(t, "set", actions.env)
+	assert.True(t, strings.HasPrefix(actions.path, "/opt/tool/bin"+string(os.PathListSeparator)))
+	assert.Equal(t, []string{"producer"}, actions.posts)
+
+	require.Len(t, res.Steps, 2)
+	assert.Equal(t, StatusSuccess, res.Steps[0].Status)
+	assert.Equal(t, map[string]string{"tags": "v1,latest"}, res.Steps[0].Outputs)
+	assert.Equal(t, StatusSuccess, res.Steps[1].Status)
+	assert.Empty(t, res.Steps[1].Outputs)
+
+	// Outputs stay with the pipeline, but environment and path changes are
+	// passed on.
+	assert.NoFileExists(t, ctx.OutputFile)
+	assert.NoFileExists(t, ctx.StateFile)
+	env, err := common.ReadKeyValueFile(ctx.EnvFile)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"PIPELINE_TEST_VAR": "set"}, env)
+	path, err := os.ReadFile(ctx.PathFile)
+	require.NoError(t, err)
+	assert.Equal(t, "/opt/tool/bin\n", string(path))
+}
+
+func TestRun_Failure(t *testing.T) {
+	ctx := testContext(t)
+	p, err := Parse([]byte(`
+steps:
+  - uses: producer
+  - uses: failing
+  - uses: consumer
+    with:
+      tags: latest
+`))
+	require.NoError(t, err)
+
+	actions := &testActions{}
+	res := Run(ctx, p, actions.lookup)
+	assert.EqualError(t, res.Err, "step failing failed: it broke")
+
+	assert.Nil(t, actions.tags)
+	assert.Equal(t, []string{"failing", "producer"}, actions.posts)
+	assert.Equal(t, StatusSuccess, res.Steps[0].Status)
+	assert.Equal(t, StatusFailure, res.Steps[1].Status)
+	assert.EqualError(t, res.Steps[1].Err, "it broke")
+	assert.Equal(t, StatusSkipped, res.Steps[2].Status)
+}
+
+func TestRun_UnknownAction(t *testing.T) {
+	p, err := Parse([]byte("steps:\n  - uses: producer\n  - uses: deploy\n"))
+	require.NoError(t, err)
+
+	actions := &testActions{}
+	res := Run(testContext(t), p, actions.lookup)
+	assert.EqualError(t, res.Err, `step deploy: unknown action "deploy"`)
+	assert.Empty(t, actions.posts)
+	assert.Equal(t, StatusSkipped, res.Steps[0].Status)
+}
+
+func TestResult_Report(t *testing.T) {
+	ctx := testContext(t)
+	p, err := Parse([]byte("name: build\nsteps:\n  - uses: producer\n  - uses: failing\n  - uses: consumer\n"))
+	require.NoError(t, err)
+
+	actions := &testActions{}
+	res := Run(ctx, p, actions.lookup)
+
+	var out bytes.Buffer
+	res.Report(&out)
+	report := regexp.MustCompile(`[0-9.]+[µm]?s\b`).ReplaceAllString(out.String(), "<d>")
+	assert.Equal(t, `STEP      ACTION    RESULT   DURATION
+producer  producer  success  <d>
+failing   failing   failure  <d>
+consumer  consumer  skipped  -
+
+Pipeline build failed after <d>: step failing failed: it broke
+`, report)
+
+	require.NoError(t, res.Summarise(ctx))
+	summary, err := os.ReadFile(ctx.SummaryFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(summary), "### build\n")
+	assert.Contains(t, string(summary), "| `consumer` | consumer | skipped | - |")
+}
@@ -0,0 +1,14 @@
+package setupgo
+
+import "chameth.com/actions/common"
+
+func Command() *common.Command {
+	c := common.NewCommand("setupgo", "Set up a Go installation in the workspace")
+	target := c.Path("target", "tools/go", "Directory to install Go into")
+	gopath := c.Path("gopath", "cache/go", "Directory to use as GOPATH")
+
+	c.Run = func(ctx *common.Context) error {
+		return Run(ctx, target.Value(), gopath.Value())
+	}
+	return c
+}
@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"os"
 	"os/exec"
+	"strings"
 
 	"chameth.com/actions/common"
 )
@@ -42,5 +43,17 @@ func Run(ctx *common.Context, targetDir string, gopath string) error {
 	}
 
 	slog.Info("Go setup complete")
-	return nil
+
+	release := "Go"
+	if version, err := os.ReadFile(resolvedTarget + "/VERSION"); err == nil {
+		release, _, _ = strings.Cut(string(version), "\n")
+	}
+
+	return ctx.NewSummary().
+		Heading(3, "Set up "+release).
+		Table([]string{"Property", "Value"}, [][]string{
+			{"GOROOT", common.Code(resolvedTarget)},
+			{"GOPATH", common.Code(resolvedGopath)},
+		}).
+		Write()
 }
@@ -0,0 +1,14 @@
+package wowaddon
+
+import "chameth.com/actions/common"
+
+func Command() *common.Command {
+	c := common.NewCommand("wowaddon", "Create a zip file of a World of Warcraft addon")
+	source := c.Path("source", "src", "Source directory containing the addon")
+	destination := c.Path("destination", ".", "Destination directory for the zip file")
+
+	c.Run = func(ctx *common.Context) error {
+		return Run(ctx, source.Value(), destination.Value())
+	}
+	return c
+}
@@ -27,7 +27,7 @@ func Run(ctx *common.Context, src, dst string) error {
 	version := tocVersion
 	if tag := strings.TrimPrefix(ctx.Tag(), "v"); tag != "" {
 		if err := patchTocVersion(tocPath, tag); err != nil {
-			return fmt.Errorf("failed to patch toc version: %w", err)
+			return common.FileError(fmt.Errorf("failed to patch toc version: %w", err), ctx.WorkspacePath(tocPath), 0)
 		}
 		version = tag
 	}
@@ -54,7 +54,11 @@ func Run(ctx *common.Context, src, dst string) error {
 	}
 
 	slog.Info("Created addon zip", "path", zipPath, "files", count)
-	return nil
+
+	return ctx.NewSummary().
+		Heading(3, "Packaged "+name+" "+version).
+		Paragraph(fmt.Sprintf("Created %s containing %d file(s).", common.Code(zipPath), count)).
+		Write()
 }
 
 func addonInfo(src string) (name, version, tocPath string, err error) {
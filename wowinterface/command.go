@@ -0,0 +1,17 @@
+package wowinterface
+
+import "chameth.com/actions/common"
+
+func Command() *common.Command {
+	c := common.NewCommand("wowinterface", "Upload an addon zip file to WowInterface")
+	apiKey := c.Secret("api-key", "API_KEY", "WowInterface API token").Required()
+	addonID := c.String("addon-id", "", "WowInterface addon ID").Required()
+	path := c.String("path", "", "Path to the zip file to upload (supports glob patterns)").Required()
+	changelog := c.Path("changelog", "src/CHANGELOG.md", "Path to a changelog file to include with the upload (generated from Conventional Commits if it has no entry for the version)")
+	heading := c.HeadingPattern("changelog-heading", "keepachangelog", "Format of the changelog's version headings: keepachangelog, plain, version, or a regular expression capturing the version")
+
+	c.Run = func(ctx *common.Context) error {
+		return Run(ctx, apiKey.Value(), addonID.Value(), path.Value(), changelog.Value(), heading.Value())
+	}
+	return c
+}
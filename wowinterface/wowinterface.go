@@ -9,12 +9,15 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"chameth.com/actions/common"
 )
 
-func Run(ctx *common.Context, apiKey, addonID, path, changelogFile string) error {
+func Run(ctx *common.Context, apiKey, addonID, path, changelogFile string, heading *regexp.Regexp) error {
+	ctx.AddMask(apiKey)
+
 	resolved := ctx.ResolvePath(path)
 	matches, err := filepath.Glob(resolved)
 	if err != nil {
@@ -34,19 +37,34 @@ func Run(ctx *common.Context, apiKey, addonID, path, changelogFile string) error
 	}
 
 	var changelogStr string
-	changelogSection, err := ctx.Changelog(changelogFile, version, ctx.Tag())
+	changelogSection, err := ctx.ReleaseNotes(changelogFile, heading, version, ctx.Tag())
 	if err == nil {
 		changelogStr = changelogSection
+	} else {
+		slog.Warn("Uploading without a changelog", "error", err)
 	}
 
 	slog.Info("Uploading to WowInterface", "file", filePath, "addon", addonID, "version", version)
 
-	if err := upload(apiKey, addonID, version, filePath, changelogStr); err != nil {
+	// WowInterface renders changelogs as BBCode, not markdown.
+	rendered, err := common.RenderMarkdown(changelogStr, common.FormatBBCode)
+	if err != nil {
+		return err
+	}
+
+	if err := upload(apiKey, addonID, version, filePath, rendered); err != nil {
 		return fmt.Errorf("failed to upload: %w", err)
 	}
 
 	slog.Info("Upload complete")
-	return nil
+
+	s := ctx.NewSummary().
+		Heading(2, "Uploaded "+filepath.Base(filePath)+" to WowInterface").
+		Paragraph(fmt.Sprintf("Addon %s, version %s.", common.Code(addonID), common.Code(version)))
+	if changelogStr != "" {
+		s.Details("Changelog", changelogStr)
+	}
+	return s.Write()
 }
 
 func extractVersion(path string) (string, error) {
@@ -104,7 +122,8 @@ func upload(apiKey, addonID, version, filePath, changelog string) error {
 	req.Header.Set("Content-Type", w.FormDataContentType())
 	req.Header.Set("x-api-token", apiKey)
 
-	resp, err := http.DefaultClient.Do(req)
+	// Like every upload, this is only retried if it can't have taken effect.
+	resp, err := common.HTTPClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
 	}